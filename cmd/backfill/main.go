@@ -0,0 +1,105 @@
+// Command backfill populates Meetings, Forms, Analysis and the results for
+// every day between --from and --to, one day at a time through the data source.
+//
+//	go run ./cmd/backfill --from 2024-09-01 --to 2024-09-30
+//
+// Settings are read like the server's, see pkg/config and --config.
+//
+// Each finished stage is recorded in PipelineRuns, so running the same range
+// again after an interruption only redoes the stages that did not succeed.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/api/racing"
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/scheduler"
+	"github.com/mmanjoura/clean-bet-backend/pkg/source"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+)
+
+func main() {
+	from := flag.String("from", "", "first race date to backfill (YYYY-MM-DD)")
+	to := flag.String("to", "", "last race date to backfill (YYYY-MM-DD), defaults to --from")
+	fixtures := flag.String("fixtures", "", "read saved pages from this directory instead of the racing site")
+	configFile := flag.String("config", "", "YAML configuration file, defaults to $"+config.FileEnv)
+	flag.Parse()
+
+	if *to == "" {
+		*to = *from
+	}
+	first, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		log.Fatalf("invalid --from %q: %v", *from, err)
+	}
+	last, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		log.Fatalf("invalid --to %q: %v", *to, err)
+	}
+	if last.Before(first) {
+		log.Fatalf("--to %s is before --from %s", *to, *from)
+	}
+
+	cfg, err := config.Load(*configFile, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Database.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := database.ConnectDatabase(cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	st := store.New(db)
+
+	// Load again with the Configurations table under the file and environment
+	table, err := st.Config.All(context.Background())
+	if err != nil {
+		log.Fatalf("Error retrieving configurations: %v", err)
+	}
+	cfg, err = config.Load(*configFile, table)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	webSource := source.NewWebSource(cfg.DataLink)
+	if *fixtures != "" {
+		webSource = source.NewFixtureSource(*fixtures)
+	}
+	webSource.Monitor = source.NewScrapeMonitor(db)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	pipeline := scheduler.New(db, racing.BackfillStages(st, webSource, config.NewManager(*configFile, cfg)))
+
+	failed := 0
+	for date := first; !date.After(last); date = date.AddDate(0, 0, 1) {
+		day := date.Format("2006-01-02")
+		if err := pipeline.RunPending(ctx, day); err != nil {
+			if ctx.Err() != nil {
+				log.Fatalf("%s: interrupted, run the same range again to resume", day)
+			}
+			log.Printf("%s: %v", day, err)
+			failed++
+			continue
+		}
+		log.Printf("%s: complete", day)
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d days are incomplete, run the same range again to retry them", failed)
+	}
+}
@@ -0,0 +1,87 @@
+// Command backtest replays the scoring of a profile over the race days between
+// --from and --to, backs the top picks of each race and prints the metrics,
+// which are stored in Backtests to compare with other runs.
+//
+//	go run ./cmd/backtest --from 2024-09-01 --to 2024-09-30 --profile default
+//
+// Only the form lines run before each race are scored, results come from the
+// later form lines or the settled analysis. Settings are read like the
+// server's, see pkg/config and --config.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/api/racing"
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+)
+
+func main() {
+	var params models.BacktestParameters
+	flag.StringVar(&params.From, "from", "", "first race date to replay (YYYY-MM-DD)")
+	flag.StringVar(&params.To, "to", "", "last race date to replay (YYYY-MM-DD), defaults to --from")
+	flag.StringVar(&params.Name, "name", "", "label of the backtest")
+	flag.StringVar(&params.Profile, "profile", models.DefaultScoringProfile, "scoring profile")
+	flag.IntVar(&params.Picks, "picks", 1, "top scored runners backed in each race")
+	flag.Float64Var(&params.MinScore, "min-score", 0, "never back runners scoring less")
+	flag.StringVar(&params.Staking, "staking", models.StakingLevel, "staking rule, level or percentage")
+	flag.Float64Var(&params.Stake, "stake", 0, "level stake, defaults to the configured bet value")
+	flag.Float64Var(&params.Percent, "percent", 0, "percentage of the bank staked on each bet")
+	flag.Float64Var(&params.Bank, "bank", 0, "starting bank of percentage staking")
+	configFile := flag.String("config", "", "YAML configuration file, defaults to $"+config.FileEnv)
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Database.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := database.ConnectDatabase(cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	st := store.New(db)
+
+	// Load again with the Configurations table under the file and environment
+	table, err := st.Config.All(context.Background())
+	if err != nil {
+		log.Fatalf("Error retrieving configurations: %v", err)
+	}
+	cfg, err = config.Load(*configFile, table)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	params, err = racing.BacktestDefaults(params, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	backtest, err := racing.RunBacktest(ctx, st, params, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(backtest); err != nil {
+		log.Fatal(err)
+	}
+}
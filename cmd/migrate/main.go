@@ -0,0 +1,89 @@
+// Command migrate applies, reverts and lists the schema migrations embedded in
+// pkg/database/migrations.
+//
+//	go run ./cmd/migrate up
+//	go run ./cmd/migrate down -steps 1
+//	go run ./cmd/migrate status
+//	go run ./cmd/migrate -config config.yaml status
+//
+// The server applies pending migrations on startup, this command is for
+// inspecting the schema and rolling changes back.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+)
+
+func main() {
+	configFile := flag.String("config", "", "YAML configuration file, defaults to $"+config.FileEnv)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: migrate [-config file] up | down [-steps n] | status\n")
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Only the database settings are needed, the rest is left unchecked
+	cfg, err := config.Load(*configFile, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Database.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := database.Open(cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	defer db.Close()
+
+	switch command := flag.Arg(0); command {
+	case "up":
+		if err := database.Migrate(db); err != nil {
+			log.Fatal(err)
+		}
+		printStatus(db)
+
+	case "down":
+		down := flag.NewFlagSet("down", flag.ExitOnError)
+		steps := down.Int("steps", 1, "number of migrations to revert")
+		down.Parse(flag.Args()[1:])
+
+		if err := database.MigrateDown(db, *steps); err != nil {
+			log.Fatal(err)
+		}
+		printStatus(db)
+
+	case "status":
+		printStatus(db)
+
+	default:
+		log.Printf("unknown command %q", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func printStatus(db *database.DB) {
+	states, err := database.MigrationStatus(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, state := range states {
+		applied := "pending"
+		if state.AppliedAt != nil {
+			applied = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%04d %-32s %s\n", state.Version, state.Name, applied)
+	}
+}
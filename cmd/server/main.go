@@ -1,23 +1,74 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 
 	"github.com/mmanjoura/clean-bet-backend/pkg/api"
+	"github.com/mmanjoura/clean-bet-backend/pkg/api/racing"
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
 	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/jobs"
+	"github.com/mmanjoura/clean-bet-backend/pkg/scheduler"
+	"github.com/mmanjoura/clean-bet-backend/pkg/source"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	configFile := flag.String("config", "", "YAML configuration file, defaults to $"+config.FileEnv)
+	flag.Parse()
 
-	database.ConnectDatabase()
-	config := database.Database.Config
+	cfg, err := config.Load(*configFile, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Database.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := database.ConnectDatabase(cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v\n", err)
+	}
+	st := store.New(db)
+
+	// Load again with the Configurations table under the file and environment
+	table, err := st.Config.All(context.Background())
+	if err != nil {
+		log.Fatalf("Error retrieving configurations: %v\n", err)
+	}
+	cfg, err = config.Load(*configFile, table)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	manager := config.NewManager(*configFile, cfg)
+
+	webSource := source.NewWebSource(cfg.DataLink)
+	webSource.Monitor = source.NewScrapeMonitor(db)
+
+	// Jobs still queued or running belong to a previous process
+	jobManager := jobs.NewManager(db)
+	if err := jobManager.MarkInterrupted(); err != nil {
+		log.Fatal(err)
+	}
+
+	pipeline := scheduler.New(db, racing.PipelineStages(st, webSource, manager))
+	if err := pipeline.Start(cfg.Schedule); err != nil {
+		log.Fatal(err)
+	}
+	defer pipeline.Stop()
 
 	//gin.SetMode(gin.ReleaseMode)
 	gin.SetMode(gin.DebugMode)
-	r := api.InitRouter()
-	if err := r.Run(config["PORT"]); err != nil {
+	r := api.InitRouter(st, manager, webSource, jobManager, pipeline)
+	if err := r.Run(cfg.Address()); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,157 @@
+// Package admin serves the routes reserved to admin users. Users are made
+// admins by setting their Users.user_type to "admin".
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler serves the admin routes
+type Handler struct {
+	Store  *store.Store
+	Config *config.Manager
+
+	// mu serialises configuration changes, so each one is built on the
+	// rows the previous one saved
+	mu sync.Mutex
+}
+
+// NewHandler returns a Handler changing the configuration of cfg through st
+func NewHandler(st *store.Store, cfg *config.Manager) *Handler {
+	return &Handler{Store: st, Config: cfg}
+}
+
+// GetConfig godoc
+// @Summary Get the configuration
+// @Description Get the configuration in force, its secrets redacted, and the rows of the Configurations table
+// @Tags admin
+// @Produce  json
+// @Success 200 {object} object	"ok"
+// @Router /admin/config [get]
+func (h *Handler) GetConfig(c *gin.Context) {
+	table, err := h.Store.Config.All(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cfg := h.Config.Current()
+	settings := make(map[string]string, len(table))
+	for key, value := range table {
+		if config.CheckKey(key) == nil {
+			settings[key] = value
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"config":     cfg.Redacted(),
+		"settings":   settings,
+		"overridden": cfg.Overridden(settings),
+	})
+}
+
+// PutConfig godoc
+// @Summary Change settings
+// @Description Validate and save settings of the Configurations table, then reload the configuration
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param body body models.ConfigUpdate true "Settings keyed like the Configurations table"
+// @Success 200 {object} object	"ok"
+// @Router /admin/config [put]
+func (h *Handler) PutConfig(c *gin.Context) {
+	var update models.ConfigUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var errs []error
+	for key := range update.Settings {
+		if err := config.CheckKey(key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.Join(errs...).Error()})
+		return
+	}
+
+	value, _ := c.Get("user")
+	user, _ := value.(models.User)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	table, err := h.Store.Config.All(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for key, value := range update.Settings {
+		table[key] = value
+	}
+
+	// Nothing is saved unless the whole configuration is still valid
+	cfg, err := h.Config.Build(table)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes, err := h.Store.Config.Update(c, update.Settings, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.Config.Apply(cfg)
+
+	restart := []string{}
+	for _, change := range changes {
+		if config.RequiresRestart(change.Key) {
+			restart = append(restart, change.Key)
+		}
+	}
+	sort.Strings(restart)
+
+	c.JSON(http.StatusOK, gin.H{
+		"config":           cfg.Redacted(),
+		"changes":          changes,
+		"overridden":       cfg.Overridden(update.Settings),
+		"restart_required": restart,
+	})
+}
+
+// GetConfigAudit godoc
+// @Summary List configuration changes
+// @Description List the latest changes made through PUT /admin/config, newest first
+// @Tags admin
+// @Produce  json
+// @Param limit query int false "Number of changes, 50 by default"
+// @Success 200 {object} object	"ok"
+// @Router /admin/config/audit [get]
+func (h *Handler) GetConfigAudit(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+
+	changes, err := h.Store.Config.Audit(c, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
@@ -0,0 +1,196 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+)
+
+var testAdmin = models.User{ID: 3, Email: "admin@example.com"}
+
+// newTestHandler returns a handler over a migrated in-memory SQLite database
+// holding the default Configurations rows, serving the configuration they give
+func newTestHandler(t *testing.T) (*Handler, *gin.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv(config.FileEnv, "")
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := database.OpenDSN(database.SQLite, fmt.Sprintf("file:%s?mode=memory&cache=shared", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	st := store.New(db)
+	table, err := st.Config.All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := config.NewManager("", nil)
+	cfg, err := manager.Build(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Apply(cfg)
+
+	h := NewHandler(st, manager)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user", testAdmin) })
+	r.PUT("/admin/config", h.PutConfig)
+	r.GET("/admin/config/audit", h.GetConfigAudit)
+	return h, r
+}
+
+func TestPutConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		audited  []string
+		restart  []string
+		betValue int
+	}{
+		{
+			name:     "setting",
+			body:     `{"settings": {"bet_value": "25"}}`,
+			status:   http.StatusOK,
+			audited:  []string{"bet_value"},
+			restart:  []string{},
+			betValue: 25,
+		},
+		{
+			// total_runs already holds 20
+			name:     "unchanged setting",
+			body:     `{"settings": {"bet_value": "25", "total_runs": "20"}}`,
+			status:   http.StatusOK,
+			audited:  []string{"bet_value"},
+			restart:  []string{},
+			betValue: 25,
+		},
+		{
+			name:     "read at start up",
+			body:     `{"settings": {"PORT": ":9090", "schedule_forms": "0 8 * * *", "delta": "2"}}`,
+			status:   http.StatusOK,
+			audited:  []string{"PORT", "delta", "schedule_forms"},
+			restart:  []string{"PORT", "schedule_forms"},
+			betValue: 10,
+		},
+		{name: "no settings", body: `{}`, status: http.StatusBadRequest, betValue: 10},
+		{name: "unknown setting", body: `{"settings": {"bet_value": "25", "stake": "5"}}`, status: http.StatusBadRequest, betValue: 10},
+		{name: "secret", body: `{"settings": {"JWT-API-KEY": "guessed"}}`, status: http.StatusBadRequest, betValue: 10},
+		{name: "not a number", body: `{"settings": {"bet_value": "ten"}}`, status: http.StatusBadRequest, betValue: 10},
+		// Nothing is saved when one of the settings is out of range
+		{name: "out of range", body: `{"settings": {"delta": "2", "bet_value": "0"}}`, status: http.StatusBadRequest, betValue: 10},
+		{name: "schedule", body: `{"settings": {"schedule_forms": "at eight"}}`, status: http.StatusBadRequest, betValue: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, r := newTestHandler(t)
+			before := h.Config.Current()
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/config", strings.NewReader(tt.body)))
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+
+			audit, err := h.Store.Config.Audit(context.Background(), 50)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg := h.Config.Current(); cfg.BetValue != tt.betValue {
+				t.Errorf("bet_value %d in force, want %d", cfg.BetValue, tt.betValue)
+			}
+
+			if tt.status != http.StatusOK {
+				if len(audit) != 0 {
+					t.Errorf("audited %+v for a rejected change", audit)
+				}
+				if h.Config.Current() != before {
+					t.Error("applied a rejected change")
+				}
+				return
+			}
+
+			var response struct {
+				Changes         []models.ConfigAudit `json:"changes"`
+				RestartRequired []string             `json:"restart_required"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for _, change := range response.Changes {
+				keys = append(keys, change.Key)
+				// Only the schedule has no default row to replace
+				if (change.OldValue == nil) != strings.HasPrefix(change.Key, "schedule_") ||
+					change.UserID != testAdmin.ID || change.ChangedBy != testAdmin.Email {
+					t.Errorf("got change %+v", change)
+				}
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.audited, ",") {
+				t.Errorf("changed %v, want %v", keys, tt.audited)
+			}
+			if len(audit) != len(tt.audited) {
+				t.Errorf("got %d audit rows, want %d", len(audit), len(tt.audited))
+			}
+			if strings.Join(response.RestartRequired, ",") != strings.Join(tt.restart, ",") || response.RestartRequired == nil {
+				t.Errorf("restart required for %v, want %v", response.RestartRequired, tt.restart)
+			}
+		})
+	}
+}
+
+// TestPutConfigAudit keeps the value each change replaced
+func TestPutConfigAudit(t *testing.T) {
+	_, r := newTestHandler(t)
+
+	for _, betValue := range []string{"25", "30"} {
+		w := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"settings": {"bet_value": %q}}`, betValue)
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/config", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", w.Code, w.Body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/config/audit?limit=5", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	var response struct {
+		Changes []models.ConfigAudit `json:"changes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, change := range response.Changes {
+		got = append(got, fmt.Sprintf("%s->%s", *change.OldValue, change.NewValue))
+	}
+	if want := []string{"25->30", "10->25"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got changes %v, want %v newest first", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/config/audit?limit=0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d for a limit of 0", w.Code)
+	}
+}
@@ -44,21 +44,6 @@ func ConvertDistance(distanceStr string) string {
 	return strconv.FormatFloat(furlongs, 'f', -1, 64)
 }
 
-// Function to remove duplicate odds patterns
-func RemoveDuplicateOdds(odds string) string {
-	// Count the number of '/' characters in the string
-	count := strings.Count(odds, "/")
-
-	// If there are exactly two '/' characters, return the first half of the string
-	if count == 2 {
-		mid := len(odds) / 2
-		return odds[:mid]
-	}
-
-	// If there is not exactly two '/', return the original string
-	return odds
-}
-
 func NullableToString(ns sql.NullString) string {
 	if ns.Valid {
 		return ns.String
@@ -1,10 +1,11 @@
 package racing
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"math"
-	"math/rand/v2"
 	"net/http"
 	"regexp"
 	"sort"
@@ -14,8 +15,12 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mmanjoura/clean-bet-backend/pkg/api/common"
-	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/jobs"
 	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/odds"
+	"github.com/mmanjoura/clean-bet-backend/pkg/settlement"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
 )
 
 type Selection struct {
@@ -25,12 +30,9 @@ type Selection struct {
 	NumberOfRuns int
 }
 
-// RacePicksSimulation handles the simulation of race picks and calculates win probabilities.
-func DoAnalysis(c *gin.Context) {
-	db := database.Database.DB
-
+// DoAnalysis starts a job scoring every runner of the event date.
+func (h *Handler) DoAnalysis(c *gin.Context) {
 	var raceParams models.RaceParameters
-	meetingsMap := make(map[string][]models.Selection)
 
 	// Bind JSON input to optimalParams
 	if err := c.ShouldBindJSON(&raceParams); err != nil {
@@ -38,226 +40,178 @@ func DoAnalysis(c *gin.Context) {
 		return
 	}
 
-	// Query for today's runners
-	rows, err := db.Query(`
-		SELECT selection_id,
-			selection_name,
-			event_name,
-			event_date,
-			event_time,
-			price,
-			race_distance,
-			race_category,
-			track_condition,
-			number_of_runners,
-			race_track,
-			race_class,
-			selection_link,
-			event_link
-		FROM Meetings 
-		WHERE DATE(event_date) = ? `,
-		raceParams.EventDate)
+	if raceParams.Profile == "" {
+		raceParams.Profile = models.DefaultScoringProfile
+	}
+	if _, err := LoadScoringProfile(c, h.Store.Analysis, raceParams.Profile); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, store.ErrUnknownProfile) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
 
+	job, err := h.Jobs.Start("analysis", raceParams, func(ctx context.Context, progress *jobs.Progress) error {
+		return RunAnalysis(ctx, h.Store, h.Config.Current(), raceParams, progress)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var selection models.Selection
-
-		// Use sql.NullString for nullable fields
-		var selectionName, eventName, eventDate,
-			eventTime, raceDistance, raceCategory,
-			trackCondition,
-			numberOfRunners,
-			raceTrack, raceClass,
-			odds, eventLink sql.NullString
-
-		// Scan the row values into the nullable types
-		if err := rows.Scan(
-			&selection.ID,
-			&selectionName,
-			&eventName,
-			&eventDate,
-			&eventTime,
-			&odds,
-			&raceDistance,
-			&raceCategory,
-			&trackCondition,
-			&numberOfRunners,
-			&raceTrack,
-			&raceClass,
-			&selection.Link,
-			&eventLink,
-		); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
 
-		// Convert sql.NullString to regular strings
-		selection.Name = nullableToString(selectionName)
-		selection.EventName = nullableToString(eventName)
-		selection.EventDate = nullableToString(eventDate)
-		selection.EventTime = nullableToString(eventTime)
-		selection.RaceDistance = nullableToString(raceDistance)
-		selection.RaceCategory = nullableToString(raceCategory)
-		selection.TrackCondition = nullableToString(trackCondition)
-		selection.NumberOfRunners = nullableToString(numberOfRunners)
-		selection.RaceTrack = nullableToString(raceTrack)
-		selection.RaceClass = nullableToString(raceClass)
-		selection.EventLink = nullableToString(eventLink)
-		selection.Odds = nullableToString(odds)
+	c.JSON(http.StatusAccepted, gin.H{"message": "Analysis started", "job": job})
+}
+
+// RunAnalysis scores every runner of raceParams.EventDate and saves the result
+// to Analysis. Runners are scored in a fixed order from a source seeded with
+// raceParams.Seed, so the same seed and form give the same scores. The scores
+// of each raceParams.Profile are kept apart.
+func RunAnalysis(ctx context.Context, st *store.Store, cfg *config.Config, raceParams models.RaceParameters, progress *jobs.Progress) error {
+	meetingsMap := make(map[string][]models.Selection)
 
+	profile, err := LoadScoringProfile(ctx, st.Analysis, raceParams.Profile)
+	if err != nil {
+		return err
+	}
+
+	// Query for today's runners
+	selections, err := st.Meetings.Selections(ctx, raceParams.EventDate)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, selection := range selections {
 		key := selection.EventName + " " + selection.EventTime
 		meetingsMap[key] = append(meetingsMap[key], selection)
+		total++
+	}
+	progress.SetTotal(total)
+
+	seed := AnalysisSeed(raceParams.Seed, raceParams.EventDate)
+	rng := NewRand(seed)
+
+	keys := make([]string, 0, len(meetingsMap))
+	for key := range meetingsMap {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
 	mpResult := make(map[string][]models.AnalysisData)
 
-	for key, meetings := range meetingsMap {
+	for _, key := range keys {
+		meetings := meetingsMap[key]
+		sort.Slice(meetings, func(i, j int) bool { return meetings[i].ID < meetings[j].ID })
 
-		fmt.Printf("Event: %s\n", key)
 		for _, m := range meetings {
-			fmt.Printf("  Selection: %s, Price: %s\n", m.EventName, m.EventTime)
-			resultAnalysis, err := doAnalysisAndSave(raceParams, m)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			resultAnalysis, err := doAnalysisAndSave(ctx, st.Forms, raceParams, m)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
+				return err
 			}
-			totalScore := calculateTotalScore(resultAnalysis)
-			resultAnalysis.TotalScore = totalScore
-			mpResult[resultAnalysis.EventTime] = append(mpResult[resultAnalysis.EventTime], resultAnalysis)
+			components := profile.scoreComponents(resultAnalysis)
+			if noise := scoreNoise(rng, cfg); cfg.ScoreNoise != 0 {
+				components = append(components, models.ComponentScore{Component: componentNoise, Value: noise, Points: noise, Weight: 1, Score: noise})
+			}
+			resultAnalysis.Components = components
+			resultAnalysis.TotalScore = calculateTotalScore(components)
+			resultAnalysis.Seed = seed
+			resultAnalysis.Profile = profile.Name
+			resultAnalysis.Stake = float64(cfg.BetValue)
+			mpResult[key] = append(mpResult[key], resultAnalysis)
+			progress.Done(1)
 		}
 	}
 
-	// Iterate through mpResult
+	// Iterate through mpResult, race by race
 	for _, result := range mpResult {
-
-		for _, r := range result {
-			err = deleteAnalysis(db, r.EventDate, r.SelectionID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-		}
+		setWinProbabilities(result, cfg.WinProbabilityScale)
 		for _, r := range result {
 
-			err := insertAnalysis(db, r, raceParams.EventDate)
+			err := saveAnalysis(ctx, st, r, raceParams.EventDate)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
+				return err
 			}
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"simulationResults": nil})
+	return nil
 }
 
-func doAnalysisAndSave(raceParams models.RaceParameters, selection models.Selection) (models.AnalysisData, error) {
-
-	db := database.Database.DB
-
-	rows, err := db.Query(`
-			SELECT
-				DISTINCT
-				COALESCE(selection_id, 0),
-				selection_name,	
-				position, 
-				Age,
-				Trainer,
-				Sex,
-				Sire,
-				Dam,
-				Owner,	
-				race_class,	
-				race_date,			
-				COUNT(id) AS num_runs,
-				MAX(race_date) AS last_run_date,
-				MAX(race_date) - MIN(race_date) AS duration,
-				COUNT(CASE WHEN position = '1' THEN 1 END) AS win_count,
-				AVG(position) AS avg_position,
-				AVG(rating) AS avg_rating,
-				AVG(distance) AS avg_distance_furlongs,
-				AVG(sp_odds) AS sp_odds,
-				GROUP_CONCAT(position, ', ') AS all_positions,
-				GROUP_CONCAT(distance, ', ') AS all_distances,
-				GROUP_CONCAT(racecourse, ', ') AS all_racecources,
-				GROUP_CONCAT(DATE(race_date), ', ') AS all_race_dates 
-			FROM
-				Forms 	
-				WHERE selection_id = ?  order by race_date desc`,
-		selection.ID)
+// setWinProbabilities shares the chances of winning a race between its
+// runners with form, the runners without are not saved
+func setWinProbabilities(runners []models.AnalysisData, scale float64) {
+	var scores []float64
+	var scored []int
+	for i, runner := range runners {
+		if runner.RaceDate != "" {
+			scores = append(scores, runner.TotalScore)
+			scored = append(scored, i)
+		}
+	}
+	for i, probability := range winProbabilities(scores, scale) {
+		runners[scored[i]].WinProbability = probability
+	}
+}
+
+func doAnalysisAndSave(ctx context.Context, forms store.FormStore, raceParams models.RaceParameters, selection models.Selection) (models.AnalysisData, error) {
+
+	// Form lines of the event date and later are not known before the race
+	data, err := forms.Summary(ctx, selection.ID, raceParams.EventDate)
+	if errors.Is(err, store.ErrNoForm) {
+		return models.AnalysisData{}, nil
+	}
 	if err != nil {
 		return models.AnalysisData{}, err
 	}
-	defer rows.Close()
-
-	var data models.AnalysisData
-
-	for rows.Next() {
-		err := rows.Scan(
-			&data.SelectionID,
-			&data.SelectionName,
-			&data.Position,
-			&data.Age,
-			&data.Trainer,
-			&data.Sex,
-			&data.Sire,
-			&data.Dam,
-			&data.Owner,
-			&data.EventClass,
-			&data.RaceDate,
-			&data.NumRuns,
-			&data.LastRunDate,
-			&data.Duration,
-			&data.WinCount,
-			&data.AvgPosition,
-			&data.AvgRating,
-			&data.AvgDistanceFurlongs,
-			&data.AvgOdds,
-			&data.AllPositions,
-			&data.AllDistances,
-			&data.AllCources,
-			&data.AllRaceDates,
-		)
-
-		if err != nil {
-			continue
-		}
 
-		strRaceDate := string(data.RaceDate)[:10]
-		const layout = "2006-01-02"
-		// Convert the string dates to time.Time
-		raceDate, err := time.Parse(layout, strRaceDate)
-		if err != nil {
-			return models.AnalysisData{}, err
-		}
-		analysisDate, err := time.Parse(layout, raceParams.EventDate)
-		if err != nil {
-			return models.AnalysisData{}, err
-		}
+	strRaceDate := string(data.RaceDate)[:10]
+	const layout = "2006-01-02"
+	// Convert the string dates to time.Time
+	raceDate, err := time.Parse(layout, strRaceDate)
+	if err != nil {
+		return models.AnalysisData{}, err
+	}
+	analysisDate, err := time.Parse(layout, raceParams.EventDate)
+	if err != nil {
+		return models.AnalysisData{}, err
+	}
 
-		// When doing analysis only consider previous performances
-		if raceDate.After(analysisDate) || raceDate.Equal(analysisDate) {
-			continue
-		}
+	// When doing analysis only consider previous performances
+	if raceDate.After(analysisDate) || raceDate.Equal(analysisDate) {
+		return data, nil
+	}
 
-		currentDistance := common.ConvertDistance(selection.RaceDistance)
-		distance, err := strconv.ParseFloat(currentDistance, 64)
+	// The rest since the last run before the race
+	if len(data.LastRunDate) >= 10 {
+		lastRunDate, err := time.Parse(layout, data.LastRunDate[:10])
 		if err != nil {
 			return models.AnalysisData{}, err
 		}
-		data.CurrentDistance = distance
-		data.EventName = selection.EventName
-		data.EventTime = selection.EventTime
-		data.EventLink = selection.EventLink
-		data.SelecionLink = selection.Link
+		data.RecoveryDays = int(analysisDate.Sub(lastRunDate).Hours() / 24)
+	}
 
-		perferedDistancd := preferredDistance(data.AllPositions, data.AllDistances, data.AllRaceDates)
-		data.PreferedDistance = perferedDistancd
+	currentDistance := common.ConvertDistance(selection.RaceDistance)
+	distance, err := strconv.ParseFloat(currentDistance, 64)
+	if err != nil {
+		return models.AnalysisData{}, err
+	}
+	data.CurrentDistance = distance
+	data.EventName = selection.EventName
+	data.EventTime = selection.EventTime
+	data.EventLink = selection.EventLink
+	data.SelecionLink = selection.Link
+	// Score the class of the race run, the form only has those of past races
+	if selection.RaceClass != "" {
+		data.EventClass = selection.RaceClass
 	}
+
+	perferedDistancd := preferredDistance(data.AllPositions, data.AllDistances, data.AllRaceDates)
+	data.PreferedDistance = perferedDistancd
+
 	return data, nil
 }
 
@@ -277,33 +231,8 @@ func filterSelectionsByID(selections []models.Selection, ids []int) []models.Sel
 	return filteredSelections
 }
 
-func fetchConstantScore(db *sql.DB, category, item string) (float64, error) {
-	var score float64
-	row := db.QueryRow("SELECT score FROM score_constants WHERE category = ? AND item = ?", category, item)
-	err := row.Scan(&score)
-	if err != nil {
-		return 0.0, err
-	}
-	return score, nil
-}
-func scoreRace(db *sql.DB, races []models.AnalysisData, raceParams models.RaceParameters) (models.ScoreBreakdown, error) {
-	var raceTypeScore, courseScore, distanceScore, classScore, ageScore, positionScore float64
-	var eventName, eventTime, selectionName, odds, trainer string
-
-	return models.ScoreBreakdown{
-
-		EventName:     eventName,
-		EventTime:     eventTime,
-		SelectionName: selectionName,
-		Odds:          odds,
-		Trainer:       trainer,
-		RaceTypeScore: raceTypeScore,
-		CourseScore:   courseScore,
-		DistanceScore: distanceScore,
-		ClassScore:    classScore,
-		AgeScore:      ageScore,
-		PositionScore: positionScore,
-	}, nil
+func fetchConstantScore(ctx context.Context, analyses store.AnalysisStore, category, item string) (float64, error) {
+	return analyses.ConstantScore(ctx, category, item)
 }
 
 // CheckImprovement checks if the horse is improving over the distance.
@@ -415,16 +344,16 @@ func calculateHorseScores(selectionRunDates, selectionPositions, selectionsRatin
 }
 
 // New function to fetch age score based on the race distance
-func fetchAgeScore(db *sql.DB, age int, distance float64) (float64, error) {
+func fetchAgeScore(ctx context.Context, analyses store.AnalysisStore, age int, distance float64) (float64, error) {
 	var score float64
 	var err error
 
 	if distance > 12.0 {
 		// Greater than 12 furlongs
-		score, err = fetchConstantScore(db, "Age-greater-12f", strconv.Itoa(age))
+		score, err = fetchConstantScore(ctx, analyses, "Age-greater-12f", strconv.Itoa(age))
 	} else {
 		// Less than or equal to 12 furlongs
-		score, err = fetchConstantScore(db, "Age-bellow-12f", strconv.Itoa(age))
+		score, err = fetchConstantScore(ctx, analyses, "Age-bellow-12f", strconv.Itoa(age))
 	}
 
 	return score, err
@@ -453,83 +382,9 @@ func stringInSlice(target string, slice []string) bool {
 	return false
 }
 
-// Scoring Function
-func ScoreSelection(selection models.AnalysisData, params models.RaceParameters, limit int) float64 {
-
-	var score float64
-	config := database.Database.Config
-
-	deltaStr := config["delta"]
-	delta, err := strconv.ParseFloat(deltaStr, 64)
-	if err != nil {
-		fmt.Println("Error converting to float64:", err)
-	}
-
-	if math.Abs(selection.CurrentDistance-selection.PreferedDistance) <= delta {
-
-		// Assign a random score between 5 and 20
-		score += 5 + 15*rand.Float64()
-
-	}
-
-	// 0. gelding Score
-	if selection.Sex == "Gelding" {
-		score += 2 + float64(selection.Duration)
-	} else {
-		score += float64(selection.Duration)
-	}
-
-	totalRuns, err := strconv.Atoi(config["total_runs"])
-	if err != nil {
-		fmt.Println("Error converting to integer:", err)
-	}
-
-	// 3. Number of runs so far
-	if selection.NumRuns < totalRuns {
-		score += float64(selection.NumRuns)
-	}
-
-	// Distance Analysis
-	distances := strings.Split(selection.AllDistances, ",")
-	if len(distances) > limit {
-		distances = distances[:limit]
-	}
-
-	var totalDistance float64
-	for _, distance := range distances {
-		distance = strings.TrimSpace(distance)
-		convertedDistance := common.ConvertDistance(distance)
-		fd, err := strconv.ParseFloat(convertedDistance, 64)
-		if err != nil {
-			continue
-		}
-		totalDistance += fd
-	}
-
-	avgDistance := totalDistance / float64(len(distances))
-
-	// Distance and Age-Based Scoring
-	distanceDiff := math.Abs(avgDistance - selection.CurrentDistance)
-	switch {
-	case avgDistance <= 12:
-
-		score += calculateDistanceScore(distanceDiff, []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}, []float64{15, 13, 11, 9, 7, 5, 3, 1, 0})
-	default:
-
-		score += calculateDistanceScore(distanceDiff, []float64{0.5, 1.0, 1.5, 2.0, 2.5, 3.0, 3.5, 4.0, 4.5}, []float64{9, 8, 7, 6, 5, 4, 3, 2, 1})
-	}
-
-	// Position Analysis
-	positions := strings.Split(selection.AllPositions, ",")
-	score += calculatePositionScore(positions, limit)
-
-	return score
-}
-
 func safeDivide(numerator, denominator float64) float64 {
 	if denominator == 0.0 {
 		// Handle division by zero case, maybe return 0 or some other default value.
-		fmt.Println("Warning: Division by zero detected.")
 		return math.Inf(1) // Or return a different value that makes sense in your context.
 	}
 	return numerator / denominator
@@ -746,47 +601,6 @@ func nullableToString(ns sql.NullString) string {
 	return "" // Return empty string if NULL
 }
 
-// Calculate Distance Score
-func calculateDistanceScore(distanceDiff float64, thresholds, scores []float64) float64 {
-	var score float64
-	for i, threshold := range thresholds {
-		if distanceDiff <= threshold {
-			score += scores[i]
-			break
-		}
-	}
-	return score
-}
-
-// Calculate Position Score
-func calculatePositionScore(positions []string, limit int) float64 {
-	var score float64
-	if len(positions) > limit {
-		positions = positions[:limit]
-	}
-
-	for _, pos := range positions {
-		pos = strings.TrimSpace(pos)
-		if strings.Contains(pos, "F") || strings.Contains(pos, "PU") || strings.Contains(pos, "U") || strings.Contains(pos, "R") {
-			score -= 5
-		}
-		if strings.Contains(pos, "/") {
-			p := strings.Split(pos, "/")
-			if len(p) != 2 {
-				continue
-			}
-			numerator, err1 := strconv.Atoi(strings.TrimSpace(p[0]))
-			denominator, err2 := strconv.Atoi(strings.TrimSpace(p[1]))
-			if err1 != nil || err2 != nil || denominator == 0 {
-				score -= 1
-				continue
-			}
-			score += math.Round(safeDivide(float64(denominator), float64(numerator))) * 10
-		}
-	}
-	return score
-}
-
 func extractNumber(s string) (string, error) {
 	parts := strings.Fields(s)
 	if len(parts) == 0 {
@@ -800,45 +614,47 @@ func extractNumber(s string) (string, error) {
 }
 
 // DetermineBetType determines the bet type based on the odds
-func DetermineBetType(odds string) string {
-	// Split the odds string by "/"
-	parts := strings.Split(odds, "/")
-	if len(parts) == 2 {
-		numerator, _ := strconv.Atoi(parts[0])
-		denominator, _ := strconv.Atoi(parts[1])
-
-		// Check for BetType based on the odds
-		if float64(numerator)/float64(denominator) < 1.0 {
-			return "win bet"
-		} else if float64(numerator)/float64(denominator) > 4.0 {
-			return "place bet"
-		}
+func DetermineBetType(price string) string {
+	o, err := odds.Parse(price)
+	if err != nil {
+		return ""
+	}
+
+	// Check for BetType based on the odds
+	if o.ToOne() < 1.0 {
+		return "win bet"
+	} else if o.ToOne() > 4.0 {
+		return "place bet"
 	}
 	// Default to an empty BetType if criteria are not met
 	return ""
 }
 
-// CalculatePotentialReturn calculates the potential return based on BetType and odds
-func CalculatePotentialReturn(betType string, odds string, amount float64) float64 {
-	// Split the odds string by "/"
-	parts := strings.Split(odds, "/")
-	if len(parts) == 2 {
-		numerator, _ := strconv.ParseFloat(parts[0], 64)
-		denominator, _ := strconv.ParseFloat(parts[1], 64)
-
-		// Calculate potential return for "win bet" or "place bet"
-		if betType == "win bet" {
-			oddsMultiplier := (numerator / denominator)
-			return amount * oddsMultiplier
-		}
-		if betType == "place bet" {
-			oddsMultiplier := (numerator / denominator)
-			return amount * oddsMultiplier
-		}
+// analysisBetType returns how a selection declared at price is backed: each
+// way for a "place bet", to win otherwise
+func analysisBetType(price string) string {
+	if DetermineBetType(price) == "place bet" {
+		return models.BetTypeEachWay
+	}
+	return models.BetTypeWin
+}
 
+// CalculatePotentialReturn calculates the return, stake included, of amount
+// on a selection finishing position at price. A "place bet" is each way,
+// amount on each part, on the standard place terms of the race.
+func CalculatePotentialReturn(betType, price, position string, handicap bool, amount float64) float64 {
+	var result models.Settlement
+	var err error
+	if betType == "place bet" {
+		placing, _ := settlement.ParsePlacing(position)
+		result, err = settlement.EachWay(amount, price, position, settlement.StandardPlaceTerms(placing.Runners, handicap))
+	} else {
+		result, err = settlement.Win(amount, price, position)
+	}
+	if err != nil {
+		return 0
 	}
-	// Default potential return is 0
-	return 0
+	return result.GrossReturn
 }
 
 // AddBetTypeAndReturnsToSelections processes the input map and adds BetType, SelectionPosition, and PotentialReturn fields
@@ -848,17 +664,13 @@ func AddBetTypeAndReturnsToSelections(selectionsMap map[string][]models.Selectio
 			// Determine the BetType for each selection
 			selections[i].BetType = DetermineBetType(selections[i].Odds)
 
+			// Settled on the whole position line, before it is cut to the position
+			selections[i].PotentialReturn = CalculatePotentialReturn(selections[i].BetType, selections[i].Odds,
+				selections[i].SelectionPosition, settlement.IsHandicap(selections[i].RaceType), amount)
+
 			if strings.Contains(selections[i].SelectionPosition, "/") {
 				selections[i].SelectionPosition = strings.Split(selections[i].SelectionPosition, "/")[0]
 			}
-
-			// Calculate the PotentialReturn only if SelectionPosition is 1
-			if selections[i].SelectionPosition == "1" {
-				selections[i].PotentialReturn = CalculatePotentialReturn(selections[i].BetType, selections[i].Odds, amount)
-			} else {
-				selections[i].PotentialReturn = 0 // No potential return if position is not 1
-			}
-
 		}
 
 		// Update the selections in the map
@@ -867,55 +679,6 @@ func AddBetTypeAndReturnsToSelections(selectionsMap map[string][]models.Selectio
 	return selectionsMap
 }
 
-// Function to get the selection with the least number of runs
-func getSelectionWithLeastRuns(db *sql.DB, eventName, eventTime, eventDate string) ([]Selection, error) {
-	// SQL query to find the selection ID with the least number of runs
-
-	var selections []Selection
-	rows, err := db.Query(`
-					SELECT 
-						SelectionsForm.selection_id,
-						EventRunners.selection_name,
-						EventRunners.event_date,
-						COUNT(*) AS number_of_runs
-					FROM 
-						Forms 
-						INNER JOIN EventRunners ON SelectionsForm.selection_id = EventRunners.selection_id
-						WHERE SelectionsForm.racecourse = ? and EventRunners.event_time = ? and DATE(EventRunners.event_date) = ?
-					GROUP BY 
-						SelectionsForm.selection_id
-						Order by number_of_runs`, eventName, eventTime, eventDate)
-
-	if err != nil {
-		return []Selection{}, err
-	}
-	defer rows.Close()
-
-	var selection Selection
-
-	// Get the result
-	if rows.Next() {
-		err := rows.Scan(
-			&selection.ID,
-			&selection.Name,
-			&selection.EventDate,
-			&selection.NumberOfRuns,
-		)
-		if err != nil {
-			return []Selection{}, err
-		}
-		selections = append(selections, selection)
-	}
-
-	// Check for any error encountered during iteration
-	if err := rows.Err(); err != nil {
-		return []Selection{}, err
-	}
-
-	// Return the selection ID and number of runs
-	return selections, nil
-}
-
 func getTopScoreByTime(sortedResults []models.SelectionResult) map[string][]models.SelectionResult {
 	// Create a map to store the top score by EventTime
 	topScores := make(map[string][]models.SelectionResult)
@@ -1003,12 +766,13 @@ func preferredDistance(performances, distances, dates string) float64 {
 		distanceCount[distanceList[i]]++
 	}
 
-	// Determine the preferred distance with the lowest average score
+	// Determine the preferred distance with the lowest average score, on a
+	// tie the distance run first wins
 	var preferredDistance string
 	lowestAverageScore := float64(1e9) // Initialize with a very high value
 
-	for distance, totalScore := range distanceScores {
-		if distanceCount[distance] > 0 {
+	for _, distance := range distanceList {
+		if totalScore, ok := distanceScores[distance]; ok && distanceCount[distance] > 0 {
 			averageScore := totalScore / float64(distanceCount[distance])
 			if averageScore < lowestAverageScore {
 				lowestAverageScore = averageScore
@@ -1079,109 +843,25 @@ func Contains[T comparable](slice []T, element T) bool {
 	return false
 }
 
-func insertAnalysis(db *sql.DB, data models.AnalysisData, eventDate string) error {
-
-	// Prepare the INSERT statement
-	stmt, err := db.Prepare(`
-		INSERT INTO Analysis (
-					event_link,
-					selection_link,
-					event_date, race_date, selection_id,
-					selection_name, odds, age,
-					clean_bet_score, average_position,
-					average_rating, event_name,
-					event_time, selection_position, num_runners, number_runs, prefered_distance, current_distance)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`)
-	if err != nil {
-		return err
+// saveAnalysis saves the analysis of a selection with its declared price,
+// selections without form are skipped
+func saveAnalysis(ctx context.Context, st *store.Store, data models.AnalysisData, eventDate string) error {
+	if data.RaceDate == "" {
+		return nil
 	}
-	defer stmt.Close()
 
-	if data.RaceDate != "" {
-		raceDate := string(data.RaceDate)[:10]
-
-		ageStr := strings.Split(data.Age, " ")[0]
-		ageInt, _ := strconv.Atoi(ageStr)
-		numberOfRuns := strings.Split(data.AllCources, ",")
-
-		numRunners := strings.Split(data.NumberOfRunners, " ")[0]
-		intNumRunners, _ := strconv.Atoi(numRunners)
-
-		price, err := selectionOdds(db, eventDate, data.SelectionID)
-
-		if err != nil {
-			return err
-		}
-
-		// Execute the INSERT statement
-		_, err = stmt.Exec(
-			data.EventLink,
-			data.SelecionLink,
-			eventDate,
-			raceDate,
-			data.SelectionID,
-			data.SelectionName,
-			price,
-			ageInt,
-			math.Round(data.TotalScore*1000)/1000,
-			data.AvgPosition,
-			math.Round(data.AvgRating*1000)/1000,
-			data.EventName,
-			data.EventTime,
-			data.Position,
-			intNumRunners,
-			len(numberOfRuns),
-			math.Round(data.PreferedDistance*1000)/1000,
-			math.Round(data.CurrentDistance*1000)/1000,
-		)
-		if err != nil {
-			return err
-		}
-	}
-
-	// Return nil if no error occurred
-	return nil
-}
-func deleteAnalysis(db *sql.DB, eventDate string, selectionId int) error {
-	// Check if a record with the same event_date and selection_id exists
-	var exists bool
-	err := db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM Analysis
-			WHERE DATE(event_date) = ? and selection_id = ?
-		)
-	`, eventDate, selectionId).Scan(&exists)
+	price, err := st.Meetings.Price(ctx, eventDate, data.SelectionID)
 	if err != nil {
 		return err
 	}
 
-	// If a record exists, delete it
-	if exists {
-		_, err = db.Exec(`
-			DELETE FROM Analysis
-			WHERE DATE(event_date) = ? and selection_id = ?
-		`, eventDate, selectionId)
-		if err != nil {
-			return err
-		}
+	// An each-way bet stakes on both the win and the place
+	data.BetType = analysisBetType(price)
+	if data.BetType == models.BetTypeEachWay {
+		data.Stake *= 2
 	}
 
-	// Return nil if no error occurred
-	return nil
-}
-
-func selectionOdds(db *sql.DB, eventDate string, selectionId int) (string, error) {
-	// Check if a record with the same event_date and selection_id exists
-	var price string
-	err := db.QueryRow(`
-	SELECT price  FROM Meetings where DATE(event_date) = ? and selection_id = ?`, eventDate, selectionId).Scan(&price)
-	if err != nil {
-		return "", err
-	}
-
-	// Return nil if no error occurred
-	return price, nil
+	return st.Analysis.Upsert(ctx, eventDate, price, data)
 }
 
 // Parse the position string (e.g., "5/9") to get the finishing position
@@ -1216,109 +896,94 @@ func calculateAveragePosition(positions string) float64 {
 	return 0.0
 }
 
-// Score based on last race positions
-func scoreLastRunPositions(averagePosition float64) float64 {
-	// Example scoring based on average position:
-	// Lower positions (better finishes) get higher scores
-	if averagePosition <= 1.5 {
-		return 10
-	} else if averagePosition <= 3 {
-		return 8
-	} else if averagePosition <= 5 {
-		return 6
-	} else {
-		return 3
-	}
+// Score based on last race positions, lower positions (better finishes) get
+// higher scores
+func (p *ScoringProfile) scoreLastRunPositions(averagePosition float64) float64 {
+	return p.lastRunPositions.atMost(averagePosition)
 }
 
-// Score based on days since last run
-func scoreDaysSinceLastRun(days int) float64 {
-	// Ideal rest time is between 10 and 21 days
-	if days < 10 {
-		return 3 // too soon
-	} else if days <= 21 {
-		return 10 // ideal range
-	} else if days <= 35 {
-		return 7 // still good
-	} else {
-		return 4 // long break, might be under-prepared
-	}
+// Score based on days since last run, the default profile favours a rest of
+// 10 to 21 days
+func (p *ScoringProfile) scoreDaysSinceLastRun(days int) float64 {
+	return p.daysSinceLastRun.atMost(float64(days))
 }
 
 // Score based on distance suitability
-func scoreDistanceSuitability(currentDistance, preferredDistance float64) float64 {
+func (p *ScoringProfile) scoreDistanceSuitability(currentDistance, preferredDistance float64) float64 {
 	// If the current race distance matches the preferred distance, give a higher score
 	if currentDistance == preferredDistance {
-		return 15
+		return p.sameDistance
 	} else if currentDistance < preferredDistance {
-		return 10 // slightly shorter distance
+		return p.shorterDistance // slightly shorter distance
 	} else {
-		return 5 // longer distance
+		return p.longerDistance // longer distance
 	}
 }
 
-// Score based on race class
-func scoreRaceClass(eventClass int) float64 {
-	switch eventClass {
-	case 1:
-		return 10
-	case 2:
-		return 8
-	case 3:
-		return 7
-	case 4:
-		return 6
-	default:
-		return 4
+// Score based on race class, unknown classes (0) score otherwise
+func (p *ScoringProfile) scoreRaceClass(eventClass int) float64 {
+	if eventClass <= 0 {
+		return p.raceClass.otherwise
 	}
+	return p.raceClass.atMost(float64(eventClass))
 }
 
-// Score based on win count
-func scoreWinCount(winCount int, previousRuns int) float64 {
-	// Higher win percentage should get more points
-	if previousRuns == 0 {
-		return 0 // no history
-	}
-
-	winRate := float64(winCount) / float64(previousRuns)
-	if winRate >= 0.5 {
-		return 10
-	} else if winRate >= 0.25 {
-		return 7
-	} else {
-		return 4
+// Score based on age, unknown ages (0) score otherwise
+func (p *ScoringProfile) scoreAge(age int) float64 {
+	if age <= 0 {
+		return p.age.otherwise
 	}
+	return p.age.atMost(float64(age))
 }
 
-// Score based on odds
-func scoreOdds(averageOdds float64) float64 {
-	// Lower odds suggest a higher likelihood of winning
-	if averageOdds < 3 {
-		return 9
-	} else if averageOdds < 5 {
-		return 7
-	} else if averageOdds < 10 {
-		return 5
-	} else {
-		return 3
+// Score based on win count, higher win percentage gets more points
+func (p *ScoringProfile) scoreWinCount(winCount int, previousRuns int) float64 {
+	if previousRuns == 0 {
+		return p.noRuns // no history
 	}
+	return p.winRate.atLeast(float64(winCount) / float64(previousRuns))
 }
 
-// Total score calculation based on all factors
-func calculateTotalScore(data models.AnalysisData) float64 {
-	totalScore := 0.0
+// Score based on odds, lower odds suggest a higher likelihood of winning
+func (p *ScoringProfile) scoreOdds(averageOdds float64) float64 {
+	return p.odds.below(averageOdds)
+}
 
-	// Calculate individual component scores
+// scoreComponents scores data on every component of the profile, each
+// weighted by the profile
+func (p *ScoringProfile) scoreComponents(data models.AnalysisData) []models.ComponentScore {
 	averagePosition := calculateAveragePosition(data.AllPositions)
-	totalScore += scoreLastRunPositions(averagePosition)
-	totalScore += scoreDaysSinceLastRun(data.RecoveryDays)
-	totalScore += scoreDistanceSuitability(data.CurrentDistance, data.PreferedDistance)
-	// totalScore += scoreRaceClass(data.EventClass)
-	totalScore += scoreWinCount(data.WinCount, data.NumRuns)
-	totalScore += scoreOdds(data.AvgOdds)
+	winRate := 0.0
+	if data.NumRuns > 0 {
+		winRate = float64(data.WinCount) / float64(data.NumRuns)
+	}
+	raceClass, _ := strconv.Atoi(classNumber.FindString(data.EventClass))
+	age, _ := strconv.Atoi(strings.Split(data.Age, " ")[0])
+
+	components := []models.ComponentScore{
+		{Component: componentLastRunPositions, Value: averagePosition, Points: p.scoreLastRunPositions(averagePosition)},
+		{Component: componentDaysSinceLastRun, Value: float64(data.RecoveryDays), Points: p.scoreDaysSinceLastRun(data.RecoveryDays)},
+		{Component: componentDistanceSuitability, Value: data.CurrentDistance - data.PreferedDistance, Points: p.scoreDistanceSuitability(data.CurrentDistance, data.PreferedDistance)},
+		{Component: componentWinCount, Value: winRate, Points: p.scoreWinCount(data.WinCount, data.NumRuns)},
+		{Component: componentOdds, Value: data.AvgOdds, Points: p.scoreOdds(data.AvgOdds)},
+		{Component: componentRaceClass, Value: float64(raceClass), Points: p.scoreRaceClass(raceClass)},
+		{Component: componentAge, Value: float64(age), Points: p.scoreAge(age)},
+	}
+	for i := range components {
+		components[i].Weight = p.weights[components[i].Component]
+		components[i].Score = components[i].Points * components[i].Weight
+	}
+	return components
+}
 
-	// Add any additional factors as needed
+// classNumber finds the class in "Class 4" as well as "4"
+var classNumber = regexp.MustCompile(`\d+`)
 
+// Total score calculation, the sum of the weighted component scores
+func calculateTotalScore(components []models.ComponentScore) float64 {
+	totalScore := 0.0
+	for _, component := range components {
+		totalScore += component.Score
+	}
 	return totalScore
 }
-
@@ -0,0 +1,136 @@
+package racing
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+)
+
+const testEventDate = "2024-10-05"
+
+// newTestStore returns a store over a race of three runners on
+// testEventDate: Alpha in form over the distance, Bravo out of form and
+// Charlie with no form at all
+func newTestStore() (*store.Store, *memoryAnalysis) {
+	race := models.Selection{EventName: "Ascot", EventDate: testEventDate, EventTime: "14:00", RaceDistance: "1m 2f", RaceClass: "Class 2"}
+	alpha, bravo, charlie := race, race, race
+	alpha.ID, alpha.Name, alpha.Odds = 1, "Alpha", "2/1"
+	bravo.ID, bravo.Name, bravo.Odds = 2, "Bravo", "8/1"
+	charlie.ID, charlie.Name, charlie.Odds = 3, "Charlie", "10/1"
+
+	forms := &memoryForms{
+		summaries: map[int]models.AnalysisData{
+			1: {SelectionID: 1, SelectionName: "Alpha", Age: "4", RaceDate: "2024-08-30", LastRunDate: "2024-09-20", NumRuns: 4, WinCount: 2,
+				AllPositions: "1/8, 2/10", AllDistances: "1m 2f, 1m 2f", AllRaceDates: "2024-09-20, 2024-08-30"},
+			2: {SelectionID: 2, SelectionName: "Bravo", Age: "5", RaceDate: "2024-07-10", LastRunDate: "2024-08-01 00:00:00+00:00", NumRuns: 5,
+				AllPositions: "6/9, 7/12", AllDistances: "1m, 1m", AllRaceDates: "2024-08-01, 2024-07-10"},
+		},
+		positions: map[int]map[string]string{
+			1: {testEventDate: "1/3"},
+		},
+	}
+	analyses := newMemoryAnalysis(
+		map[string][]models.ScoreConstant{models.DefaultScoringProfile: testProfile()},
+		map[string]string{"Ascot": "UK"},
+	)
+
+	return &store.Store{
+		Meetings: &memoryMeetings{selections: []models.Selection{alpha, bravo, charlie}},
+		Forms:    forms,
+		Analysis: analyses,
+	}, analyses
+}
+
+func TestRunAnalysis(t *testing.T) {
+	st, analyses := newTestStore()
+	cfg := config.Default()
+	params := models.RaceParameters{EventDate: testEventDate, Profile: models.DefaultScoringProfile, Seed: 42}
+
+	if err := RunAnalysis(context.Background(), st, cfg, params, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := analyses.analysed(testEventDate, models.DefaultScoringProfile)
+	if len(rows) != 2 {
+		t.Fatalf("saved %d selections, want Alpha and Bravo", len(rows))
+	}
+	if _, ok := rows[3]; ok {
+		t.Error("Charlie has no form but was saved")
+	}
+
+	alpha, bravo := rows[1], rows[2]
+	if alpha.CleanBetScore <= bravo.CleanBetScore {
+		t.Errorf("Alpha scored %g, not above Bravo's %g", alpha.CleanBetScore, bravo.CleanBetScore)
+	}
+	if total := alpha.WinProbability + bravo.WinProbability; math.Abs(total-1) > 1e-5 {
+		t.Errorf("win probabilities add up to %g, want 1", total)
+	}
+	if alpha.Seed != 42 || alpha.Profile != models.DefaultScoringProfile {
+		t.Errorf("Alpha saved with seed %d and profile %q", alpha.Seed, alpha.Profile)
+	}
+	if alpha.CurrentDistance != 10 || alpha.Odds != "2/1" {
+		t.Errorf("Alpha saved at %g furlongs and %s", alpha.CurrentDistance, alpha.Odds)
+	}
+
+	// Bravo at 8/1 is backed each way, the bet value on each part
+	if alpha.BetType != models.BetTypeWin || alpha.Stake != 10 {
+		t.Errorf("Alpha staked %g on %s, want 10 to win", alpha.Stake, alpha.BetType)
+	}
+	if bravo.BetType != models.BetTypeEachWay || bravo.Stake != 20 {
+		t.Errorf("Bravo staked %g on %s, want 20 each way", bravo.Stake, bravo.BetType)
+	}
+
+	// The same seed gives the same scores, and the stakes of the first run stay
+	cfg.BetValue = 5
+	if err := RunAnalysis(context.Background(), st, cfg, params, nil); err != nil {
+		t.Fatal(err)
+	}
+	again := analyses.analysed(testEventDate, models.DefaultScoringProfile)
+	for id, row := range rows {
+		if again[id].CleanBetScore != row.CleanBetScore {
+			t.Errorf("selection %d scored %g then %g", id, row.CleanBetScore, again[id].CleanBetScore)
+		}
+		if again[id].Stake != row.Stake {
+			t.Errorf("selection %d staked %g then %g", id, row.Stake, again[id].Stake)
+		}
+	}
+}
+
+func TestRunAnalysisUnknownProfile(t *testing.T) {
+	st, analyses := newTestStore()
+	params := models.RaceParameters{EventDate: testEventDate, Profile: "aggressive"}
+
+	err := RunAnalysis(context.Background(), st, config.Default(), params, nil)
+	if !errors.Is(err, store.ErrUnknownProfile) {
+		t.Fatalf("got %v, want %v", err, store.ErrUnknownProfile)
+	}
+	if len(analyses.rows) != 0 {
+		t.Errorf("saved %d selections for an unknown profile", len(analyses.rows))
+	}
+}
+
+// TestDoAnalysisRecoveryDays counts the days from the last run to the race
+func TestDoAnalysisRecoveryDays(t *testing.T) {
+	st, _ := newTestStore()
+	params := models.RaceParameters{EventDate: testEventDate}
+	selections, err := st.Meetings.Selections(context.Background(), testEventDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int]int{1: 15, 2: 65, 3: 0}
+	for _, selection := range selections {
+		data, err := doAnalysisAndSave(context.Background(), st.Forms, params, selection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.RecoveryDays != want[selection.ID] {
+			t.Errorf("%s: %d days since the last run, want %d", selection.Name, data.RecoveryDays, want[selection.ID])
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package racing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/jobs"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/settlement"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBacktestDays is the longest date range of a backtest run over the API,
+// the backtest command runs any range
+const maxBacktestDays = 366
+
+// backtestRunner is a runner of a past race with the form it had before the
+// race and how it finished
+type backtestRunner struct {
+	data     models.AnalysisData
+	position string
+	price    string // starting price, empty when not settled
+}
+
+// backtestRace is a past race and its runners with form
+type backtestRace struct {
+	date    string
+	course  string
+	region  string
+	time    string
+	runners []backtestRunner
+}
+
+// BacktestDefaults validates params and fills in the defaults of what they
+// leave out, the stake comes from the configuration
+func BacktestDefaults(params models.BacktestParameters, cfg *config.Config) (models.BacktestParameters, error) {
+	if params.To == "" {
+		params.To = params.From
+	}
+	from, err := time.Parse("2006-01-02", params.From)
+	if err != nil {
+		return params, fmt.Errorf("invalid from %q: %w", params.From, err)
+	}
+	to, err := time.Parse("2006-01-02", params.To)
+	if err != nil {
+		return params, fmt.Errorf("invalid to %q: %w", params.To, err)
+	}
+	if to.Before(from) {
+		return params, fmt.Errorf("to %s is before from %s", params.To, params.From)
+	}
+
+	if params.Profile == "" {
+		params.Profile = models.DefaultScoringProfile
+	}
+	if params.Picks == 0 {
+		params.Picks = 1
+	}
+	if params.Picks < 0 {
+		return params, fmt.Errorf("picks must be positive, got %d", params.Picks)
+	}
+
+	switch params.Staking {
+	case "", models.StakingLevel:
+		params.Staking = models.StakingLevel
+		if params.Stake == 0 {
+			params.Stake = float64(cfg.BetValue)
+		}
+		if params.Stake <= 0 {
+			return params, fmt.Errorf("stake must be positive, got %g", params.Stake)
+		}
+	case models.StakingPercentage:
+		if params.Percent <= 0 || params.Percent > 100 {
+			return params, fmt.Errorf("percent must be within (0, 100], got %g", params.Percent)
+		}
+		if params.Bank <= 0 {
+			return params, fmt.Errorf("bank must be positive, got %g", params.Bank)
+		}
+	default:
+		return params, fmt.Errorf("unknown staking %q, want %s or %s", params.Staking, models.StakingLevel, models.StakingPercentage)
+	}
+
+	return params, nil
+}
+
+// RunBacktest replays the scoring of params.Profile over every race day from
+// params.From to params.To, each runner scored only on the form lines it had
+// before the race and without score noise, backs the top picks of each race
+// with the staking rule of params and saves the result to Backtests.
+// Params must have gone through BacktestDefaults. Progress counts the race
+// days read.
+func RunBacktest(ctx context.Context, st *store.Store, params models.BacktestParameters, progress *jobs.Progress) (models.Backtest, error) {
+	profile, err := LoadScoringProfile(ctx, st.Analysis, params.Profile)
+	if err != nil {
+		return models.Backtest{}, err
+	}
+
+	races, err := loadBacktestRaces(ctx, st, params.From, params.To, progress)
+	if err != nil {
+		return models.Backtest{}, err
+	}
+
+	return st.Backtests.Save(ctx, simulateBacktest(races, profile, params))
+}
+
+// loadBacktestRaces reads the races run from from to to, their runners with
+// the form they had before the race and how they finished
+func loadBacktestRaces(ctx context.Context, st *store.Store, from, to string, progress *jobs.Progress) ([]backtestRace, error) {
+	first, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return nil, err
+	}
+	last, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return nil, err
+	}
+
+	countries, err := st.Meetings.Countries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	progress.SetTotal(backtestDays(first, last))
+
+	var races []backtestRace
+	for date := first; !date.After(last); date = date.AddDate(0, 0, 1) {
+		day := date.Format("2006-01-02")
+
+		selections, err := st.Meetings.Selections(ctx, day)
+		if err != nil {
+			return nil, err
+		}
+
+		byRace := make(map[string]*backtestRace)
+		var keys []string
+		for _, selection := range selections {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			data, err := doAnalysisAndSave(ctx, st.Forms, models.RaceParameters{EventDate: day}, selection)
+			if err != nil {
+				return nil, err
+			}
+			// Runners without form can not be scored
+			if data.RaceDate == "" {
+				continue
+			}
+
+			runner := backtestRunner{data: data}
+			position, price, err := st.Forms.Outcome(ctx, selection.ID, day)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+			case err != nil:
+				return nil, err
+			default:
+				runner.position, runner.price = position, price
+			}
+
+			key := selection.EventName + " " + selection.EventTime
+			race, ok := byRace[key]
+			if !ok {
+				race = &backtestRace{
+					date:   day,
+					course: selection.EventName,
+					region: countries[selection.EventName],
+					time:   selection.EventTime,
+				}
+				byRace[key] = race
+				keys = append(keys, key)
+			}
+			race.runners = append(race.runners, runner)
+		}
+
+		sort.Strings(keys)
+		for _, key := range keys {
+			races = append(races, *byRace[key])
+		}
+		progress.Done(1)
+	}
+
+	return races, nil
+}
+
+// simulateBacktest backs the top scored runners of each race in order and
+// measures the bets, settled to win at the starting price. Bets on
+// non-runners are void and not counted, runners without a result or a price
+// that reads are counted as unsettled.
+func simulateBacktest(races []backtestRace, profile *ScoringProfile, params models.BacktestParameters) models.Backtest {
+	result := models.Backtest{
+		Name:      params.Name,
+		Profile:   profile.Name,
+		From:      params.From,
+		To:        params.To,
+		Params:    params,
+		Races:     len(races),
+		PerCourse: make(map[string]models.BacktestPnL),
+		PerRegion: make(map[string]models.BacktestPnL),
+	}
+
+	losingRun := 0
+	// profit runs over the bets in order, high is its peak so far
+	var profit, high float64
+	for _, race := range races {
+		for _, pick := range backtestPicks(race, profile, params) {
+			stake := params.Stake
+			if params.Staking == models.StakingPercentage {
+				stake = (params.Bank + profit) * params.Percent / 100
+				if stake <= 0 {
+					continue
+				}
+			}
+
+			settled, err := settlement.Win(stake, pick.price, pick.position)
+			if err != nil {
+				result.Unsettled++
+				continue
+			}
+			if settled.Outcome == models.OutcomeVoid {
+				continue
+			}
+			won := settled.Outcome == models.OutcomeWon
+			returned := settled.GrossReturn
+
+			result.Bets++
+			result.Staked += stake
+			result.Returned += returned
+			profit += returned - stake
+			if won {
+				result.Winners++
+				losingRun = 0
+			} else {
+				losingRun++
+				result.LongestLosingRun = max(result.LongestLosingRun, losingRun)
+			}
+			high = max(high, profit)
+			result.MaxDrawdown = max(result.MaxDrawdown, high-profit)
+
+			region := race.region
+			if region == "" {
+				region = "Unknown"
+			}
+			result.PerCourse[race.course] = addBacktestBet(result.PerCourse[race.course], stake, returned, won)
+			result.PerRegion[region] = addBacktestBet(result.PerRegion[region], stake, returned, won)
+		}
+	}
+
+	result.Profit = roundMoney(profit)
+	result.Staked = roundMoney(result.Staked)
+	result.Returned = roundMoney(result.Returned)
+	result.MaxDrawdown = roundMoney(result.MaxDrawdown)
+	if result.Bets > 0 {
+		result.StrikeRate = math.Round(float64(result.Winners)/float64(result.Bets)*10000) / 10000
+	}
+	if result.Staked > 0 {
+		result.ROI = math.Round(result.Profit/result.Staked*10000) / 10000
+	}
+	for course, pnl := range result.PerCourse {
+		result.PerCourse[course] = finishBacktestPnL(pnl)
+	}
+	for region, pnl := range result.PerRegion {
+		result.PerRegion[region] = finishBacktestPnL(pnl)
+	}
+
+	return result
+}
+
+// backtestPicks returns the runners of a race backed by params: the
+// params.Picks top scored by profile, leaving out those scoring under
+// params.MinScore. Runners on the same score are taken in selection order.
+func backtestPicks(race backtestRace, profile *ScoringProfile, params models.BacktestParameters) []backtestRunner {
+	type scored struct {
+		runner backtestRunner
+		score  float64
+	}
+	runners := make([]scored, 0, len(race.runners))
+	for _, runner := range race.runners {
+		runners = append(runners, scored{runner, calculateTotalScore(profile.scoreComponents(runner.data))})
+	}
+	sort.SliceStable(runners, func(i, j int) bool {
+		if runners[i].score != runners[j].score {
+			return runners[i].score > runners[j].score
+		}
+		return runners[i].runner.data.SelectionID < runners[j].runner.data.SelectionID
+	})
+
+	var picks []backtestRunner
+	for i, pick := range runners {
+		if i >= params.Picks || pick.score < params.MinScore {
+			break
+		}
+		picks = append(picks, pick.runner)
+	}
+	return picks
+}
+
+func addBacktestBet(pnl models.BacktestPnL, stake, returned float64, won bool) models.BacktestPnL {
+	pnl.Bets++
+	if won {
+		pnl.Winners++
+	}
+	pnl.Staked += stake
+	pnl.Profit += returned - stake
+	return pnl
+}
+
+func finishBacktestPnL(pnl models.BacktestPnL) models.BacktestPnL {
+	pnl.Staked = roundMoney(pnl.Staked)
+	pnl.Profit = roundMoney(pnl.Profit)
+	if pnl.Staked > 0 {
+		pnl.ROI = math.Round(pnl.Profit/pnl.Staked*10000) / 10000
+	}
+	return pnl
+}
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// backtestDays returns the number of race days from first to last, both
+// included
+func backtestDays(first, last time.Time) int {
+	return int(last.Sub(first).Hours()/24) + 1
+}
+
+// PostBacktest godoc
+// @Summary Run a backtest
+// @Description Start a background job replaying the scoring of a profile over at most a year of past race days, backing the top picks of each race and storing the strike rate, ROI, drawdown and P&L per course and region. The job's progress is at /jobs/{id}, the backtest is listed by GET /backtests once it finishes.
+// @Tags backtests
+// @Accept  json
+// @Produce  json
+// @Param body body models.BacktestParameters true "Date range, profile and staking rule"
+// @Success 202 {object} models.Job "accepted"
+// @Router /backtests [post]
+func (h *Handler) PostBacktest(c *gin.Context) {
+	var params models.BacktestParameters
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params, err := BacktestDefaults(params, h.Config.Current())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// BacktestDefaults checked the dates
+	from, _ := time.Parse("2006-01-02", params.From)
+	to, _ := time.Parse("2006-01-02", params.To)
+	if days := backtestDays(from, to); days > maxBacktestDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a backtest covers at most %d days, got %d", maxBacktestDays, days)})
+		return
+	}
+
+	if _, err := LoadScoringProfile(c, h.Store.Analysis, params.Profile); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, store.ErrUnknownProfile) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.Jobs.Start("backtest", params, func(ctx context.Context, progress *jobs.Progress) error {
+		_, err := RunBacktest(ctx, h.Store, params, progress)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Backtest started", "job": job})
+}
+
+// GetBacktests godoc
+// @Summary List backtests
+// @Description List the stored backtests, newest first, to compare them
+// @Tags backtests
+// @Produce  json
+// @Param profile query string false "Only the backtests of this scoring profile"
+// @Param limit query int false "Number of backtests, 50 by default"
+// @Success 200 {object} object	"ok"
+// @Router /backtests [get]
+func (h *Handler) GetBacktests(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+
+	backtests, err := h.Store.Backtests.List(c, c.Query("profile"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"backtests": backtests})
+}
+
+// GetBacktest godoc
+// @Summary Get a backtest
+// @Tags backtests
+// @Produce  json
+// @Param id path int true "Backtest ID"
+// @Success 200 {object} models.Backtest "ok"
+// @Router /backtests/{id} [get]
+func (h *Handler) GetBacktest(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id must be an integer"})
+		return
+	}
+
+	backtest, err := h.Store.Backtests.Get(c, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "backtest not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"backtest": backtest})
+}
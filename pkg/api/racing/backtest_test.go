@@ -0,0 +1,51 @@
+package racing
+
+import (
+	"testing"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// TestSimulateBacktestSettlement settles the picks at their starting price:
+// a dead heat pays half, a non-runner is void and a runner without a result
+// is left unsettled
+func TestSimulateBacktestSettlement(t *testing.T) {
+	profile, err := NewScoringProfile(models.DefaultScoringProfile, testProfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	race := func(course, position, price string) backtestRace {
+		return backtestRace{
+			date:   testEventDate,
+			course: course,
+			region: "UK",
+			time:   "14:00",
+			runners: []backtestRunner{{
+				data:     models.AnalysisData{SelectionID: 1, NumRuns: 1, AllPositions: "1/8"},
+				position: position,
+				price:    price,
+			}},
+		}
+	}
+	races := []backtestRace{
+		race("Ascot", "DH1/8", "4/1"),
+		race("York", "NR", "5/1"),
+		race("Newbury", "", ""),
+		race("Kempton", "2/8", "3/1"),
+	}
+	params := models.BacktestParameters{From: testEventDate, To: testEventDate, Picks: 1, Staking: models.StakingLevel, Stake: 10}
+
+	result := simulateBacktest(races, profile, params)
+	if result.Bets != 2 || result.Winners != 1 || result.Unsettled != 1 {
+		t.Fatalf("got %d bets, %d winners and %d unsettled, want the dead heat and the loser settled and Newbury unsettled",
+			result.Bets, result.Winners, result.Unsettled)
+	}
+	// Half of 10 at 4/1 back on the dead heat
+	if result.Staked != 20 || result.Returned != 25 || result.Profit != 5 {
+		t.Errorf("staked %g, returned %g for a profit of %g, want 20, 25 and 5", result.Staked, result.Returned, result.Profit)
+	}
+	if _, ok := result.PerCourse["York"]; ok {
+		t.Error("the void bet on the York non-runner was counted")
+	}
+}
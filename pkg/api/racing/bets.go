@@ -0,0 +1,377 @@
+package racing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/odds"
+	"github.com/mmanjoura/clean-bet-backend/pkg/settlement"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// betStatuses are the statuses GET /bets filters on
+var betStatuses = map[string]bool{
+	models.BetStatusOpen: true,
+	models.OutcomeWon:    true,
+	models.OutcomePlaced: true,
+	models.OutcomeLost:   true,
+	models.OutcomeVoid:   true,
+}
+
+// NewBet validates a bet request on an analysed selection and returns the
+// bet to store, at the declared price of the analysis when request has none.
+// The each-way terms default to the standard terms of a non-handicap for the
+// declared field of runners.
+func NewBet(request models.BetRequest, selection models.EventPrediction, runners int) (models.Bet, error) {
+	bet := models.Bet{
+		SelectionID:   selection.SelectionID,
+		SelectionName: selection.SelectionName,
+		EventName:     selection.EventName,
+		EventDate:     request.EventDate,
+		EventTime:     selection.EventTime,
+		BetType:       request.BetType,
+		Stake:         roundMoney(request.Stake),
+		Price:         odds.Clean(request.Price),
+		PlaceTerms:    request.PlaceTerms,
+	}
+	if bet.Stake <= 0 {
+		return bet, fmt.Errorf("stake must be positive, got %g", request.Stake)
+	}
+	if bet.Price == "" {
+		bet.Price = odds.Clean(selection.Odds)
+	}
+	if _, err := odds.Parse(bet.Price); err != nil {
+		return bet, fmt.Errorf("price %q can not be backed: %w", bet.Price, err)
+	}
+
+	switch bet.BetType {
+	case "", models.BetTypeWin:
+		bet.BetType = models.BetTypeWin
+		bet.PlaceTerms = nil
+	case models.BetTypeEachWay:
+		bet.Stake *= 2
+		if bet.PlaceTerms == nil {
+			terms := settlement.StandardPlaceTerms(runners, false)
+			bet.PlaceTerms = &terms
+		}
+		if bet.PlaceTerms.Places < 1 || bet.PlaceTerms.Fraction < 1 {
+			return bet, errors.New("place terms need at least 1 place at a fraction of at least 1")
+		}
+	default:
+		return bet, fmt.Errorf("unknown bet_type %q, want %s or %s", bet.BetType, models.BetTypeWin, models.BetTypeEachWay)
+	}
+
+	return bet, nil
+}
+
+// SettleBets settles the open bets of a user run up to date, of every user
+// when userID is 0, at the price they were taken on the result of their
+// runner. Bets whose result is not known yet are left open.
+func SettleBets(ctx context.Context, st *store.Store, userID int, date string) error {
+	bets, err := st.Bets.Open(ctx, userID, date)
+	if err != nil {
+		return err
+	}
+
+	for _, bet := range bets {
+		position, _, err := st.Forms.Outcome(ctx, bet.SelectionID, bet.EventDate)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var result models.Settlement
+		if bet.BetType == models.BetTypeEachWay && bet.PlaceTerms != nil {
+			result, err = settlement.EachWay(bet.Stake/2, bet.Price, position, *bet.PlaceTerms)
+		} else {
+			result, err = settlement.Win(bet.Stake, bet.Price, position)
+		}
+		if errors.Is(err, settlement.ErrUnsettled) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Bet %d left open: %v", bet.ID, err)
+			continue
+		}
+
+		bet.Status = result.Outcome
+		bet.Position = position
+		bet.GrossReturn = &result.GrossReturn
+		bet.NetProfit = &result.NetProfit
+		if err := st.Bets.Settle(ctx, bet); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BankrollSeries follows a bank through the settled bets, race day by race
+// day: the balance, ROI and drawdown of each point are those at the end of
+// its day. Void bets returned their stake and count neither as bets nor as
+// staked.
+func BankrollSeries(bank float64, bets []models.Bet) models.Bankroll {
+	bankroll := models.Bankroll{Bank: bank, Series: []models.BankrollPoint{}}
+
+	for _, bet := range bets {
+		if bet.Status == models.BetStatusOpen {
+			bankroll.Open += bet.Stake
+			continue
+		}
+		if bet.Status == models.OutcomeVoid || bet.GrossReturn == nil || bet.NetProfit == nil {
+			continue
+		}
+
+		if n := len(bankroll.Series); n == 0 || bankroll.Series[n-1].Date != bet.EventDate {
+			bankroll.Series = append(bankroll.Series, models.BankrollPoint{Date: bet.EventDate})
+		}
+		point := &bankroll.Series[len(bankroll.Series)-1]
+		point.Bets++
+		point.Staked += bet.Stake
+		point.Returned += *bet.GrossReturn
+		point.Profit += *bet.NetProfit
+	}
+
+	high := bank
+	for i := range bankroll.Series {
+		point := &bankroll.Series[i]
+		bankroll.Bets += point.Bets
+		bankroll.Staked += point.Staked
+		bankroll.Returned += point.Returned
+		bankroll.Profit += point.Profit
+
+		balance := bank + bankroll.Profit
+		high = max(high, balance)
+		point.Staked = roundMoney(point.Staked)
+		point.Returned = roundMoney(point.Returned)
+		point.Profit = roundMoney(point.Profit)
+		point.Balance = roundMoney(balance)
+		point.Drawdown = roundMoney(high - balance)
+		if bankroll.Staked > 0 {
+			point.ROI = math.Round(bankroll.Profit/bankroll.Staked*10000) / 10000
+		}
+		bankroll.MaxDrawdown = max(bankroll.MaxDrawdown, point.Drawdown)
+	}
+
+	bankroll.Staked = roundMoney(bankroll.Staked)
+	bankroll.Returned = roundMoney(bankroll.Returned)
+	bankroll.Profit = roundMoney(bankroll.Profit)
+	bankroll.Balance = roundMoney(bank + bankroll.Profit)
+	bankroll.Open = roundMoney(bankroll.Open)
+	if bankroll.Staked > 0 {
+		bankroll.ROI = math.Round(bankroll.Profit/bankroll.Staked*10000) / 10000
+	}
+
+	return bankroll
+}
+
+// declaredRunners returns the number of runners declared in the race of an
+// analysed selection, the number it was analysed with when the meeting lists
+// none
+func (h *Handler) declaredRunners(ctx context.Context, eventDate string, selection models.EventPrediction) (int, error) {
+	runners, err := h.Store.Meetings.Runners(ctx, eventDate)
+	if err != nil {
+		return 0, err
+	}
+	declared := 0
+	for _, runner := range runners {
+		if runner.EventName == selection.EventName && runner.EventTime == selection.EventTime {
+			declared++
+		}
+	}
+	if declared == 0 {
+		declared, _ = strconv.Atoi(selection.NumRunners)
+	}
+	return declared, nil
+}
+
+// currentUser returns the user JWTAuth authenticated the request for
+func currentUser(c *gin.Context) (models.User, bool) {
+	value, _ := c.Get("user")
+	user, ok := value.(models.User)
+	return user, ok
+}
+
+// betWindow reads the optional from and to dates of a request
+func betWindow(c *gin.Context) (string, string, error) {
+	const layout = "2006-01-02"
+
+	from, to := c.Query("from"), c.Query("to")
+	if _, err := time.Parse(layout, from); from != "" && err != nil {
+		return from, to, errors.New("from must be YYYY-MM-DD")
+	}
+	if _, err := time.Parse(layout, to); to != "" && err != nil {
+		return from, to, errors.New("to must be YYYY-MM-DD")
+	}
+	return from, to, nil
+}
+
+// PostBet godoc
+// @Summary Record a bet
+// @Description Record a bet the user placed on a selection analysed for the event date, at the price taken or else the declared price
+// @Tags bets
+// @Accept  json
+// @Produce  json
+// @Param body body models.BetRequest true "Selection, stake, price and bet type"
+// @Success 201 {object} models.Bet "created"
+// @Router /bets [post]
+func (h *Handler) PostBet(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request models.BetRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := time.Parse("2006-01-02", request.EventDate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "event_date must be YYYY-MM-DD"})
+		return
+	}
+
+	selection, err := h.Store.Analysis.Selection(c, request.EventDate, request.SelectionID, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if selection.SelectionID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("selection %d was not analysed for %s", request.SelectionID, request.EventDate)})
+		return
+	}
+
+	runners, err := h.declaredRunners(c, request.EventDate, selection)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	bet, err := NewBet(request, selection, runners)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	bet.UserID = user.ID
+
+	bet, err = h.Store.Bets.Create(c, bet)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"bet": bet})
+}
+
+// GetBets godoc
+// @Summary List the user's bets
+// @Description List the bets of the user in the order they were run, as last settled by the results stage or POST /bets/settle
+// @Tags bets
+// @Produce  json
+// @Param from query string false "First event date"
+// @Param to query string false "Last event date"
+// @Param status query string false "open, won, placed, lost or void"
+// @Success 200 {array} models.Bet "ok"
+// @Router /bets [get]
+func (h *Handler) GetBets(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	from, to, err := betWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	status := c.Query("status")
+	if status != "" && !betStatuses[status] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown status %q", status)})
+		return
+	}
+
+	bets, err := h.Store.Bets.List(c, user.ID, from, to, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bets": bets})
+}
+
+// PostSettleBets godoc
+// @Summary Settle the user's bets
+// @Description Settle the open bets of the user whose result is known, at the price they were taken; the results stage of the pipeline settles every user's bets of its day
+// @Tags bets
+// @Produce  json
+// @Success 200 {array} models.Bet "ok"
+// @Router /bets/settle [post]
+func (h *Handler) PostSettleBets(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := SettleBets(c, h.Store, user.ID, time.Now().Format("2006-01-02")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	bets, err := h.Store.Bets.List(c, user.ID, "", "", "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bets": bets})
+}
+
+// GetBankroll godoc
+// @Summary The user's bankroll
+// @Description Follow a starting bank through the settled bets of the user, race day by race day, with its running balance, ROI and drawdown
+// @Tags bets
+// @Produce  json
+// @Param bank query number false "Starting bank, 0 by default"
+// @Param from query string false "First event date"
+// @Param to query string false "Last event date"
+// @Success 200 {object} models.Bankroll "ok"
+// @Router /bankroll [get]
+func (h *Handler) GetBankroll(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	from, to, err := betWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	bank, err := strconv.ParseFloat(c.DefaultQuery("bank", "0"), 64)
+	if err != nil || math.IsNaN(bank) || math.IsInf(bank, 0) || bank < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bank must be a number of at least 0"})
+		return
+	}
+
+	bets, err := h.Store.Bets.List(c, user.ID, from, to, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bankroll": BankrollSeries(bank, bets)})
+}
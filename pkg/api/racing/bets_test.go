@@ -0,0 +1,60 @@
+package racing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// TestBetsReadOnly reads the bets and bankroll of a user without settling
+// them, only POST /bets/settle does
+func TestBetsReadOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	st, _ := newTestStore()
+	st.Forms.(*memoryForms).positions = map[int]map[string]string{1: {testEventDate: "1/3"}}
+	bets := &memoryBets{bets: []models.Bet{{
+		ID: 1, UserID: 7, SelectionID: 1, SelectionName: "Alpha", EventDate: testEventDate,
+		BetType: models.BetTypeWin, Stake: 10, Price: "3/1", Status: models.BetStatusOpen,
+	}}}
+	st.Bets = bets
+
+	h := NewHandler(st, config.NewManager("", config.Default()), nil, nil)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user", models.User{ID: 7}) })
+	r.GET("/bets", h.GetBets)
+	r.GET("/bankroll", h.GetBankroll)
+	r.POST("/bets/settle", h.PostSettleBets)
+
+	for _, path := range []string{"/bets", "/bankroll?bank=100"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: got status %d", path, w.Code)
+		}
+		if bets.settled != 0 || bets.bets[0].Status != models.BetStatusOpen {
+			t.Fatalf("GET %s settled the bet", path)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/bets/settle", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	var response struct {
+		Bets []models.Bet `json:"bets"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	// 10 on Alpha winning at 3/1
+	if len(response.Bets) != 1 || response.Bets[0].Status != models.OutcomeWon || *response.Bets[0].NetProfit != 30 {
+		t.Errorf("got %+v, want the bet on Alpha won for 30", response.Bets)
+	}
+}
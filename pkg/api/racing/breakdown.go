@@ -0,0 +1,51 @@
+package racing
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAnalysisBreakdown godoc
+// @Summary Explain the score of a runner
+// @Description Get the component scores of an analysed runner: the value each was scored on, the points of its band and the weight of the profile
+// @Tags racing
+// @Produce  json
+// @Param selection_id path int true "Selection ID"
+// @Param date query string false "Event date, the latest analysed when empty"
+// @Param profile query string false "Scoring profile, default when empty"
+// @Success 200 {object} models.AnalysisBreakdown "ok"
+// @Router /racing/analysis/{selection_id}/breakdown [get]
+func (h *Handler) GetAnalysisBreakdown(c *gin.Context) {
+	selectionID, err := strconv.Atoi(c.Param("selection_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "selection_id must be an integer"})
+		return
+	}
+
+	eventDate := c.Query("date")
+	if eventDate != "" {
+		if _, err := time.Parse("2006-01-02", eventDate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+			return
+		}
+	}
+
+	breakdown, err := h.Store.Analysis.Breakdown(c, selectionID, eventDate, c.DefaultQuery("profile", models.DefaultScoringProfile))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "selection was not analysed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"breakdown": breakdown})
+}
@@ -0,0 +1,177 @@
+package racing
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// calibrationRace is a settled race, the scores and results of its analysed
+// runners
+type calibrationRace struct {
+	scores []float64
+	won    []bool
+}
+
+// Calibrate measures the win probabilities of settled runners against their
+// results, in buckets of equal width. Brier score and log loss are averaged
+// over the runners, each a win or not.
+func Calibrate(runners []models.EventPrediction, buckets int, scale float64) models.CalibrationReport {
+	report := models.CalibrationReport{
+		Scale:   scale,
+		Buckets: make([]models.CalibrationBucket, buckets),
+	}
+	for i := range report.Buckets {
+		report.Buckets[i].Lower = float64(i) / float64(buckets)
+		report.Buckets[i].Upper = float64(i+1) / float64(buckets)
+	}
+
+	var races []calibrationRace
+	var raceKey string
+	for _, runner := range runners {
+		key := runner.EventDate + " " + runner.EventName + " " + runner.EventTime
+		if key != raceKey || len(races) == 0 {
+			races = append(races, calibrationRace{})
+			raceKey = key
+		}
+		race := &races[len(races)-1]
+
+		won := strings.Split(runner.CurrentEventPosition, "/")[0] == "1"
+		probability := runner.WinProbability
+		race.scores = append(race.scores, runner.CleanBetScore)
+		race.won = append(race.won, won)
+
+		outcome := 0.0
+		if won {
+			outcome = 1
+			report.Winners++
+		}
+		report.Runners++
+		report.BrierScore += (probability - outcome) * (probability - outcome)
+		// Keep log finite for the probabilities of 0 and 1
+		clamped := math.Min(math.Max(probability, 1e-15), 1-1e-15)
+		report.LogLoss -= outcome*math.Log(clamped) + (1-outcome)*math.Log(1-clamped)
+
+		bucket := &report.Buckets[min(int(probability*float64(buckets)), buckets-1)]
+		bucket.Runners++
+		bucket.MeanProbability += probability
+		if won {
+			bucket.Winners++
+		}
+	}
+	report.Races = len(races)
+
+	if report.Runners > 0 {
+		report.BrierScore = math.Round(report.BrierScore/float64(report.Runners)*1e6) / 1e6
+		report.LogLoss = math.Round(report.LogLoss/float64(report.Runners)*1e6) / 1e6
+	}
+	for i := range report.Buckets {
+		bucket := &report.Buckets[i]
+		if bucket.Runners > 0 {
+			bucket.MeanProbability = math.Round(bucket.MeanProbability/float64(bucket.Runners)*1e4) / 1e4
+			bucket.WinRate = math.Round(float64(bucket.Winners)/float64(bucket.Runners)*1e4) / 1e4
+		}
+	}
+	report.FittedScale = fitWinProbabilityScale(races, scale)
+
+	return report
+}
+
+// fitWinProbabilityScale finds by Newton's method the scale of the
+// conditional logit of the scores most likely to give the winners of races,
+// starting from scale. Races without a single winner among the analysed
+// runners say nothing of it. Nil is returned when the scale does not
+// converge, as when the top scores always win or always lose.
+func fitWinProbabilityScale(races []calibrationRace, scale float64) *float64 {
+	for iteration := 0; iteration < 100; iteration++ {
+		// Gradient and curvature of the log likelihood
+		var gradient, curvature float64
+		for _, race := range races {
+			winner, winners := 0, 0
+			for i, won := range race.won {
+				if won {
+					winner = i
+					winners++
+				}
+			}
+			if winners != 1 {
+				continue
+			}
+
+			probabilities := winProbabilities(race.scores, scale)
+			var mean, square float64
+			for i, score := range race.scores {
+				mean += probabilities[i] * score
+				square += probabilities[i] * score * score
+			}
+			gradient += race.scores[winner] - mean
+			curvature += square - mean*mean
+		}
+		if curvature < 1e-9 {
+			return nil
+		}
+
+		step := gradient / curvature
+		scale += step
+		if math.Abs(scale) > 1e3 {
+			return nil
+		}
+		if math.Abs(step) < 1e-6 {
+			fitted := math.Round(scale*1e4) / 1e4
+			return &fitted
+		}
+	}
+	return nil
+}
+
+// GetCalibration godoc
+// @Summary Calibration of the win probabilities
+// @Description Compare the win probabilities of settled runners with their results: reliability buckets, Brier score, log loss and the best fitting win_probability_scale
+// @Tags racing
+// @Produce  json
+// @Param from query string false "First event date, 30 days before to by default"
+// @Param to query string false "Last event date, today by default"
+// @Param profile query string false "Scoring profile, default when empty"
+// @Param buckets query int false "Number of reliability buckets, 10 by default"
+// @Success 200 {object} models.CalibrationReport "ok"
+// @Router /racing/calibration [get]
+func (h *Handler) GetCalibration(c *gin.Context) {
+	const layout = "2006-01-02"
+
+	to := c.DefaultQuery("to", time.Now().Format(layout))
+	last, err := time.Parse(layout, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be YYYY-MM-DD"})
+		return
+	}
+	from := c.DefaultQuery("from", last.AddDate(0, 0, -30).Format(layout))
+	if _, err := time.Parse(layout, from); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be YYYY-MM-DD"})
+		return
+	}
+	buckets, err := strconv.Atoi(c.DefaultQuery("buckets", "10"))
+	if err != nil || buckets <= 0 || buckets > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "buckets must be an integer within [1, 100]"})
+		return
+	}
+	profile := c.DefaultQuery("profile", models.DefaultScoringProfile)
+
+	runners, err := h.Store.Analysis.Settled(c, from, to, profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	report := Calibrate(runners, buckets, h.Config.Current().WinProbabilityScale)
+	report.Profile = profile
+	report.From = from
+	report.To = to
+
+	c.JSON(http.StatusOK, gin.H{"calibration": report})
+}
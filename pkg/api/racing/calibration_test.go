@@ -0,0 +1,198 @@
+package racing
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// settledRunner is a runner of the race at time finishing in position
+func settledRunner(time string, score, probability float64, position string) models.EventPrediction {
+	return models.EventPrediction{
+		EventDate:            testEventDate,
+		EventName:            "Ascot",
+		EventTime:            time,
+		CleanBetScore:        score,
+		WinProbability:       probability,
+		CurrentEventPosition: position,
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	runners := []models.EventPrediction{
+		settledRunner("14:00", 2, 0.6, "1/2"),
+		settledRunner("14:00", 1, 0.4, "2/2"),
+		settledRunner("14:30", 3, 0.7, "2/2"),
+		settledRunner("14:30", 1, 0.3, "1/2"),
+	}
+
+	report := Calibrate(runners, 5, 0.1)
+	if report.Races != 2 || report.Runners != 4 || report.Winners != 2 {
+		t.Fatalf("got %d races, %d runners and %d winners, want 2, 4 and 2", report.Races, report.Runners, report.Winners)
+	}
+
+	// (0.4² + 0.4² + 0.7² + 0.7²) / 4
+	if report.BrierScore != 0.325 {
+		t.Errorf("got Brier score %g, want 0.325", report.BrierScore)
+	}
+	// Each winner at 0.6 or 0.3, each loser at 1 - 0.4 or 1 - 0.7
+	wantLogLoss := math.Round(-(math.Log(0.6)+math.Log(0.3))/2*1e6) / 1e6
+	if report.LogLoss != wantLogLoss {
+		t.Errorf("got log loss %g, want %g", report.LogLoss, wantLogLoss)
+	}
+
+	want := []models.CalibrationBucket{
+		{Lower: 0, Upper: 0.2},
+		{Lower: 0.2, Upper: 0.4, Runners: 1, Winners: 1, MeanProbability: 0.3, WinRate: 1},
+		{Lower: 0.4, Upper: 0.6, Runners: 1, MeanProbability: 0.4},
+		{Lower: 0.6, Upper: 0.8, Runners: 2, Winners: 1, MeanProbability: 0.65, WinRate: 0.5},
+		{Lower: 0.8, Upper: 1},
+	}
+	if len(report.Buckets) != len(want) {
+		t.Fatalf("got %d buckets, want %d", len(report.Buckets), len(want))
+	}
+	for i, bucket := range report.Buckets {
+		if bucket != want[i] {
+			t.Errorf("bucket %d: got %+v, want %+v", i, bucket, want[i])
+		}
+	}
+}
+
+// TestCalibrateCertain keeps a probability of 1 in the last bucket and the
+// log loss of certain outcomes finite
+func TestCalibrateCertain(t *testing.T) {
+	runners := []models.EventPrediction{
+		settledRunner("14:00", 1, 1, "2/2"),
+		settledRunner("14:00", 0, 0, "1/2"),
+	}
+
+	report := Calibrate(runners, 10, 0.1)
+	if last := report.Buckets[9]; last.Runners != 1 {
+		t.Errorf("got %+v, want the runner at 1 in the last bucket", last)
+	}
+	if math.IsInf(report.LogLoss, 0) || math.IsNaN(report.LogLoss) || report.LogLoss <= 0 {
+		t.Errorf("got log loss %g", report.LogLoss)
+	}
+	if report.BrierScore != 1 {
+		t.Errorf("got Brier score %g, want 1", report.BrierScore)
+	}
+}
+
+func TestCalibrateEmpty(t *testing.T) {
+	report := Calibrate(nil, 4, 0.1)
+	if report.Races != 0 || report.Runners != 0 || report.BrierScore != 0 || report.LogLoss != 0 {
+		t.Errorf("got %+v", report)
+	}
+	if len(report.Buckets) != 4 || report.FittedScale != nil {
+		t.Errorf("got %d buckets and fitted scale %v, want 4 and none", len(report.Buckets), report.FittedScale)
+	}
+}
+
+func TestFitWinProbabilityScale(t *testing.T) {
+	race := func(winner int) calibrationRace {
+		won := []bool{false, false}
+		won[winner] = true
+		return calibrationRace{scores: []float64{1, 0}, won: won}
+	}
+	noWinner := calibrationRace{scores: []float64{1, 0}, won: []bool{false, false}}
+
+	tests := []struct {
+		name  string
+		races []calibrationRace
+		// want is the fitted scale, NaN when there is none
+		want float64
+	}{
+		// The top score wins two races of three: e^s / (e^s + 1) = 2/3
+		{"two of three", []calibrationRace{race(0), race(1), race(0)}, math.Round(math.Log(2)*1e4) / 1e4},
+		{"one of two", []calibrationRace{race(0), race(1)}, 0},
+		{"races without a winner", []calibrationRace{race(0), noWinner, race(1), race(0), noWinner}, math.Round(math.Log(2)*1e4) / 1e4},
+		// Any larger scale fits better
+		{"top always wins", []calibrationRace{race(0), race(0)}, math.NaN()},
+		{"top never wins", []calibrationRace{race(1), race(1)}, math.NaN()},
+		{"no winners", []calibrationRace{noWinner}, math.NaN()},
+		{"equal scores", []calibrationRace{{scores: []float64{2, 2}, won: []bool{true, false}}}, math.NaN()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, start := range []float64{0, 0.1, 2} {
+				got := fitWinProbabilityScale(tt.races, start)
+				if math.IsNaN(tt.want) {
+					if got != nil {
+						t.Errorf("from %g: fitted %g, want none", start, *got)
+					}
+					continue
+				}
+				if got == nil || math.Abs(*got-tt.want) > 1e-4 {
+					t.Errorf("from %g: fitted %v, want %g", start, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetCalibration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	st, _ := newTestStore()
+	analysis := &settledAnalysis{runners: []models.EventPrediction{
+		settledRunner("14:00", 2, 0.6, "1/2"),
+		settledRunner("14:00", 1, 0.4, "2/2"),
+	}}
+	st.Analysis = analysis
+	cfg := config.Default()
+	cfg.WinProbabilityScale = 0.3
+	h := NewHandler(st, config.NewManager("", cfg), nil, nil)
+	r := gin.New()
+	r.GET("/racing/calibration", h.GetCalibration)
+
+	tests := []struct {
+		query  string
+		status int
+		asked  []string
+	}{
+		{"?from=2024-10-01&to=2024-10-05&profile=tuned&buckets=4", http.StatusOK, []string{"2024-10-01", "2024-10-05", "tuned"}},
+		{"?to=2024-10-31", http.StatusOK, []string{"2024-10-01", "2024-10-31", models.DefaultScoringProfile}},
+		{"?to=31/10/2024", http.StatusBadRequest, nil},
+		{"?from=yesterday", http.StatusBadRequest, nil},
+		{"?buckets=0", http.StatusBadRequest, nil},
+		{"?buckets=101", http.StatusBadRequest, nil},
+		{"?buckets=ten", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			analysis.asked = nil
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/racing/calibration"+tt.query, nil))
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d", w.Code, tt.status)
+			}
+			if strings.Join(analysis.asked, ",") != strings.Join(tt.asked, ",") {
+				t.Errorf("read the settled runners of %v, want %v", analysis.asked, tt.asked)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Calibration models.CalibrationReport `json:"calibration"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			report := response.Calibration
+			if report.From != tt.asked[0] || report.To != tt.asked[1] || report.Profile != tt.asked[2] {
+				t.Errorf("got the report of %s from %s to %s", report.Profile, report.From, report.To)
+			}
+			if report.Scale != 0.3 || report.Runners != 2 {
+				t.Errorf("got scale %g over %d runners, want the configured 0.3 over 2", report.Scale, report.Runners)
+			}
+		})
+	}
+}
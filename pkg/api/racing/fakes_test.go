@@ -0,0 +1,335 @@
+package racing
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/source"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+)
+
+// The fakes keep the rows of the tests in memory. Each embeds its interface
+// for the methods the tests do not reach, calling one of them panics.
+
+// memoryMeetings is a MeetingStore over the runners of a day and the
+// country of each course
+type memoryMeetings struct {
+	store.MeetingStore
+	selections []models.Selection
+	countries  map[string]string
+}
+
+func (m *memoryMeetings) Selections(ctx context.Context, date string) ([]models.Selection, error) {
+	var selections []models.Selection
+	for _, selection := range m.selections {
+		if selection.EventDate == date {
+			selections = append(selections, selection)
+		}
+	}
+	return selections, nil
+}
+
+func (m *memoryMeetings) Price(ctx context.Context, date string, selectionID int) (string, error) {
+	for _, selection := range m.selections {
+		if selection.EventDate == date && selection.ID == selectionID {
+			return selection.Odds, nil
+		}
+	}
+	return "", nil
+}
+
+func (m *memoryMeetings) RaceSelections(ctx context.Context, eventName, eventTime, date string) ([]models.Selection, error) {
+	var selections []models.Selection
+	for _, selection := range m.selections {
+		if selection.EventName == eventName && selection.EventTime == eventTime && selection.EventDate == date {
+			selections = append(selections, selection)
+		}
+	}
+	return selections, nil
+}
+
+func (m *memoryMeetings) Countries(ctx context.Context) (map[string]string, error) {
+	return m.countries, nil
+}
+
+// memoryForms is a FormStore holding the form summary of each selection and
+// the positions it finished in and starting prices, keyed by date
+type memoryForms struct {
+	store.FormStore
+	summaries map[int]models.AnalysisData
+	positions map[int]map[string]string
+	prices    map[int]map[string]string
+}
+
+func (f *memoryForms) Summary(ctx context.Context, selectionID int, before string) (models.AnalysisData, error) {
+	data, ok := f.summaries[selectionID]
+	if !ok || (before != "" && data.RaceDate >= before) {
+		return models.AnalysisData{}, store.ErrNoForm
+	}
+	return data, nil
+}
+
+func (f *memoryForms) Position(ctx context.Context, selectionID int, date string) (string, error) {
+	position, ok := f.positions[selectionID][date]
+	if !ok {
+		return "", fmt.Errorf("selection %d did not run on %s", selectionID, date)
+	}
+	return position, nil
+}
+
+func (f *memoryForms) Outcome(ctx context.Context, selectionID int, date string) (string, string, error) {
+	position, ok := f.positions[selectionID][date]
+	if !ok {
+		return "", "", sql.ErrNoRows
+	}
+	return position, f.prices[selectionID][date], nil
+}
+
+// analysisKey is the natural key of an Analysis row
+type analysisKey struct {
+	selectionID int
+	eventDate   string
+	profile     string
+}
+
+// memoryAnalysis is an AnalysisStore holding the analysed selections, the
+// score_constants of each profile and the country each event is run in
+type memoryAnalysis struct {
+	store.AnalysisStore
+	rows      map[analysisKey]models.EventPrediction
+	profiles  map[string][]models.ScoreConstant
+	countries map[string]string
+}
+
+func newMemoryAnalysis(profiles map[string][]models.ScoreConstant, countries map[string]string) *memoryAnalysis {
+	return &memoryAnalysis{
+		rows:      make(map[analysisKey]models.EventPrediction),
+		profiles:  profiles,
+		countries: countries,
+	}
+}
+
+func (a *memoryAnalysis) Upsert(ctx context.Context, eventDate, price string, data models.AnalysisData) error {
+	age, _ := strconv.Atoi(strings.Split(data.Age, " ")[0])
+	key := analysisKey{data.SelectionID, eventDate, data.Profile}
+
+	row := a.rows[key]
+	// Like the table, a second run keeps the stake of the first
+	if row.SelectionID == 0 {
+		row.ID = len(a.rows) + 1
+		row.Stake = data.Stake
+		row.BetType = data.BetType
+	}
+	row.SelectionID = data.SelectionID
+	row.SelectionName = data.SelectionName
+	row.EventLink = data.EventLink
+	row.SelectionLink = data.SelecionLink
+	row.EventName = data.EventName
+	row.EventDate = eventDate
+	row.EventTime = data.EventTime
+	row.Odds = price
+	row.Age = age
+	row.CleanBetScore = math.Round(data.TotalScore*1000) / 1000
+	row.PreferredDistance = math.Round(data.PreferedDistance*1000) / 1000
+	row.CurrentDistance = math.Round(data.CurrentDistance*1000) / 1000
+	row.DistanceTolerence = math.Abs(row.PreferredDistance - row.CurrentDistance)
+	row.Seed = data.Seed
+	row.Profile = data.Profile
+	row.WinProbability = math.Round(data.WinProbability*1e6) / 1e6
+	a.rows[key] = row
+	return nil
+}
+
+func (a *memoryAnalysis) Predictions(ctx context.Context, eventDate, region, profile string, limit int) ([]models.EventPrediction, error) {
+	var predictions []models.EventPrediction
+	for _, row := range a.rows {
+		if row.EventDate != eventDate || row.Profile != profile || row.Age >= 8 {
+			continue
+		}
+		country := a.countries[row.EventName]
+		if strings.EqualFold(region, "Both") {
+			if country != "UK" && country != "Ireland" {
+				continue
+			}
+		} else if country != region {
+			continue
+		}
+		predictions = append(predictions, row)
+	}
+
+	sort.Slice(predictions, func(i, j int) bool {
+		return predictions[i].CleanBetScore > predictions[j].CleanBetScore
+	})
+	if len(predictions) > limit {
+		predictions = predictions[:limit]
+	}
+	return predictions, nil
+}
+
+func (a *memoryAnalysis) Selection(ctx context.Context, eventDate string, selectionID int, profile string) (models.EventPrediction, error) {
+	for key, row := range a.rows {
+		if key.eventDate == eventDate && key.selectionID == selectionID && (profile == "" || key.profile == profile) {
+			return row, nil
+		}
+	}
+	return models.EventPrediction{}, nil
+}
+
+func (a *memoryAnalysis) Unsettled(ctx context.Context, eventDate string) ([]models.EventPrediction, error) {
+	var unsettled []models.EventPrediction
+	for key, row := range a.rows {
+		if key.eventDate == eventDate && row.CurrentEventPrice == "" {
+			unsettled = append(unsettled, row)
+		}
+	}
+	sort.Slice(unsettled, func(i, j int) bool {
+		return unsettled[i].ID < unsettled[j].ID
+	})
+	return unsettled, nil
+}
+
+func (a *memoryAnalysis) Settle(ctx context.Context, prediction models.EventPrediction) error {
+	key := analysisKey{prediction.SelectionID, prediction.EventDate, prediction.Profile}
+	if _, ok := a.rows[key]; !ok {
+		return fmt.Errorf("selection %d was not analysed on %s", prediction.SelectionID, prediction.EventDate)
+	}
+	a.rows[key] = prediction
+	return nil
+}
+
+func (a *memoryAnalysis) ScoringProfile(ctx context.Context, profile string) ([]models.ScoreConstant, error) {
+	constants, ok := a.profiles[profile]
+	if !ok {
+		return nil, store.ErrUnknownProfile
+	}
+	return constants, nil
+}
+
+func (a *memoryAnalysis) SaveScoringProfile(ctx context.Context, profile string, constants []models.ScoreConstant) error {
+	a.profiles[profile] = constants
+	return nil
+}
+
+// analysed returns the rows of the date scored by profile, by selection
+func (a *memoryAnalysis) analysed(eventDate, profile string) map[int]models.EventPrediction {
+	rows := make(map[int]models.EventPrediction)
+	for key, row := range a.rows {
+		if key.eventDate == eventDate && key.profile == profile {
+			rows[key.selectionID] = row
+		}
+	}
+	return rows
+}
+
+// testProfile is a scoring profile with a band or two per component and
+// every weight 1
+func testProfile() []models.ScoreConstant {
+	constants := []models.ScoreConstant{
+		{Category: componentLastRunPositions, Item: "2", Score: 10},
+		{Category: componentLastRunPositions, Item: "5", Score: 5},
+		{Category: componentLastRunPositions, Item: otherwiseItem, Score: 0},
+		{Category: componentDaysSinceLastRun, Item: "30", Score: 5},
+		{Category: componentDaysSinceLastRun, Item: otherwiseItem, Score: 0},
+		{Category: componentDistanceSuitability, Item: "same", Score: 5},
+		{Category: componentDistanceSuitability, Item: "shorter", Score: 2},
+		{Category: componentDistanceSuitability, Item: "longer", Score: 1},
+		{Category: componentWinCount, Item: "0.25", Score: 8},
+		{Category: componentWinCount, Item: "no_runs", Score: 0},
+		{Category: componentWinCount, Item: otherwiseItem, Score: 0},
+		{Category: componentOdds, Item: otherwiseItem, Score: 0},
+		{Category: componentRaceClass, Item: otherwiseItem, Score: 0},
+		{Category: componentAge, Item: otherwiseItem, Score: 0},
+	}
+	for _, component := range scoreComponents {
+		constants = append(constants, models.ScoreConstant{Category: weightsCategory, Item: component, Score: 1})
+	}
+	return constants
+}
+
+// memoryBacktests is a BacktestStore keeping the backtests saved in order
+type memoryBacktests struct {
+	store.BacktestStore
+	saved []models.Backtest
+}
+
+func (b *memoryBacktests) Save(ctx context.Context, backtest models.Backtest) (models.Backtest, error) {
+	backtest.ID = len(b.saved) + 1
+	b.saved = append(b.saved, backtest)
+	return backtest, nil
+}
+
+// memorySource is a RacingSource serving the form line of the race of the
+// day of each selection link, links in failing return their error
+type memorySource struct {
+	source.RacingSource
+	results map[string]models.SelectionForm
+	failing map[string]error
+	fetched []string
+}
+
+func (s *memorySource) Result(selectionLink string, eventDate string) (models.SelectionForm, error) {
+	s.fetched = append(s.fetched, selectionLink)
+	if err, ok := s.failing[selectionLink]; ok {
+		return models.SelectionForm{}, err
+	}
+	return s.results[selectionLink], nil
+}
+
+// memoryBets is a BetStore over the bets of every user, in the order they
+// were run
+type memoryBets struct {
+	store.BetStore
+	bets    []models.Bet
+	settled int
+}
+
+func (b *memoryBets) List(ctx context.Context, userID int, from, to, status string) ([]models.Bet, error) {
+	var bets []models.Bet
+	for _, bet := range b.bets {
+		if bet.UserID == userID && (from == "" || bet.EventDate >= from) && (to == "" || bet.EventDate <= to) &&
+			(status == "" || bet.Status == status) {
+			bets = append(bets, bet)
+		}
+	}
+	return bets, nil
+}
+
+func (b *memoryBets) Open(ctx context.Context, userID int, date string) ([]models.Bet, error) {
+	var bets []models.Bet
+	for _, bet := range b.bets {
+		if (userID == 0 || bet.UserID == userID) && bet.EventDate <= date && bet.Status == models.BetStatusOpen {
+			bets = append(bets, bet)
+		}
+	}
+	return bets, nil
+}
+
+func (b *memoryBets) Settle(ctx context.Context, bet models.Bet) error {
+	for i := range b.bets {
+		if b.bets[i].ID == bet.ID {
+			b.bets[i] = bet
+			b.settled++
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// settledAnalysis is an AnalysisStore serving settled runners, it keeps the
+// window and profile they were asked for
+type settledAnalysis struct {
+	store.AnalysisStore
+	runners []models.EventPrediction
+	asked   []string
+}
+
+func (a *settledAnalysis) Settled(ctx context.Context, from, to, profile string) ([]models.EventPrediction, error) {
+	a.asked = []string{from, to, profile}
+	return a.runners, nil
+}
@@ -0,0 +1,22 @@
+package racing
+
+import (
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/jobs"
+	"github.com/mmanjoura/clean-bet-backend/pkg/source"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+)
+
+// Handler serves the racing routes from the repositories it is given, reads
+// racecards, form and results from Source and runs ingestion through Jobs
+type Handler struct {
+	Store  *store.Store
+	Config *config.Manager
+	Source source.RacingSource
+	Jobs   *jobs.Manager
+}
+
+// NewHandler returns a Handler reading and writing through st
+func NewHandler(st *store.Store, cfg *config.Manager, src source.RacingSource, jobManager *jobs.Manager) *Handler {
+	return &Handler{Store: st, Config: cfg, Source: src, Jobs: jobManager}
+}
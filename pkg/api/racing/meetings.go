@@ -1,26 +1,21 @@
 package racing
 
 import (
+	"context"
 	"net/http"
-	"regexp"
-	"strconv"
-	"strings"
 	"time"
 
-
 	"github.com/gin-gonic/gin"
-	"github.com/gocolly/colly"
-	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/jobs"
 	"github.com/mmanjoura/clean-bet-backend/pkg/models"
-	"github.com/mmanjoura/clean-bet-backend/pkg/api/common"
+	"github.com/mmanjoura/clean-bet-backend/pkg/source"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
 )
 type EventDate struct {
 	Date string `json:"event_date"`
 }
 
-func GetMeetings(c *gin.Context) {
-	db := database.Database.DB
-
+func (h *Handler) GetMeetings(c *gin.Context) {
 	var raceDate EventDate
 
 	// Bind JSON input to optimalParams
@@ -29,174 +24,63 @@ func GetMeetings(c *gin.Context) {
 		return
 	}
 
-	todayRunners, err := getTodayRunners()
-	// todayRunners, err := TodayRunners(db, c, raceDate.Date)
+	job, err := h.Jobs.Start("meetings", raceDate, func(ctx context.Context, progress *jobs.Progress) error {
+		return IngestMeetings(ctx, h.Source, h.Store.Meetings, raceDate.Date, progress)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	for _, todayRunner := range todayRunners {
-
-		// Save horse information to DB
-		result, err := db.ExecContext(c, `
-		INSERT INTO Meetings (
-			selection_link,
-			selection_id,
-			event_link,
-			selection_name,
-			event_time,
-			event_name,
-			price,
-			event_date,
-			race_distance,
-			race_category,
-			track_condition,
-			number_of_runners,
-			race_track,
-			race_class,
-			created_at
-		)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			todayRunner.SelectionLink, // Include the selection link
-			todayRunner.SelectionID,
-			todayRunner.EventLink,
-			todayRunner.SelectionName,
-			todayRunner.EventTime,
-			todayRunner.EventName,
-			todayRunner.Price,
-			time.Now(),
-			todayRunner.RaceConditon.RaceDistance,
-			todayRunner.RaceConditon.RaceCategory,
-			todayRunner.RaceConditon.TrackCondition,
-			todayRunner.RaceConditon.NumberOfRunners,
-			todayRunner.RaceConditon.RaceTrack,
-			todayRunner.RaceConditon.RaceClass,
-			time.Now())
-		_ = result // Ignore the result if not needed
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	}
-
-
-
-	c.JSON(http.StatusOK, gin.H{"message": "Horse information saved successfully"})
 
+	c.JSON(http.StatusAccepted, gin.H{"message": "Meetings ingestion started", "job": job})
 }
 
-func getTodayRunners() ([]models.MeetingSelections, error) {
-	// Initialize the collector
-	c := colly.NewCollector()
-	config := database.Database.Config
-
-	// Slice to store all horse information
-	horses := []models.MeetingSelections{}
-
-	// On HTML element
-	c.OnHTML("table.AbcTable__TableContent-sc-9z9a8v-3 tbody tr", func(e *colly.HTMLElement) {
-		name := e.ChildText("td:nth-child(1) a")
-		selectionLink := e.ChildAttr("td:nth-child(1) a", "href") // Get the href attribute
-		event := e.ChildText("td:nth-child(3) a")
-		eventLink := e.ChildAttr("td:nth-child(3) a", "href") // Get the href attribute
-		price := e.ChildText("th:nth-child(5) span")
-
-		parts := strings.SplitN(event, " ", 2)
-		eventTime := parts[0]
-		eventName := parts[1]
-
-		// Compile the regular expression to match digits at the end of the string
-		re := regexp.MustCompile(`/horse/(\d+)$`)
+// IngestMeetings reads the runners of the date from src and saves them to Meetings
+func IngestMeetings(ctx context.Context, src source.RacingSource, meetings store.MeetingStore, date string, progress *jobs.Progress) error {
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
 
-		// Find the substring that matches the pattern and extract the horse_Id
-		match := re.FindStringSubmatch(selectionLink)
-		selectionId := 0
-		if len(match) > 1 {
-			selectionId, _ = strconv.Atoi(match[1])
+	todayRunners, err := getTodayRunners(src, date)
+	if err != nil {
+		return err
+	}
+	progress.SetTotal(len(todayRunners))
 
+	for _, todayRunner := range todayRunners {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-		horse := models.MeetingSelections{
-			SelectionName: name,
-			SelectionLink: selectionLink, // Add the selection link to the struct
-			EventLink:     eventLink,     // Add the event link to the struct
-			EventTime:     eventTime,
-			EventName:     eventName,
-			Price:         common.RemoveDuplicateOdds(price),
-			SelectionID:   selectionId,
-		}
-
-		reaceConditons := getEventConditons(eventLink)
-		horse.RaceConditon = reaceConditons
-
-		horses = append(horses, horse)
-	})
 
-	// Start scraping the URL
-	c.Visit(config["DataLink"] + "/racing/abc-guide")
-
-	return horses, nil
-}
-
-func getEventConditons(eventLink string) models.RaceConditon {
-	// Initialize the collector
-	c := colly.NewCollector()
-	config := database.Database.Config
-	raceConditons := models.RaceConditon{}
-
-	// Set the HTML selector and processing logic
-	c.OnHTML("li.RacingRacecardSummary__StyledAdditionalInfo-sc-1intsbr-2", func(e *colly.HTMLElement) {
-		// Extract the text from the HTML element
-		content := e.Text
-
-		raceConditons = extractRaceInfo(content)
-
-	})
-
-	// Visit the URL
-	c.Visit(config["DataLink"] + eventLink)
+		// Save horse information to DB
+		if err := meetings.Upsert(ctx, date, todayRunner); err != nil {
+			return err
+		}
+		progress.Done(1)
+	}
 
-	return raceConditons
+	return nil
 }
 
-func extractRaceInfo(content string) models.RaceConditon {
-	// Split the content by '|'
-	parts := strings.Split(content, "|")
-
-	// Trim whitespace from each part
-	for i := range parts {
-		parts[i] = strings.TrimSpace(parts[i])
+func getTodayRunners(src source.RacingSource, date string) ([]models.MeetingSelections, error) {
+	horses, err := src.Runners(date)
+	if err != nil {
+		return horses, err
 	}
 
-	var (
-		raceDistance    string
-		numberOfRunners string
-	)
-
-	// Patterns to recognize specific parts
-	distancePattern := regexp.MustCompile(`\d+m \d+f \d+y|\d+f \d+y|\d+m|\d+f|\d+y`) // Extended pattern for various distance formats
-	runnersPattern := regexp.MustCompile(`\d+ Runners`)
-
-	// Assign defaults
-	raceDistance = "Unknown"
-	numberOfRunners = "Unknown"
-
-	// Assign values based on regex patterns
-	for _, part := range parts {
-		switch {
-		case distancePattern.MatchString(part):
-			raceDistance = part
-		case runnersPattern.MatchString(part):
-			numberOfRunners = part
+	// Runners of the same race share its conditions, fetch them once per race
+	conditions := make(map[string]models.RaceConditon)
+	for i, horse := range horses {
+		raceConditon, ok := conditions[horse.EventLink]
+		if !ok {
+			raceConditon, err = src.RaceConditions(horse.EventLink)
+			if err != nil {
+				return horses, err
+			}
+			conditions[horse.EventLink] = raceConditon
 		}
+		horses[i].RaceConditon = raceConditon
 	}
 
-	// Create the RaceCondition object
-	raceConditions := models.RaceConditon{
-		RaceDistance:    raceDistance,
-		NumberOfRunners: numberOfRunners,
-	}
-
-	return raceConditions
+	return horses, nil
 }
-
-
@@ -0,0 +1,415 @@
+package racing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/jobs"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/settlement"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxGridCandidates bounds the combinations a grid search may try
+const maxGridCandidates = 100000
+
+// ErrNoCandidate is returned when no candidate placed enough training bets
+var ErrNoCandidate = errors.New("no candidate placed enough bets")
+
+// Objectives the optimiser can maximise
+var optimiseObjectives = map[string]func(models.Backtest) float64{
+	"roi":         func(b models.Backtest) float64 { return b.ROI },
+	"profit":      func(b models.Backtest) float64 { return b.Profit },
+	"strike_rate": func(b models.Backtest) float64 { return b.StrikeRate },
+}
+
+// limitCategories are the bands whose limits a random search scales, class
+// and age limits are categories rather than amounts
+var limitCategories = []string{
+	componentLastRunPositions,
+	componentDaysSinceLastRun,
+	componentWinCount,
+	componentOdds,
+}
+
+// optimiseCandidate is a set of weights and limit factors to try on the base
+// profile
+type optimiseCandidate struct {
+	weights map[string]float64
+	factors map[string]float64
+}
+
+// apply returns the base profile changed by the candidate, named name
+func (c optimiseCandidate) apply(base *ScoringProfile, name string) *ScoringProfile {
+	profile := base.clone(name)
+	for component, weight := range c.weights {
+		profile.weights[component] = weight
+	}
+	for category, factor := range c.factors {
+		profile.scaleLimits(category, factor)
+	}
+	return profile
+}
+
+// OptimiseDefaults validates params and fills in the defaults of what they
+// leave out, the stake comes from the configuration
+func OptimiseDefaults(params models.OptimiseParameters, cfg *config.Config) (models.OptimiseParameters, error) {
+	const layout = "2006-01-02"
+
+	trainFrom, err := time.Parse(layout, params.TrainFrom)
+	if err != nil {
+		return params, fmt.Errorf("invalid train_from %q: %w", params.TrainFrom, err)
+	}
+	trainTo, err := time.Parse(layout, params.TrainTo)
+	if err != nil {
+		return params, fmt.Errorf("invalid train_to %q: %w", params.TrainTo, err)
+	}
+	if trainTo.Before(trainFrom) {
+		return params, fmt.Errorf("train_to %s is before train_from %s", params.TrainTo, params.TrainFrom)
+	}
+
+	if params.TestFrom == "" {
+		params.TestFrom = trainTo.AddDate(0, 0, 1).Format(layout)
+	}
+	testFrom, err := time.Parse(layout, params.TestFrom)
+	if err != nil {
+		return params, fmt.Errorf("invalid test_from %q: %w", params.TestFrom, err)
+	}
+	if !testFrom.After(trainTo) {
+		return params, fmt.Errorf("test_from %s must follow the training window ending %s", params.TestFrom, params.TrainTo)
+	}
+	if params.TestTo == "" {
+		params.TestTo = testFrom.Add(trainTo.Sub(trainFrom)).Format(layout)
+	}
+	testTo, err := time.Parse(layout, params.TestTo)
+	if err != nil {
+		return params, fmt.Errorf("invalid test_to %q: %w", params.TestTo, err)
+	}
+	if testTo.Before(testFrom) {
+		return params, fmt.Errorf("test_to %s is before test_from %s", params.TestTo, params.TestFrom)
+	}
+
+	if params.Base == "" {
+		params.Base = models.DefaultScoringProfile
+	}
+
+	switch params.Search {
+	case "", models.SearchGrid:
+		params.Search = models.SearchGrid
+		if len(params.Steps) == 0 {
+			params.Steps = []float64{0, 1, 2}
+		}
+		for _, step := range params.Steps {
+			if step < 0 {
+				return params, fmt.Errorf("steps must not be negative, got %g", step)
+			}
+		}
+		if math.Pow(float64(len(params.Steps)), float64(len(scoreComponents))) > maxGridCandidates {
+			return params, fmt.Errorf("%d steps over %d weights make more than %d candidates", len(params.Steps), len(scoreComponents), maxGridCandidates)
+		}
+	case models.SearchRandom:
+		if params.Iterations == 0 {
+			params.Iterations = 500
+		}
+		if params.Iterations < 0 || params.Iterations > maxGridCandidates {
+			return params, fmt.Errorf("iterations must be within [1, %d], got %d", maxGridCandidates, params.Iterations)
+		}
+		if params.MaxWeight == 0 {
+			params.MaxWeight = 2
+		}
+		if params.MaxWeight < 0 {
+			return params, fmt.Errorf("max_weight must be positive, got %g", params.MaxWeight)
+		}
+		if params.LimitSpread < 0 || params.LimitSpread >= 1 {
+			return params, fmt.Errorf("limit_spread must be within [0, 1), got %g", params.LimitSpread)
+		}
+		params.Seed = AnalysisSeed(params.Seed, params.TrainFrom+" "+params.TrainTo)
+	default:
+		return params, fmt.Errorf("unknown search %q, want %s or %s", params.Search, models.SearchGrid, models.SearchRandom)
+	}
+
+	if params.Objective == "" {
+		params.Objective = "roi"
+	}
+	if _, ok := optimiseObjectives[params.Objective]; !ok {
+		return params, fmt.Errorf("unknown objective %q, want roi, profit or strike_rate", params.Objective)
+	}
+	if params.MinBets == 0 {
+		params.MinBets = 1
+	}
+
+	// The staking rule is checked like a backtest's
+	backtest, err := BacktestDefaults(optimiseBacktest(params, params.TrainFrom, params.TrainTo), cfg)
+	if err != nil {
+		return params, err
+	}
+	params.Picks = backtest.Picks
+	params.Staking = backtest.Staking
+	params.Stake = backtest.Stake
+
+	return params, nil
+}
+
+// RunOptimisation searches the weights, and band limits for a random search,
+// of params.Base that best meet params.Objective on the training window,
+// saves them as the scoring profile name and stores the backtests of the
+// profile on both windows, and of the base profile on the test window, to
+// Backtests. Params must have gone through OptimiseDefaults. Progress counts
+// the candidates tried.
+func RunOptimisation(ctx context.Context, st *store.Store, name string, params models.OptimiseParameters, progress *jobs.Progress) (models.Optimisation, error) {
+	base, err := LoadScoringProfile(ctx, st.Analysis, params.Base)
+	if err != nil {
+		return models.Optimisation{}, err
+	}
+
+	training, err := loadBacktestRaces(ctx, st, params.TrainFrom, params.TrainTo, nil)
+	if err != nil {
+		return models.Optimisation{}, err
+	}
+	test, err := loadBacktestRaces(ctx, st, params.TestFrom, params.TestTo, nil)
+	if err != nil {
+		return models.Optimisation{}, err
+	}
+
+	var candidates []optimiseCandidate
+	if params.Search == models.SearchGrid {
+		candidates = gridCandidates(params.Steps)
+	} else {
+		candidates = randomCandidates(NewRand(params.Seed), params)
+	}
+	progress.SetTotal(len(candidates))
+
+	objective := optimiseObjectives[params.Objective]
+	trainParams := optimiseBacktest(params, params.TrainFrom, params.TrainTo)
+	var best *optimiseCandidate
+	var bestScore float64
+	for i := range candidates {
+		if err := ctx.Err(); err != nil {
+			return models.Optimisation{}, err
+		}
+		result := simulateBacktest(training, candidates[i].apply(base, name), trainParams)
+		progress.Done(1)
+		if result.Bets < params.MinBets {
+			continue
+		}
+		// On a tie the candidate tried first wins
+		if score := objective(result); best == nil || score > bestScore {
+			best, bestScore = &candidates[i], score
+		}
+	}
+	if best == nil {
+		return models.Optimisation{}, fmt.Errorf("%w: %d between %s and %s", ErrNoCandidate, params.MinBets, params.TrainFrom, params.TrainTo)
+	}
+
+	profile := best.apply(base, name)
+	constants := profile.Constants()
+	if err := st.Analysis.SaveScoringProfile(ctx, name, constants); err != nil {
+		return models.Optimisation{}, err
+	}
+
+	optimisation := models.Optimisation{
+		Profile:      name,
+		Params:       params,
+		Candidates:   len(candidates),
+		Weights:      profile.weights,
+		LimitFactors: best.factors,
+		Constants:    constants,
+		Parameters:   optimalParameters(training, profile, trainParams),
+	}
+
+	runs := []struct {
+		result  *models.Backtest
+		label   string
+		races   []backtestRace
+		profile *ScoringProfile
+		params  models.BacktestParameters
+	}{
+		{&optimisation.InSample, "in-sample", training, profile, trainParams},
+		{&optimisation.OutOfSample, "out-of-sample", test, profile, optimiseBacktest(params, params.TestFrom, params.TestTo)},
+		{&optimisation.Baseline, "baseline", test, base, optimiseBacktest(params, params.TestFrom, params.TestTo)},
+	}
+	for _, run := range runs {
+		run.params.Name = name + " " + run.label
+		run.params.Profile = run.profile.Name
+		*run.result, err = st.Backtests.Save(ctx, simulateBacktest(run.races, run.profile, run.params))
+		if err != nil {
+			return models.Optimisation{}, err
+		}
+	}
+
+	return optimisation, nil
+}
+
+// optimalParameters returns the mean form of the winners profile backed on
+// the races: the days since their last run, their runs, years in
+// competition, wins, rating and position, the distance of the race and how
+// far it was from their preferred one
+func optimalParameters(races []backtestRace, profile *ScoringProfile, params models.BacktestParameters) models.OptimalParameters {
+	var winners int
+	var recoveryDays, numRuns, years, numWins, rating, position, distance, tolerance float64
+	for _, race := range races {
+		for _, pick := range backtestPicks(race, profile, params) {
+			settled, err := settlement.Win(1, pick.price, pick.position)
+			if err != nil || settled.Outcome != models.OutcomeWon {
+				continue
+			}
+			winners++
+			recoveryDays += float64(pick.data.RecoveryDays)
+			numRuns += float64(pick.data.NumRuns)
+			years += float64(pick.data.Duration)
+			numWins += float64(pick.data.WinCount)
+			rating += pick.data.AvgRating
+			position += pick.data.AvgPosition
+			distance += pick.data.CurrentDistance
+			tolerance += math.Abs(pick.data.PreferedDistance - pick.data.CurrentDistance)
+		}
+	}
+	if winners == 0 {
+		return models.OptimalParameters{}
+	}
+
+	mean := func(total float64) float64 {
+		return math.Round(total/float64(winners)*100) / 100
+	}
+	return models.OptimalParameters{
+		OptimalRecoveryDays:          int(math.Round(recoveryDays / float64(winners))),
+		OptimalNumRuns:               int(math.Round(numRuns / float64(winners))),
+		OptimalNumYearsInCompetition: int(math.Round(years / float64(winners))),
+		OptimalNumWins:               int(math.Round(numWins / float64(winners))),
+		OptimalRating:                mean(rating),
+		OptimalPosition:              mean(position),
+		OptimalDistance:              mean(distance),
+		Tolerance:                    mean(tolerance),
+	}
+}
+
+// optimiseBacktest returns the backtest parameters of params over a window
+func optimiseBacktest(params models.OptimiseParameters, from, to string) models.BacktestParameters {
+	return models.BacktestParameters{
+		From:     from,
+		To:       to,
+		Profile:  params.Base,
+		Picks:    params.Picks,
+		MinScore: params.MinScore,
+		Staking:  params.Staking,
+		Stake:    params.Stake,
+		Percent:  params.Percent,
+		Bank:     params.Bank,
+	}
+}
+
+// gridCandidates returns every combination of steps as component weights
+func gridCandidates(steps []float64) []optimiseCandidate {
+	candidates := []optimiseCandidate{{weights: map[string]float64{}}}
+	for _, component := range scoreComponents {
+		next := make([]optimiseCandidate, 0, len(candidates)*len(steps))
+		for _, candidate := range candidates {
+			for _, step := range steps {
+				weights := make(map[string]float64, len(candidate.weights)+1)
+				for key, value := range candidate.weights {
+					weights[key] = value
+				}
+				weights[component] = step
+				next = append(next, optimiseCandidate{weights: weights})
+			}
+		}
+		candidates = next
+	}
+	return candidates
+}
+
+// randomCandidates draws params.Iterations candidates from rng
+func randomCandidates(rng *rand.Rand, params models.OptimiseParameters) []optimiseCandidate {
+	candidates := make([]optimiseCandidate, params.Iterations)
+	for i := range candidates {
+		candidate := optimiseCandidate{
+			weights: make(map[string]float64, len(scoreComponents)),
+			factors: make(map[string]float64, len(limitCategories)),
+		}
+		for _, component := range scoreComponents {
+			candidate.weights[component] = math.Round(rng.Float64()*params.MaxWeight*100) / 100
+		}
+		if params.LimitSpread > 0 {
+			for _, category := range limitCategories {
+				candidate.factors[category] = math.Round((1+params.LimitSpread*(2*rng.Float64()-1))*100) / 100
+			}
+		}
+		candidates[i] = candidate
+	}
+	return candidates
+}
+
+// PostOptimise godoc
+// @Summary Optimise a scoring profile
+// @Description Start a background job searching the weights of a profile on a training window of at most a year of past races, validating the best on the following window of at most a year and saving it as the profile name with its out-of-sample backtest. The job's progress is at /jobs/{id}, its result is the optimisation once it finishes.
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param name path string true "Name of the profile to save"
+// @Param body body models.OptimiseParameters true "Windows, search and staking rule"
+// @Success 202 {object} models.Job "accepted"
+// @Router /admin/scoring-profiles/{name}/optimise [post]
+func (h *Handler) PostOptimise(c *gin.Context) {
+	name := c.Param("name")
+	if name == models.DefaultScoringProfile {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the default profile can not be replaced by an optimisation"})
+		return
+	}
+
+	var params models.OptimiseParameters
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params, err := OptimiseDefaults(params, h.Config.Current())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// OptimiseDefaults checked the dates
+	windows := []struct{ label, from, to string }{
+		{"training", params.TrainFrom, params.TrainTo},
+		{"test", params.TestFrom, params.TestTo},
+	}
+	for _, window := range windows {
+		from, _ := time.Parse("2006-01-02", window.from)
+		to, _ := time.Parse("2006-01-02", window.to)
+		if days := backtestDays(from, to); days > maxBacktestDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("the %s window covers at most %d days, got %d", window.label, maxBacktestDays, days)})
+			return
+		}
+	}
+
+	if _, err := LoadScoringProfile(c, h.Store.Analysis, params.Base); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, store.ErrUnknownProfile) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.Jobs.Start("optimise", params, func(ctx context.Context, progress *jobs.Progress) error {
+		optimisation, err := RunOptimisation(ctx, h.Store, name, params, progress)
+		if err != nil {
+			return err
+		}
+		return progress.SetResult(optimisation)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Optimisation started", "job": job})
+}
@@ -0,0 +1,193 @@
+package racing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+)
+
+const testNextDate = "2024-10-06"
+
+// newOptimiseStore returns the store of newTestStore with Alpha beating
+// Bravo at 3/1 on testEventDate and again on testNextDate
+func newOptimiseStore() (*store.Store, *memoryAnalysis, *memoryBacktests) {
+	st, analyses := newTestStore()
+	forms := st.Forms.(*memoryForms)
+	forms.positions = map[int]map[string]string{
+		1: {testEventDate: "1/2", testNextDate: "1/2"},
+		2: {testEventDate: "2/2", testNextDate: "2/2"},
+	}
+	forms.prices = map[int]map[string]string{
+		1: {testEventDate: "3/1", testNextDate: "3/1"},
+		2: {testEventDate: "2/1", testNextDate: "2/1"},
+	}
+
+	meetings := st.Meetings.(*memoryMeetings)
+	var selections []models.Selection
+	for _, selection := range meetings.selections[:2] {
+		next := selection
+		next.EventDate = testNextDate
+		selections = append(selections, selection, next)
+	}
+	meetings.selections = selections
+	meetings.countries = map[string]string{"Ascot": "UK"}
+
+	backtests := &memoryBacktests{}
+	st.Backtests = backtests
+	return st, analyses, backtests
+}
+
+func testOptimiseParameters(t *testing.T, params models.OptimiseParameters) models.OptimiseParameters {
+	t.Helper()
+	params.TrainFrom, params.TrainTo = testEventDate, testEventDate
+	params.Stake = 10
+	params, err := OptimiseDefaults(params, config.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return params
+}
+
+func TestRunOptimisation(t *testing.T) {
+	st, analyses, backtests := newOptimiseStore()
+	params := testOptimiseParameters(t, models.OptimiseParameters{Steps: []float64{0, 1}})
+	if params.TestFrom != testNextDate || params.TestTo != testNextDate {
+		t.Fatalf("test window %s to %s, want the day after training", params.TestFrom, params.TestTo)
+	}
+
+	optimisation, err := RunOptimisation(context.Background(), st, "tuned", params, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := int(math.Pow(2, float64(len(scoreComponents)))); optimisation.Candidates != want {
+		t.Errorf("tried %d candidates, want %d", optimisation.Candidates, want)
+	}
+	// Every candidate backing Alpha makes the same ROI, the first one tried
+	// wins the tie and with no weight backs Alpha on selection order
+	for component, weight := range optimisation.Weights {
+		if weight != 0 {
+			t.Errorf("%s weighted %g, want the first candidate's 0", component, weight)
+		}
+	}
+	if _, ok := analyses.profiles["tuned"]; !ok {
+		t.Error("the profile was not saved")
+	}
+
+	runs := []struct {
+		name    string
+		result  models.Backtest
+		from    string
+		profile string
+	}{
+		{"in-sample", optimisation.InSample, testEventDate, "tuned"},
+		{"out-of-sample", optimisation.OutOfSample, testNextDate, "tuned"},
+		{"baseline", optimisation.Baseline, testNextDate, models.DefaultScoringProfile},
+	}
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			if run.result.From != run.from || run.result.Profile != run.profile || run.result.Name != "tuned "+run.name {
+				t.Errorf("backtest %q of %s from %s, want %s from %s", run.result.Name, run.result.Profile, run.result.From, run.profile, run.from)
+			}
+			// 10 on Alpha at 3/1
+			if run.result.Bets != 1 || run.result.Winners != 1 || run.result.Profit != 30 {
+				t.Errorf("%d bets, %d winners, %g profit; want Alpha winning 30", run.result.Bets, run.result.Winners, run.result.Profit)
+			}
+		})
+	}
+	if len(backtests.saved) != len(runs) {
+		t.Errorf("saved %d backtests, want %d", len(backtests.saved), len(runs))
+	}
+
+	want := models.OptimalParameters{OptimalRecoveryDays: 15, OptimalNumRuns: 4, OptimalNumWins: 2, OptimalDistance: 10}
+	if optimisation.Parameters != want {
+		t.Errorf("got parameters %+v, want Alpha's form %+v", optimisation.Parameters, want)
+	}
+}
+
+func TestRunOptimisationMinBets(t *testing.T) {
+	st, analyses, backtests := newOptimiseStore()
+	params := testOptimiseParameters(t, models.OptimiseParameters{Steps: []float64{0, 1}, MinBets: 2})
+
+	_, err := RunOptimisation(context.Background(), st, "tuned", params, nil)
+	if !errors.Is(err, ErrNoCandidate) {
+		t.Fatalf("got %v with a single training race, want %v", err, ErrNoCandidate)
+	}
+	if _, ok := analyses.profiles["tuned"]; ok || len(backtests.saved) != 0 {
+		t.Error("saved the outcome of an optimisation without a candidate")
+	}
+}
+
+func TestGridCandidates(t *testing.T) {
+	steps := []float64{0, 0.5, 2}
+	candidates := gridCandidates(steps)
+	if want := int(math.Pow(float64(len(steps)), float64(len(scoreComponents)))); len(candidates) != want {
+		t.Fatalf("got %d candidates, want %d", len(candidates), want)
+	}
+
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		if len(candidate.weights) != len(scoreComponents) || candidate.factors != nil {
+			t.Fatalf("candidate %+v does not weight every component alone", candidate)
+		}
+		key := ""
+		for _, component := range scoreComponents {
+			weight := candidate.weights[component]
+			if weight != 0 && weight != 0.5 && weight != 2 {
+				t.Fatalf("%s weighted %g, not a step", component, weight)
+			}
+			key += fmt.Sprint(weight, " ")
+		}
+		if seen[key] {
+			t.Fatalf("weights %s tried twice", key)
+		}
+		seen[key] = true
+	}
+}
+
+func TestRandomCandidates(t *testing.T) {
+	params := models.OptimiseParameters{Iterations: 50, MaxWeight: 3, LimitSpread: 0.2, Seed: 7}
+
+	candidates := randomCandidates(NewRand(params.Seed), params)
+	if len(candidates) != params.Iterations {
+		t.Fatalf("got %d candidates, want %d", len(candidates), params.Iterations)
+	}
+	for _, candidate := range candidates {
+		for component, weight := range candidate.weights {
+			if weight < 0 || weight > params.MaxWeight {
+				t.Errorf("%s weighted %g, outside [0, %g]", component, weight, params.MaxWeight)
+			}
+		}
+		if len(candidate.factors) != len(limitCategories) {
+			t.Fatalf("got factors %v, want one per limit category", candidate.factors)
+		}
+		for category, factor := range candidate.factors {
+			if factor < 0.8 || factor > 1.2 {
+				t.Errorf("%s limits scaled by %g, outside 1 ± 0.2", category, factor)
+			}
+		}
+	}
+
+	// The same seed draws the same candidates
+	again := randomCandidates(NewRand(params.Seed), params)
+	for i := range candidates {
+		for component, weight := range candidates[i].weights {
+			if again[i].weights[component] != weight {
+				t.Fatalf("candidate %d weighted %s %g then %g", i, component, weight, again[i].weights[component])
+			}
+		}
+	}
+
+	params.LimitSpread = 0
+	for _, candidate := range randomCandidates(NewRand(params.Seed), params) {
+		if len(candidate.factors) != 0 {
+			t.Fatalf("scaled limits by %v without a spread", candidate.factors)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package racing
+
+import (
+	"context"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/ingest"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/scheduler"
+	"github.com/mmanjoura/clean-bet-backend/pkg/source"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+)
+
+// PipelineStages returns the daily pipeline: meetings, forms, analysis then
+// results, which settle the analysed selections and the bets placed on them.
+// Each run reads from src and the configuration in force when it starts.
+func PipelineStages(st *store.Store, src source.RacingSource, cfg *config.Manager) []scheduler.Stage {
+	return []scheduler.Stage{
+		{
+			Name: "meetings",
+			Run: func(ctx context.Context, date string) error {
+				return IngestMeetings(ctx, src, st.Meetings, date, nil)
+			},
+		},
+		{
+			Name:     "forms",
+			Requires: []string{"meetings"},
+			Run: func(ctx context.Context, date string) error {
+				return IngestForms(ctx, src, st, ingest.FormOptionsFromConfig(cfg.Current().Forms), date, nil)
+			},
+		},
+		{
+			Name:     "analysis",
+			Requires: []string{"forms"},
+			Run: func(ctx context.Context, date string) error {
+				return RunAnalysis(ctx, st, cfg.Current(), models.RaceParameters{EventDate: date}, nil)
+			},
+		},
+		{
+			Name:     "results",
+			Requires: []string{"analysis"},
+			Run: func(ctx context.Context, date string) error {
+				if err := SettleResults(ctx, src, st, cfg.Current(), date, nil); err != nil {
+					return err
+				}
+				return SettleBets(ctx, st, 0, date)
+			},
+		},
+	}
+}
+
+// BackfillStages returns the pipeline for a past date. Form pages list every
+// race a horse ran since, so only the lines a live run on that morning would
+// have seen are kept.
+func BackfillStages(st *store.Store, src source.RacingSource, cfg *config.Manager) []scheduler.Stage {
+	stages := PipelineStages(st, src, cfg)
+	for i := range stages {
+		if stages[i].Name != "forms" {
+			continue
+		}
+		stages[i].Run = func(ctx context.Context, date string) error {
+			raceDate, err := time.Parse("2006-01-02", date)
+			if err != nil {
+				return err
+			}
+			opts := ingest.FormOptionsFromConfig(cfg.Current().Forms)
+			opts.Before = raceDate
+			return IngestForms(ctx, src, st, opts, date, nil)
+		}
+	}
+	return stages
+}
@@ -1,23 +1,17 @@
 package racing
 
 import (
-	"database/sql"
 	"net/http"
 	"sort"
 	"strconv"
 
-	"github.com/mmanjoura/clean-bet-backend/pkg/database"
 	"github.com/mmanjoura/clean-bet-backend/pkg/models"
 
 	"github.com/gin-gonic/gin"
 )
 
-func GetPredictions(c *gin.Context) {
-	db := database.Database.DB
-	config := database.Database.Config
-
+func (h *Handler) GetPredictions(c *gin.Context) {
 	params := models.GetWinnerParams{}
-	float64TotalRuns := 0.0
 
 	// Bind JSON input to optimalParams
 	if err := c.ShouldBindJSON(&params); err != nil {
@@ -25,126 +19,71 @@ func GetPredictions(c *gin.Context) {
 		return
 	}
 
-	params.Delta = config["Delta"]
-	params.AvgPosition = config["average_postion"]
-	params.TotalRuns = config["total_runs"]
-	stake, err := strconv.Atoi(config["bet_value"])
-	// scoreLimit, err := strconv.ParseFloat(config["score_limit"], 64)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid bet value"})
-		return
+	cfg := h.Config.Current()
+	params.Delta = strconv.FormatFloat(cfg.Delta, 'f', -1, 64)
+	params.AvgPosition = strconv.FormatFloat(cfg.AveragePosition, 'f', -1, 64)
+	params.TotalRuns = strconv.Itoa(cfg.TotalRuns)
+	if params.Profile == "" {
+		params.Profile = models.DefaultScoringProfile
 	}
 
-
+	// The plan of the request, else the one the user saved, else level stakes
+	plan := models.StakingPlan{Stake: float64(params.Stake)}
+	bank, saved := 0.0, false
+	if params.Staking != nil {
+		plan = *params.Staking
+	} else if user, ok := currentUser(c); ok {
+		userPlan, userBank, ok, err := h.userStakingPlan(c, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if ok {
+			plan, bank, saved = userPlan, userBank, true
+		}
+	}
+	plan, err := StakingDefaults(plan, cfg)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid bet value"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	params.Stake = stake
-
-	var eventPredicitonsResponse models.EventPredictionResponse
-
-	// Construct query based on region filter
-	query := `
-		SELECT id,
-			selection_id,
-			selection_name,
-			COALESCE(odds, '') as odds,
-			COALESCE(age, '') as age,
-			COALESCE(clean_bet_score, '') as clean_bet_score,
-			COALESCE(average_position, '') as average_position,
-			COALESCE(average_rating, '') as average_rating,
-			event_name,
-			COALESCE(event_date, '') as event_date,
-			COALESCE(race_date, '') as race_date,
-			COALESCE(event_time, '') as event_time,
-			COALESCE(selection_position, '') as selection_position,
-			ABS(prefered_distance - current_distance) as distanceTolerence,
-			COALESCE(num_runners, '') as num_runners,
-			COALESCE(number_runs, '') as number_runs,
-			COALESCE(prefered_distance, '') as prefered_distance,
-			COALESCE(current_distance, '') as current_distance,
-			COALESCE(potential_return, '') as potential_return,
-			COALESCE(current_event_price, '') as current_event_price,
-			COALESCE(current_event_position, '') as current_event_position,
-			created_at,
-			updated_at
-		FROM Analysis
-		WHERE event_date = ? and age < 8`
-
-	// Modify query based on region parameter
-	if params.Region == "Both" {
-		query += ` AND event_name IN (SELECT event_name FROM events WHERE country IN ('UK', 'Ireland'))`
-	} else {
-		query += ` AND event_name IN (SELECT event_name FROM events WHERE country = ?)`
+	if !saved {
+		bank = plan.Bank
 	}
 
-	query += ` ORDER BY clean_bet_score DESC LIMIT 5;`
-
-	// Execute query
-	var rows *sql.Rows
-	if params.Region == "both" {
-		rows, err = db.Query(query, params.EventDate)
-	} else {
-		rows, err = db.Query(query, params.EventDate, params.Region)
-	}
+	var eventPredicitonsResponse models.EventPredictionResponse
 
+	predictions, err := h.Store.Analysis.Predictions(c, params.EventDate, params.Region, params.Profile, 5)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
-
-	var predictions []models.EventPrediction
-
-	for rows.Next() {
-		racePrdiction := models.EventPrediction{}
-		err := rows.Scan(
-			&racePrdiction.ID,
-			&racePrdiction.SelectionID,
-			&racePrdiction.SelectionName,
-			&racePrdiction.Odds,
-			&racePrdiction.Age,
-			&racePrdiction.CleanBetScore,
-			&racePrdiction.AveragePosition,
-			&racePrdiction.AverageRating,
-			&racePrdiction.EventName,
-			&racePrdiction.EventDate,
-			&racePrdiction.RaceDate,
-			&racePrdiction.EventTime,
-			&racePrdiction.SelectionPosition,
-			&racePrdiction.DistanceTolerence,
-			&racePrdiction.NumRunners,
-			&racePrdiction.NumbeRuns,
-			&racePrdiction.PreferredDistance,
-			&racePrdiction.CurrentDistance,
-			&racePrdiction.PotentialReturn,
-			&racePrdiction.CurrentEventPrice,
-			&racePrdiction.CurrentEventPosition,
-			&racePrdiction.CreatedAt,
-			&racePrdiction.UpdatedAt,
-		)
-
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		position, err := getPosition(racePrdiction.SelectionID, params.EventDate, db)
 
+	for i := range predictions {
+		position, err := h.Store.Forms.Position(c, predictions[i].SelectionID, params.EventDate)
 		if err != nil {
-			racePrdiction.Position = "?"
+			predictions[i].Position = "?"
 		} else {
-			racePrdiction.Position = position
+			predictions[i].Position = position
 		}
-
-		predictions = append(predictions, racePrdiction)
+		predictions[i].RecommendedStake = RecommendedStake(plan, bank, predictions[i].Odds, predictions[i].WinProbability)
 	}
 
-	eventPredicitonsResponse.TotalBet = float64(len(predictions) * params.Stake)
+	// Only the settled selections count towards the totals
+	for _, prediction := range predictions {
+		if prediction.CurrentEventPrice == "" {
+			continue
+		}
+		eventPredicitonsResponse.TotalBet += prediction.Stake
+		eventPredicitonsResponse.TotalReturn += prediction.GrossReturn
+		eventPredicitonsResponse.TotalProfit += prediction.NetProfit
+	}
+	eventPredicitonsResponse.TotalBet = roundMoney(eventPredicitonsResponse.TotalBet)
+	eventPredicitonsResponse.TotalReturn = roundMoney(eventPredicitonsResponse.TotalReturn)
+	eventPredicitonsResponse.TotalProfit = roundMoney(eventPredicitonsResponse.TotalProfit)
 	eventPredicitonsResponse.Selections = predictions
-	eventPredicitonsResponse.TotalReturn = float64TotalRuns
+	eventPredicitonsResponse.Staking = plan
+	eventPredicitonsResponse.Bank = roundMoney(bank)
 
 	// Sort filtered predictions by CleanBetScore if needed (descending order)
 	sort.Slice(predictions, func(i, j int) bool {
@@ -183,16 +122,3 @@ func filterHighestBetScore(predictions []models.EventPrediction) []models.EventP
 
 	return filteredPredictions
 }
-
-// Get Postion given selection Id
-func getPosition(selectionId int, race_date string, db *sql.DB) (string, error) {
-	var position string
-	err := db.QueryRow(`
-				Select position 
-				from Forms 
-				where DATE(race_date) = ? and selection_id = ?;`, race_date, selectionId).Scan(&position)
-	if err != nil {
-		return "", err
-	}
-	return position, nil
-}
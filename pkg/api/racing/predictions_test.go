@@ -0,0 +1,119 @@
+package racing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// postPredictions serves body to GetPredictions over the analysis of the
+// test store
+func postPredictions(t *testing.T, body models.GetWinnerParams) (int, models.EventPredictionResponse) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	st, _ := newTestStore()
+	cfg := config.Default()
+	params := models.RaceParameters{EventDate: testEventDate, Profile: models.DefaultScoringProfile}
+	if err := RunAnalysis(context.Background(), st, cfg, params, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(st, config.NewManager("", cfg), nil, nil)
+	r := gin.New()
+	r.POST("/racing/predictions", h.GetPredictions)
+
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/racing/predictions", bytes.NewReader(encoded)))
+
+	var response struct {
+		Predictions models.EventPredictionResponse `json:"predictions"`
+	}
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, response.Predictions
+}
+
+func TestGetPredictions(t *testing.T) {
+	code, predictions := postPredictions(t, models.GetWinnerParams{EventDate: testEventDate, Region: "UK"})
+	if code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+
+	selections := predictions.Selections
+	if len(selections) != 2 {
+		t.Fatalf("got %d selections, want Alpha and Bravo", len(selections))
+	}
+	if selections[0].SelectionName != "Alpha" || selections[1].SelectionName != "Bravo" {
+		t.Errorf("got %s then %s, want the best scored first", selections[0].SelectionName, selections[1].SelectionName)
+	}
+	// Alpha has run, Bravo has no form line for the date yet
+	if selections[0].Position != "1/3" || selections[1].Position != "?" {
+		t.Errorf("got positions %q and %q", selections[0].Position, selections[1].Position)
+	}
+
+	// Without a plan the stakes are level ones of the configured bet value
+	if predictions.Staking.Plan != models.StakingLevel {
+		t.Errorf("got %s staking, want %s", predictions.Staking.Plan, models.StakingLevel)
+	}
+	for _, selection := range selections {
+		if selection.RecommendedStake != 10 {
+			t.Errorf("%s: recommended %g, want 10", selection.SelectionName, selection.RecommendedStake)
+		}
+	}
+
+	// Nothing is settled yet
+	if predictions.TotalBet != 0 || predictions.TotalReturn != 0 {
+		t.Errorf("got totals %g bet and %g returned before any result", predictions.TotalBet, predictions.TotalReturn)
+	}
+}
+
+func TestGetPredictionsStaking(t *testing.T) {
+	plan := &models.StakingPlan{Plan: models.StakingKelly, Bank: 100, KellyFraction: 0.5}
+	code, predictions := postPredictions(t, models.GetWinnerParams{EventDate: testEventDate, Region: "Both", Staking: plan})
+	if code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+
+	if predictions.Bank != 100 {
+		t.Errorf("got a bank of %g, want 100", predictions.Bank)
+	}
+	for _, selection := range predictions.Selections {
+		want := RecommendedStake(predictions.Staking, 100, selection.Odds, selection.WinProbability)
+		if selection.RecommendedStake != want {
+			t.Errorf("%s: recommended %g, want %g", selection.SelectionName, selection.RecommendedStake, want)
+		}
+	}
+}
+
+func TestGetPredictionsRegion(t *testing.T) {
+	code, predictions := postPredictions(t, models.GetWinnerParams{EventDate: testEventDate, Region: "Ireland"})
+	if code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+	if len(predictions.Selections) != 0 {
+		t.Errorf("got %d selections run in the UK for Ireland", len(predictions.Selections))
+	}
+}
+
+func TestGetPredictionsBadStaking(t *testing.T) {
+	plan := &models.StakingPlan{Plan: models.StakingPercentage, Percent: 150, Bank: 100}
+	code, _ := postPredictions(t, models.GetWinnerParams{EventDate: testEventDate, Region: "UK", Staking: plan})
+	if code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", code, http.StatusBadRequest)
+	}
+}
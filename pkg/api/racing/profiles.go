@@ -0,0 +1,93 @@
+package racing
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetScoringProfiles godoc
+// @Summary List scoring profiles
+// @Description List the scoring profiles POST /racing/analysis can score with
+// @Tags racing
+// @Produce  json
+// @Success 200 {object} object	"ok"
+// @Router /racing/scoring-profiles [get]
+func (h *Handler) GetScoringProfiles(c *gin.Context) {
+	profiles, err := h.Store.Analysis.ScoringProfiles(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profiles": profiles})
+}
+
+// GetScoringProfile godoc
+// @Summary Get a scoring profile
+// @Description Get the bands and weights of a scoring profile, those it does not set come from the default profile
+// @Tags racing
+// @Produce  json
+// @Param name path string true "Profile name"
+// @Success 200 {object} object	"ok"
+// @Router /racing/scoring-profiles/{name} [get]
+func (h *Handler) GetScoringProfile(c *gin.Context) {
+	name := c.Param("name")
+	constants, err := h.Store.Analysis.ScoringProfile(c, name)
+	if errors.Is(err, store.ErrUnknownProfile) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profile": name, "constants": constants})
+}
+
+// PutScoringProfile godoc
+// @Summary Save a scoring profile
+// @Description Replace the score_constants of a profile. Categories left out fall back to the default profile, which must set them all.
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param name path string true "Profile name"
+// @Param body body models.ScoringProfileUpdate true "Bands and weights of the profile"
+// @Success 200 {object} object	"ok"
+// @Router /admin/scoring-profiles/{name} [put]
+func (h *Handler) PutScoringProfile(c *gin.Context) {
+	var update models.ScoringProfileUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := c.Param("name")
+	constants := update.Constants
+	if name != models.DefaultScoringProfile {
+		defaults, err := h.Store.Analysis.ScoringProfile(c, models.DefaultScoringProfile)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		constants = mergeScoringProfile(defaults, constants)
+	}
+
+	// Nothing is saved unless the profile can score a runner
+	if _, err := NewScoringProfile(name, constants); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Store.Analysis.SaveScoringProfile(c, name, update.Constants); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profile": name, "constants": constants})
+}
@@ -1,25 +1,26 @@
 package racing
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 	"strconv"
-	"strings"
-	"time"
 
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gocolly/colly"
-	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/jobs"
 	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/settlement"
+	"github.com/mmanjoura/clean-bet-backend/pkg/source"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
 )
 
-// RacePicksSimulation handles the simulation of race picks and calculates win probabilities.
-func GetResults(c *gin.Context) {
-
-	db := database.Database.DB
-
+// GetResults settles a selection of the analysis against its finishing position and SP.
+func (h *Handler) GetResults(c *gin.Context) {
 	params := models.GetWinnerParams{}
 
 	// Bind JSON input to optimalParams
@@ -28,169 +29,129 @@ func GetResults(c *gin.Context) {
 		return
 	}
 
-	params.Stake = 10.0
-
-	rows, err := db.Query(`SELECT 	selection_id,
-									selection_name,
-									selection_link,
-									potential_return,
-									current_event_price,
-									current_event_position				
-									FROM Analysis
-									WHERE event_date = ?   AND  selection_id = ?`,
-		params.EventDate, params.SelectionId)
+	if params.Profile == "" {
+		params.Profile = models.DefaultScoringProfile
+	}
+
+	prediction, err := settleSelection(c, h.Source, h.Store, h.Config.Current(), params.EventDate, params.SelectionId, params.Profile)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("selection %d was not analysed for %s", params.SelectionId, params.EventDate)})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(sourceErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
-
-	var prediction models.EventPrediction
-	var potentialReturn, currentEventPrice, currentDistance sql.NullString
-	for rows.Next() {
-
-		if err := rows.Scan(
-			&prediction.SelectionID,
-			&prediction.SelectionName,
-			&prediction.SelectionLink,
-			&potentialReturn,
-			&currentEventPrice,
-			&currentDistance,
-		); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+
+	c.JSON(http.StatusOK, gin.H{"simulationResults": prediction})
+}
+
+// SettleResults settles the analysis of every selection of the date that has
+// no result yet, under each profile it was analysed with, from the results
+// read from src. Selections whose result cannot be read are logged and left
+// for the next run.
+func SettleResults(ctx context.Context, src source.RacingSource, st *store.Store, cfg *config.Config, date string, progress *jobs.Progress) error {
+	unsettled, err := st.Analysis.Unsettled(ctx, date)
+	if err != nil {
+		return err
+	}
+	progress.SetTotal(len(unsettled))
+
+	for _, analysis := range unsettled {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
+		_, err := settleSelection(ctx, src, st, cfg, date, analysis.SelectionID, analysis.Profile)
+		if errors.Is(err, errNoResult) {
+			log.Printf("Selection %d on %s left unsettled: %v", analysis.SelectionID, date, err)
+			progress.AddError(err)
+		} else if err != nil {
+			return err
+		}
+		progress.Done(1)
+	}
 
-		prediction.CurrentEventPrice = nullableToString(currentEventPrice)
+	return nil
+}
 
+// errNoResult wraps the errors of the source reading the result of a selection
+var errNoResult = errors.New("result not read")
+
+// settleSelection fetches the result of a selection analysed under profile
+// and stores its return at the starting price. The stake is the one of the analysis, or the
+// configured bet value for analyses saved without one. Each-way bets are
+// settled on the standard place terms of the field that ran, or else of the
+// declared field, handicap terms when the race type or the declared category
+// name a handicap. Selections whose result is not known yet, or whose price
+// does not read, are left unsettled. sql.ErrNoRows is returned for a
+// selection that was not analysed.
+func settleSelection(ctx context.Context, src source.RacingSource, st *store.Store, cfg *config.Config, eventDate string, selectionID int, profile string) (models.EventPrediction, error) {
+	prediction, err := st.Analysis.Selection(ctx, eventDate, selectionID, profile)
+	if err != nil {
+		return prediction, err
+	}
+	if prediction.SelectionID == 0 {
+		return prediction, sql.ErrNoRows
 	}
 
 	if prediction.CurrentEventPrice == "" {
-		config := database.Database.Config
-		stake, err := strconv.Atoi(config["bet_value"]) 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid bet value"})
-			return
+		if prediction.Stake == 0 {
+			prediction.Stake = float64(cfg.BetValue)
+			if prediction.BetType == models.BetTypeEachWay {
+				prediction.Stake *= 2
+			}
 		}
 
-		potentialReturn := 0
 		// now get the selection form and update Analysis
-		selectionForm, err := GetResult(prediction.SelectionLink, params.EventDate)
+		selectionForm, err := src.Result(prediction.SelectionLink, eventDate)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return prediction, fmt.Errorf("%w for selection %d on %s: %w", errNoResult, selectionID, eventDate, err)
 		}
-		prediction.CurrentEventPrice = selectionForm.SpOdds
-		prediction.EventDate = params.EventDate
 
-		prediction.CurrentEventPosition = selectionForm.Position
-
-		if strings.Contains(selectionForm.SpOdds, "/") && strings.Contains(selectionForm.Position, "/") {
-			num := strings.Split(selectionForm.SpOdds, "/")[0]
-			den := strings.Split(selectionForm.SpOdds, "/")[1]
-
-			pos := strings.Split(selectionForm.Position, "/")[0]
-
-			// convet the string to float
-			numFloat, _ := strconv.ParseFloat(num, 64)
-			denFloat, _ := strconv.ParseFloat(den, 64)
-			odds := numFloat / denFloat
-
-			// Calulate the potential return
-
-			if pos == "1" {
-				potentialReturn = stake * int(odds)
-				prediction.PotentialReturn = fmt.Sprintf("%.2f", float64(potentialReturn))
-			} else {
-				prediction.PotentialReturn = "0.00"
+		var result models.Settlement
+		if prediction.BetType == models.BetTypeEachWay {
+			placing, _ := settlement.ParsePlacing(selectionForm.Position)
+			runners := placing.Runners
+			if runners == 0 {
+				runners, _ = strconv.Atoi(prediction.NumRunners)
 			}
-
-			err = updateAnalysis(db, prediction)
+			var category string
+			category, err = raceCategory(ctx, st.Meetings, prediction, eventDate)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
+				return prediction, err
 			}
+			terms := settlement.StandardPlaceTerms(runners, settlement.IsHandicap(selectionForm.RaceType, category))
+			result, err = settlement.EachWay(prediction.Stake/2, selectionForm.SpOdds, selectionForm.Position, terms)
 		} else {
-			prediction.PotentialReturn = "0.00"
-			err = updateAnalysis(db, prediction)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
+			result, err = settlement.Win(prediction.Stake, selectionForm.SpOdds, selectionForm.Position)
+		}
+		if err != nil {
+			log.Printf("Selection %d on %s left unsettled: %v", selectionID, eventDate, err)
+			return prediction, nil
 		}
 
-	}
-	c.JSON(http.StatusOK, gin.H{"simulationResults": prediction})
-}
-
-func updateAnalysis(db *sql.DB, prediction models.EventPrediction) error {
-
-	// Start a transaction
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
+		prediction.CurrentEventPrice = selectionForm.SpOdds
+		prediction.CurrentEventPosition = selectionForm.Position
+		prediction.EventDate = eventDate
+		prediction.PlaceTerms = result.PlaceTerms
+		prediction.GrossReturn = result.GrossReturn
+		prediction.NetProfit = result.NetProfit
+		prediction.PotentialReturn = fmt.Sprintf("%.2f", result.GrossReturn)
 
-	defer func() {
+		err = st.Analysis.Settle(ctx, prediction)
 		if err != nil {
-			tx.Rollback() // Rollback the transaction in case of error
-		} else {
-			tx.Commit() // Commit the transaction if all goes well
+			return prediction, err
 		}
-	}()
-
-	// Step 2: INSERT new record
-	_, err = tx.Exec(`
-						Update Analysis
-						SET current_event_price = ?,
-						current_event_position = ?,
-						potential_return = ? where selection_id = ? and event_date = ?`,
-
-		prediction.CurrentEventPrice,
-		prediction.CurrentEventPosition,
-		prediction.PotentialReturn,
-		prediction.SelectionID, prediction.EventDate)
-	if err != nil {
-		return err
 	}
-	return nil
+	return prediction, nil
 }
 
-func GetResult(selectionLink string, eventDate string) (models.SelectionForm, error) {
-	c := colly.NewCollector()
-	config := database.Database.Config
-
-	// Slice to store all horse information
-	selectionForm := models.SelectionForm{}
-
-	// Now continue with the rest of your code to scrape other data
-	c.OnHTML("table.FormTable__StyledTable-sc-1xr7jxa-1 tbody tr", func(e *colly.HTMLElement) {
-		raceDate := e.ChildText("td:nth-child(1) a")
-		position := e.ChildText("td:nth-child(2)")
-		spOdds := e.ChildText("td:nth-child(9)")
-
-		// Split the date by "/" and add the current year
-		dateParts := strings.Split(raceDate, "/")
-		raceDate = "20" + dateParts[2] + "-" + dateParts[1] + "-" + dateParts[0]
-
-		// Convert raceDate to time.Time
-		parsedRaceDate, _ := time.Parse("2006-01-02", raceDate)
-		date, _ := time.Parse("2006-01-02", eventDate)
-
-		if parsedRaceDate.Equal(date) {
-			// Create a new SelectionsForm object with the scraped data
-			selectionForm = models.SelectionForm{
-
-				Position: position,
-				SpOdds:   spOdds,
-			}
-
-		}
-
-	})
-
-	// Start scraping the URL
-	c.Visit(config["DataLink"] + selectionLink)
-
-	return selectionForm, nil
+// raceCategory returns the category the race of an analysed selection was
+// declared with, empty when its runners were not stored
+func raceCategory(ctx context.Context, meetings store.MeetingStore, prediction models.EventPrediction, eventDate string) (string, error) {
+	selections, err := meetings.RaceSelections(ctx, prediction.EventName, prediction.EventTime, eventDate)
+	if err != nil || len(selections) == 0 {
+		return "", err
+	}
+	return selections[0].RaceCategory, nil
 }
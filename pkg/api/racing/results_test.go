@@ -0,0 +1,105 @@
+package racing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+)
+
+// newHandicapStore returns a store over three analysed runners of a 14
+// runner handicap on testEventDate, Alpha backed each way and the others to
+// win
+func newHandicapStore() (*store.Store, *memoryAnalysis) {
+	race := models.Selection{EventName: "York", EventDate: testEventDate, EventTime: "15:10", RaceCategory: "Class 3 Handicap", NumberOfRunners: "14 Runners"}
+	analyses := newMemoryAnalysis(nil, nil)
+
+	bets := []models.EventPrediction{
+		{SelectionID: 1, SelectionName: "Alpha", BetType: models.BetTypeEachWay, Stake: 20},
+		{SelectionID: 2, SelectionName: "Bravo", BetType: models.BetTypeWin, Stake: 10},
+		{SelectionID: 3, SelectionName: "Charlie", BetType: models.BetTypeWin, Stake: 10},
+	}
+	var selections []models.Selection
+	for i, bet := range bets {
+		bet.ID = i + 1
+		bet.SelectionLink = "/racing/profiles/horse/" + bet.SelectionName
+		bet.EventName, bet.EventTime, bet.EventDate = race.EventName, race.EventTime, testEventDate
+		bet.NumRunners = "14"
+		bet.Profile = models.DefaultScoringProfile
+		analyses.rows[analysisKey{bet.SelectionID, testEventDate, bet.Profile}] = bet
+
+		selection := race
+		selection.ID, selection.Name = bet.SelectionID, bet.SelectionName
+		selections = append(selections, selection)
+	}
+
+	return &store.Store{
+		Meetings: &memoryMeetings{selections: selections},
+		Analysis: analyses,
+	}, analyses
+}
+
+func TestSettleResults(t *testing.T) {
+	st, analyses := newHandicapStore()
+	src := &memorySource{
+		results: map[string]models.SelectionForm{
+			"/racing/profiles/horse/Alpha":   {Position: "3/14", SpOdds: "10/1", RaceType: "Flat"},
+			"/racing/profiles/horse/Charlie": {Position: "1/14", SpOdds: "2/1", RaceType: "Flat"},
+		},
+		failing: map[string]error{
+			"/racing/profiles/horse/Bravo": errors.New("connection reset"),
+		},
+	}
+
+	if err := SettleResults(context.Background(), src, st, config.Default(), testEventDate, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(src.fetched) != 3 {
+		t.Errorf("fetched %d results, want every selection after Bravo failed", len(src.fetched))
+	}
+
+	rows := analyses.analysed(testEventDate, models.DefaultScoringProfile)
+	tests := []struct {
+		name        string
+		selectionID int
+		price       string
+		grossReturn float64
+		terms       *models.PlaceTerms
+	}{
+		// 10 to win lost, 10 to place at a quarter of 10/1 for the first 3 of a big handicap
+		{"Alpha", 1, "10/1", 35, &models.PlaceTerms{Places: 3, Fraction: 4}},
+		{"Bravo", 2, "", 0, nil},
+		{"Charlie", 3, "2/1", 30, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := rows[tt.selectionID]
+			if row.CurrentEventPrice != tt.price {
+				t.Errorf("settled at %q, want %q", row.CurrentEventPrice, tt.price)
+			}
+			if row.GrossReturn != tt.grossReturn {
+				t.Errorf("returned %g, want %g", row.GrossReturn, tt.grossReturn)
+			}
+			if (row.PlaceTerms == nil) != (tt.terms == nil) || (tt.terms != nil && *row.PlaceTerms != *tt.terms) {
+				t.Errorf("settled on place terms %+v, want %+v", row.PlaceTerms, tt.terms)
+			}
+		})
+	}
+}
+
+func TestSettleSelectionNotAnalysed(t *testing.T) {
+	st, _ := newHandicapStore()
+	src := &memorySource{}
+
+	_, err := settleSelection(context.Background(), src, st, config.Default(), testEventDate, 99, models.DefaultScoringProfile)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("got %v, want %v", err, sql.ErrNoRows)
+	}
+	if len(src.fetched) != 0 {
+		t.Errorf("fetched %v for a selection that was not analysed", src.fetched)
+	}
+}
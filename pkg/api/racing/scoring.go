@@ -0,0 +1,306 @@
+package racing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
+)
+
+// AnalysisSeed returns the seed of the analysis of a date: the one requested,
+// or one derived from the date so that running the same day twice gives the
+// same scores
+func AnalysisSeed(seed int64, eventDate string) int64 {
+	if seed != 0 {
+		return seed
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(eventDate))
+	// Keep it positive so it is stored as is in an INTEGER column
+	return int64(hash.Sum64() >> 1)
+}
+
+// NewRand returns the random source of an analysis run, the same seed always
+// draws the same numbers
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewPCG(uint64(seed), 0))
+}
+
+// scoreNoise draws the random part of a score, zero unless the configuration
+// asks for some
+func scoreNoise(rng *rand.Rand, cfg *config.Config) float64 {
+	if rng == nil || cfg.ScoreNoise == 0 {
+		return 0
+	}
+	return cfg.ScoreNoise * (rng.Float64() - 0.5)
+}
+
+// Score components, each is a category of score_constants and an item of its
+// "weights" category
+const (
+	componentLastRunPositions    = "last_run_positions"
+	componentDaysSinceLastRun    = "days_since_last_run"
+	componentDistanceSuitability = "distance_suitability"
+	componentWinCount            = "win_count"
+	componentOdds                = "odds"
+	componentRaceClass           = "race_class"
+	componentAge                 = "age"
+
+	// componentNoise is the seeded noise of a score, saved with the other
+	// components but not part of the profiles
+	componentNoise = "noise"
+
+	weightsCategory = "weights"
+	otherwiseItem   = "otherwise"
+)
+
+var scoreComponents = []string{
+	componentLastRunPositions,
+	componentDaysSinceLastRun,
+	componentDistanceSuitability,
+	componentWinCount,
+	componentOdds,
+	componentRaceClass,
+	componentAge,
+}
+
+// band gives points to the values within limit
+type band struct {
+	limit  float64
+	points float64
+}
+
+// bands scores a value by the first band it falls in, otherwise when none
+type bands struct {
+	bands     []band
+	otherwise float64
+}
+
+// atMost scores value by the lowest limit it does not exceed
+func (b bands) atMost(value float64) float64 {
+	for _, band := range b.bands {
+		if value <= band.limit {
+			return band.points
+		}
+	}
+	return b.otherwise
+}
+
+// below scores value by the lowest limit it is under
+func (b bands) below(value float64) float64 {
+	for _, band := range b.bands {
+		if value < band.limit {
+			return band.points
+		}
+	}
+	return b.otherwise
+}
+
+// atLeast scores value by the highest limit it reaches
+func (b bands) atLeast(value float64) float64 {
+	for i := len(b.bands) - 1; i >= 0; i-- {
+		if value >= b.bands[i].limit {
+			return b.bands[i].points
+		}
+	}
+	return b.otherwise
+}
+
+// ScoringProfile holds the bands and weights a runner is scored with, read
+// from the score_constants of a profile
+type ScoringProfile struct {
+	Name string
+
+	lastRunPositions bands // average position, at most the limit
+	daysSinceLastRun bands // days, at most the limit
+	winRate          bands // wins per run, at least the limit
+	odds             bands // average decimal odds, below the limit
+	raceClass        bands // class, at most the limit
+	age              bands // years, at most the limit
+	noRuns           float64
+	sameDistance     float64
+	shorterDistance  float64
+	longerDistance   float64
+	weights          map[string]float64
+}
+
+// NewScoringProfile builds the profile name from its score_constants, every
+// component needs its bands and weight
+func NewScoringProfile(name string, constants []models.ScoreConstant) (*ScoringProfile, error) {
+	categories := make(map[string]map[string]float64)
+	for _, constant := range constants {
+		if categories[constant.Category] == nil {
+			categories[constant.Category] = make(map[string]float64)
+		}
+		categories[constant.Category][constant.Item] = constant.Score
+	}
+
+	var errs []error
+	item := func(category, item string) float64 {
+		score, ok := categories[category][item]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s has no %q item", category, item))
+		}
+		return score
+	}
+	limits := func(category string, exclude ...string) bands {
+		var b bands
+		b.otherwise = item(category, otherwiseItem)
+		for key, points := range categories[category] {
+			if key == otherwiseItem || slices.Contains(exclude, key) {
+				continue
+			}
+			limit, err := strconv.ParseFloat(key, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a limit", category, key))
+				continue
+			}
+			b.bands = append(b.bands, band{limit: limit, points: points})
+		}
+		sort.Slice(b.bands, func(i, j int) bool { return b.bands[i].limit < b.bands[j].limit })
+		return b
+	}
+
+	profile := &ScoringProfile{
+		Name:             name,
+		lastRunPositions: limits(componentLastRunPositions),
+		daysSinceLastRun: limits(componentDaysSinceLastRun),
+		winRate:          limits(componentWinCount, "no_runs"),
+		odds:             limits(componentOdds),
+		raceClass:        limits(componentRaceClass),
+		age:              limits(componentAge),
+		noRuns:           item(componentWinCount, "no_runs"),
+		sameDistance:     item(componentDistanceSuitability, "same"),
+		shorterDistance:  item(componentDistanceSuitability, "shorter"),
+		longerDistance:   item(componentDistanceSuitability, "longer"),
+		weights:          make(map[string]float64, len(scoreComponents)),
+	}
+	for _, component := range scoreComponents {
+		profile.weights[component] = item(weightsCategory, component)
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("scoring profile %q: %w", name, errors.Join(errs...))
+	}
+	return profile, nil
+}
+
+// LoadScoringProfile reads and builds a profile, the default one when name
+// is empty
+func LoadScoringProfile(ctx context.Context, analyses store.AnalysisStore, name string) (*ScoringProfile, error) {
+	if name == "" {
+		name = models.DefaultScoringProfile
+	}
+	constants, err := analyses.ScoringProfile(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return NewScoringProfile(name, constants)
+}
+
+// mergeScoringProfile returns the score_constants a profile saved with
+// constants would have, the categories it does not set come from defaults
+func mergeScoringProfile(defaults, constants []models.ScoreConstant) []models.ScoreConstant {
+	set := make(map[string]bool)
+	for _, constant := range constants {
+		set[constant.Category] = true
+	}
+
+	merged := append([]models.ScoreConstant(nil), constants...)
+	for _, constant := range defaults {
+		if !set[constant.Category] {
+			merged = append(merged, constant)
+		}
+	}
+	return merged
+}
+
+// bandCategories returns the bands of the profile keyed by category
+func (p *ScoringProfile) bandCategories() map[string]*bands {
+	return map[string]*bands{
+		componentLastRunPositions: &p.lastRunPositions,
+		componentDaysSinceLastRun: &p.daysSinceLastRun,
+		componentWinCount:         &p.winRate,
+		componentOdds:             &p.odds,
+		componentRaceClass:        &p.raceClass,
+		componentAge:              &p.age,
+	}
+}
+
+// clone returns a copy of the profile named name, changing it leaves p as is
+func (p *ScoringProfile) clone(name string) *ScoringProfile {
+	c := *p
+	c.Name = name
+	c.weights = maps.Clone(p.weights)
+	for _, b := range c.bandCategories() {
+		b.bands = slices.Clone(b.bands)
+	}
+	return &c
+}
+
+// scaleLimits multiplies the limits of the bands of category by factor
+func (p *ScoringProfile) scaleLimits(category string, factor float64) {
+	b := p.bandCategories()[category]
+	for i := range b.bands {
+		b.bands[i].limit = math.Round(b.bands[i].limit*factor*1000) / 1000
+	}
+}
+
+// Constants returns the score_constants of the profile, every category set
+func (p *ScoringProfile) Constants() []models.ScoreConstant {
+	var constants []models.ScoreConstant
+	for category, b := range p.bandCategories() {
+		for _, band := range b.bands {
+			constants = append(constants, models.ScoreConstant{Category: category, Item: strconv.FormatFloat(band.limit, 'f', -1, 64), Score: band.points})
+		}
+		constants = append(constants, models.ScoreConstant{Category: category, Item: otherwiseItem, Score: b.otherwise})
+	}
+	constants = append(constants,
+		models.ScoreConstant{Category: componentWinCount, Item: "no_runs", Score: p.noRuns},
+		models.ScoreConstant{Category: componentDistanceSuitability, Item: "same", Score: p.sameDistance},
+		models.ScoreConstant{Category: componentDistanceSuitability, Item: "shorter", Score: p.shorterDistance},
+		models.ScoreConstant{Category: componentDistanceSuitability, Item: "longer", Score: p.longerDistance},
+	)
+	for component, weight := range p.weights {
+		constants = append(constants, models.ScoreConstant{Category: weightsCategory, Item: component, Score: weight})
+	}
+
+	sort.Slice(constants, func(i, j int) bool {
+		if constants[i].Category != constants[j].Category {
+			return constants[i].Category < constants[j].Category
+		}
+		return constants[i].Item < constants[j].Item
+	})
+	return constants
+}
+
+// winProbabilities turns the scores of the runners of a race into chances of
+// winning that add up to 1, the softmax of scale times the scores
+func winProbabilities(scores []float64, scale float64) []float64 {
+	probabilities := make([]float64, len(scores))
+	if len(scores) == 0 {
+		return probabilities
+	}
+
+	// Shift by the top score so exp does not overflow
+	top := slices.Max(scores)
+	total := 0.0
+	for i, score := range scores {
+		probabilities[i] = math.Exp(scale * (score - top))
+		total += probabilities[i]
+	}
+	for i := range probabilities {
+		probabilities[i] /= total
+	}
+	return probabilities
+}
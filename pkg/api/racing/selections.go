@@ -1,7 +1,8 @@
 package racing
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
@@ -11,15 +12,13 @@ import (
 	"time"
 
 	"github.com/mmanjoura/clean-bet-backend/pkg/api/common"
-	"github.com/mmanjoura/clean-bet-backend/pkg/database"
 	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
 
 	"github.com/gin-gonic/gin"
 )
 
-func GetSelections(c *gin.Context) {
-	db := database.Database.DB
-
+func (h *Handler) GetSelections(c *gin.Context) {
 	analysisDataResponse := models.AnalysisDataResponse{}
 
 	meetingName := c.Query("meeting_name")
@@ -29,74 +28,22 @@ func GetSelections(c *gin.Context) {
 	// eventName 	:= c.Query("event_name")
 
 	// Get today's runners for the given event_name and event_date
-	rows, err := db.Query(`
-		SELECT selection_id,
-			selection_name,
-			event_name,
-			event_date,
-			event_time,
-			race_distance,
-			race_category,
-			track_condition,
-			number_of_runners,
-			race_track,
-			race_class
-		FROM Meetings WHERE  
-			event_name = ? and event_time = ? and DATE(event_date) = ? `,
-		meetingName, eventTime, eventDate)
+	raceSelections, err := h.Store.Meetings.RaceSelections(c, meetingName, eventTime, eventDate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
 
 	var analysisData []models.AnalysisData
 	var selections []models.Selection
-	for rows.Next() {
-		var selection models.Selection
-		// Use sql.NullString for nullable fields
-		var selectionName, meetingName, eventDate, eventTime, raceDistance, raceCategory, trackCondition, numberOfRunners, raceTrack, raceClass sql.NullString
-
-		err := rows.Scan(
-			&selection.ID,
-			&selectionName,
-			&meetingName,
-			&eventDate,
-			&eventTime,
-			&raceDistance,
-			&raceCategory,
-			&trackCondition,
-			&numberOfRunners,
-			&raceTrack,
-			&raceClass,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	for _, selection := range raceSelections {
 		if selection.ID == 0 {
 			continue
 		}
-
-		var distance string
-		if raceDistance.Valid {
-			distance = common.ConvertDistance(raceDistance.String)
-		} else {
-			distance = "" // or any default value you want to assign
+		if selection.RaceDistance != "" {
+			selection.RaceDistance = common.ConvertDistance(selection.RaceDistance)
 		}
-		// Convert sql.NullString to regular strings
-		selection.Name = nullableToString(selectionName)
-		selection.EventName = nullableToString(meetingName)
-		selection.EventDate = nullableToString(eventDate)
-		selection.EventTime = nullableToString(eventTime)
-		selection.RaceDistance = distance
-		selection.RaceCategory = nullableToString(raceCategory)
-		selection.TrackCondition = nullableToString(trackCondition)
-		selection.NumberOfRunners = nullableToString(numberOfRunners)
-		selection.RaceTrack = nullableToString(raceTrack)
-		selection.RaceClass = nullableToString(raceClass)
 		selections = append(selections, selection)
-
 	}
 	raceConditon := models.RaceConditon{}
 	if len(selections) > 0 {
@@ -113,91 +60,34 @@ func GetSelections(c *gin.Context) {
 
 	for _, selection := range selections {
 
-		// Execute the query
-		rows, err = db.Query(`
-						SELECT
-							COALESCE(selection_id, 0),
-							selection_name,	
-							substr(position, 1, 1) as positon, 
-							Age,
-							Trainer,
-							Sex,
-							Sire,
-							Dam,
-							Owner,						
-							COUNT(*) AS num_runs,
-							MAX(race_date) AS last_run_date,
-							MAX(race_date) - MIN(race_date) AS duration,
-							 COUNT(CASE WHEN position = '1' THEN 1 END) AS win_count,
-							AVG(position) AS avg_position,
-							AVG(rating) AS avg_rating,
-							AVG(distance) AS avg_distance_furlongs,
-							AVG(sp_odds) AS sp_odds,
-							GROUP_CONCAT(position, ', ') AS all_positions,
-							GROUP_CONCAT(distance, ', ') AS all_distances,
-							GROUP_CONCAT(racecourse, ', ') AS all_racecources,
-							GROUP_CONCAT(DATE(race_date), ', ') AS all_race_dates 
-						FROM
-							Forms	WHERE selection_id = ?  order by race_date desc`, selection.ID)
+		data, err := h.Store.Forms.Summary(c, selection.ID, "")
+		if errors.Is(err, store.ErrNoForm) {
+			continue
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		defer rows.Close()
-
-		// Loop through the rows and append the results to the slice
-		var data models.AnalysisData
-		noData := false
-
-		for rows.Next() {
-			noData = false
-			err := rows.Scan(
-				&data.SelectionID,
-				&data.SelectionName,
-				&data.Position,
-				&data.Age,
-				&data.Trainer,
-				&data.Sex,
-				&data.Sire,
-				&data.Dam,
-				&data.Owner,
-				&data.NumRuns,
-				&data.LastRunDate,
-				&data.Duration,
-				&data.WinCount,
-				&data.AvgPosition,
-				&data.AvgRating,
-				&data.AvgDistanceFurlongs,
-				&data.AvgOdds,
-				&data.AllPositions,
-				&data.AllDistances,
-				&data.AllCources,
-				&data.AllRaceDates,
-			)
-			if err != nil {
-				noData = true
-				continue
-			}
-		}
-		if !noData {
-
-			winLose, err := getRaceResult(rows, err, db, eventDate, c, selection.ID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			data.WinLose = winLose
 
-			analysisData = append(analysisData, data)
+		// Only the first digit of the latest position is shown
+		if len(data.Position) > 1 {
+			data.Position = data.Position[:1]
+		}
 
+		winLose, err := h.Store.Forms.Result(c, selection.ID, eventDate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
+		data.WinLose = winLose
+
+		analysisData = append(analysisData, data)
 	}
 
 	for i, data := range analysisData {
 
-		recoveryDays, err := getRecoveryDays(data.SelectionID, eventDate)
+		recoveryDays, err := getRecoveryDays(c, h.Store.Forms, data.SelectionID, eventDate)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -221,12 +111,6 @@ func GetSelections(c *gin.Context) {
 
 	}
 
-	// Check for errors from iterating over rows.
-	if err = rows.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
 	// Sorting logic
 	sort.Slice(analysisData, func(i, j int) bool {
 		// Sort by winner positions (1, 2, 3) first
@@ -256,24 +140,24 @@ func GetSelections(c *gin.Context) {
 	analysisDataResponse.Selections = analysisData
 
 	// Get the total bet value for UK and Ireland
-	totalBetUK, err := getUkBetValue(db, c)
+	totalBetUK, err := h.Store.Analysis.TotalBet(c, "UK")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	totalBetIreland, err := getIrelandBetValue(db, c)
+	totalBetIreland, err := h.Store.Analysis.TotalBet(c, "Ireland")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Get the total return value for UK and Ireland
-	totalReturnUK, err := getUkReturn(db, c)
+	totalReturnUK, err := h.Store.Analysis.TotalReturn(c, "UK")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	totalReturnIreland, err := getIrelandReturn(db, c)
+	totalReturnIreland, err := h.Store.Analysis.TotalReturn(c, "Ireland")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -281,77 +165,19 @@ func GetSelections(c *gin.Context) {
 
 	analysisDataResponse.UkBetValue = totalBetUK
 	analysisDataResponse.UKReturn = totalReturnUK
+	analysisDataResponse.UKProfit = roundMoney(totalReturnUK - totalBetUK)
 	analysisDataResponse.IrelandBetValue = totalBetIreland
 	analysisDataResponse.IrelandReturn = totalReturnIreland
+	analysisDataResponse.IrelandProfit = roundMoney(totalReturnIreland - totalBetIreland)
 
 
 	// Return the meeting data
 	c.JSON(http.StatusOK, gin.H{"analysisDataResponse": analysisDataResponse})
 }
 
-func getRaceResult(rows *sql.Rows, err error, db *sql.DB, eventDate string, c *gin.Context, selectionID int) (models.WinLose, error) {
-	rows, err = db.Query(`
-		SELECT 	selection_id,
-				selection_name,
-				race_date,
-				SUBSTR(position, 1, INSTR(position, '/') - 1) as postion
-		FROM Forms
-		WHERE DATE(race_date) = ? and selection_id = ?`, eventDate, selectionID)
+func getRecoveryDays(ctx context.Context, forms store.FormStore, selectionID int, eventDate string) (float64, error) {
+	daysSince, err := forms.LastRuns(ctx, selectionID, 2)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return models.WinLose{}, err
-	}
-	defer rows.Close()
-	var data models.WinLose
-	for rows.Next() {
-		err := rows.Scan(
-			&data.SelectionID,
-			&data.SelectionName,
-			&data.EventDate,
-			&data.Position,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return models.WinLose{}, err
-		}
-
-	}
-	return data, nil
-}
-
-func getRecoveryDays(selectionID int, eventDate string) (float64, error) {
-	db := database.Database.DB
-
-	// Execute the query with WITH daysSince as subquery
-	rows, err := db.Query(`
-		select 	race_date, 
-				selection_id from   
-		Forms where selection_id = ? 
-		order by race_date DESC limit 2;
-	`, selectionID)
-
-	if err != nil {
-		return 0, err
-	}
-	defer rows.Close()
-
-	var daysSince []models.DaySince
-
-	// Iterate over the rows and scan the result into the DaySince struct
-	for rows.Next() {
-		var race models.DaySince
-		err := rows.Scan(
-			&race.RaceDate,
-			&race.SelectionID,
-		)
-		if err != nil {
-			return 0, err
-		}
-		daysSince = append(daysSince, race)
-	}
-
-	// Check for errors after iterating through the rows
-	if err = rows.Err(); err != nil {
 		return 0, err
 	}
 
@@ -442,62 +268,3 @@ func average(values []float64) float64 {
 	}
 	return sum / float64(len(values))
 }
-
-func getUkBetValue(db *sql.DB, c *gin.Context) (float64, error) {
-
-	var totalBet float64
-	err := db.QueryRow(`
-		SELECT count(*) * 10
-		FROM Analysis
-		WHERE potential_return IS NOT NULL
-		AND event_name IN (SELECT event_name FROM Events WHERE country = 'UK')`).Scan(&totalBet)
-	if err != nil {
-
-		return 0.0, err
-	}
-
-	return totalBet, nil
-}
-
-func getIrelandBetValue(db *sql.DB, c *gin.Context) (float64, error) {
-
-	var totalBet float64
-	err := db.QueryRow(`
-		SELECT count(*) * 10
-		FROM Analysis
-		WHERE potential_return IS NOT NULL
-		AND event_name IN (SELECT event_name FROM Events WHERE country = 'Ireland')`).Scan(&totalBet)
-	if err != nil {
-		return 0.0, err
-	}
-
-	return totalBet, nil
-}
-
-func getUkReturn(db *sql.DB, c *gin.Context) (float64, error) {
-	
-	var totalReturn float64
-	err := db.QueryRow(`
-		SELECT sum(potential_return)
-		FROM Analysis
-		WHERE event_name IN (SELECT event_name FROM Events WHERE country = 'UK')`).Scan(&totalReturn)
-	if err != nil {
-		// return 0.0, err
-	}
-
-	return totalReturn, nil
-}
-
-func getIrelandReturn(db *sql.DB, c *gin.Context) (float64, error) {
-
-	var totalReturn float64
-	err := db.QueryRow(`
-		SELECT sum(potential_return)
-		FROM Analysis
-		WHERE event_name IN (SELECT event_name FROM Events WHERE country = 'Ireland')`).Scan(&totalReturn)
-	if err != nil {
-		// return 0.0, err
-	}
-
-	return totalReturn, nil
-}
\ No newline at end of file
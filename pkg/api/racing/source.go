@@ -0,0 +1,18 @@
+package racing
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/source"
+)
+
+// sourceErrorStatus maps an error from the data source to a response status,
+// pages that stopped yielding rows are reported as a bad gateway.
+func sourceErrorStatus(err error) int {
+	var zeroRows *source.ZeroRowsError
+	if errors.As(err, &zeroRows) {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,163 @@
+package racing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/odds"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StakingDefaults validates a staking plan and fills in the defaults of what
+// it leaves out: level stakes of the configured bet value and full Kelly
+func StakingDefaults(plan models.StakingPlan, cfg *config.Config) (models.StakingPlan, error) {
+	switch plan.Plan {
+	case "", models.StakingLevel:
+		plan.Plan = models.StakingLevel
+		if plan.Stake == 0 {
+			plan.Stake = float64(cfg.BetValue)
+		}
+		if plan.Stake < 0 {
+			return plan, fmt.Errorf("stake must be positive, got %g", plan.Stake)
+		}
+	case models.StakingPercentage:
+		if plan.Percent <= 0 || plan.Percent > 100 {
+			return plan, fmt.Errorf("percent must be within (0, 100], got %g", plan.Percent)
+		}
+		if plan.Bank <= 0 {
+			return plan, fmt.Errorf("bank must be positive, got %g", plan.Bank)
+		}
+	case models.StakingKelly:
+		if plan.KellyFraction == 0 {
+			plan.KellyFraction = 1
+		}
+		if plan.KellyFraction < 0 || plan.KellyFraction > 1 {
+			return plan, fmt.Errorf("kelly_fraction must be within (0, 1], got %g", plan.KellyFraction)
+		}
+		if plan.Bank <= 0 {
+			return plan, fmt.Errorf("bank must be positive, got %g", plan.Bank)
+		}
+	default:
+		return plan, fmt.Errorf("unknown staking %q, want %s, %s or %s", plan.Plan, models.StakingLevel, models.StakingPercentage, models.StakingKelly)
+	}
+
+	if plan.MaxStake < 0 {
+		return plan, fmt.Errorf("max_stake must not be negative, got %g", plan.MaxStake)
+	}
+	return plan, nil
+}
+
+// RecommendedStake returns the stake plan puts on a selection to win at price
+// with a bank of bank. Kelly stakes the fraction of the bank of the edge of
+// probability over the price, (b*p - (1 - p)) / b at odds of b to 1, and
+// nothing on runners with no edge or no price. Stakes are capped at MaxStake.
+func RecommendedStake(plan models.StakingPlan, bank float64, price string, probability float64) float64 {
+	var stake float64
+	switch plan.Plan {
+	case models.StakingLevel:
+		stake = plan.Stake
+	case models.StakingPercentage:
+		stake = bank * plan.Percent / 100
+	case models.StakingKelly:
+		o, err := odds.Parse(price)
+		if err != nil {
+			return 0
+		}
+		toOne := o.ToOne()
+		stake = bank * plan.KellyFraction * (toOne*probability - (1 - probability)) / toOne
+	}
+
+	if stake <= 0 {
+		return 0
+	}
+	if plan.MaxStake > 0 {
+		stake = min(stake, plan.MaxStake)
+	}
+	return roundMoney(stake)
+}
+
+// userStakingPlan returns the saved staking plan of a user with its bank
+// grown by the profit of the user's settled bets. ok is false when the user
+// saved no plan.
+func (h *Handler) userStakingPlan(ctx context.Context, userID int) (plan models.StakingPlan, bank float64, ok bool, err error) {
+	plan, err = h.Store.Bets.StakingPlan(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return plan, 0, false, nil
+	}
+	if err != nil {
+		return plan, 0, false, err
+	}
+
+	bets, err := h.Store.Bets.List(ctx, userID, "", "", "")
+	if err != nil {
+		return plan, 0, false, err
+	}
+	return plan, BankrollSeries(plan.Bank, bets).Balance, true, nil
+}
+
+// GetStakingPlan godoc
+// @Summary The user's staking plan
+// @Description Get the staking plan that sizes the recommended stakes of the user's predictions, level stakes of the configured bet value until one is saved, and its bank grown by the profit of the user's settled bets
+// @Tags bets
+// @Produce  json
+// @Success 200 {object} models.StakingPlan "ok"
+// @Router /staking [get]
+func (h *Handler) GetStakingPlan(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	plan, bank, ok, err := h.userStakingPlan(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		plan, _ = StakingDefaults(models.StakingPlan{}, h.Config.Current())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"staking": plan, "bank": bank})
+}
+
+// PutStakingPlan godoc
+// @Summary Save the user's staking plan
+// @Description Save the staking plan that sizes the recommended stakes of the user's predictions: level, percentage of the bank or a fraction of Kelly, capped at max_stake
+// @Tags bets
+// @Accept  json
+// @Produce  json
+// @Param body body models.StakingPlan true "Staking plan"
+// @Success 200 {object} models.StakingPlan "ok"
+// @Router /staking [put]
+func (h *Handler) PutStakingPlan(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var plan models.StakingPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	plan, err := StakingDefaults(plan, h.Config.Current())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Store.Bets.SaveStakingPlan(c, user.ID, plan); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"staking": plan})
+}
@@ -0,0 +1,133 @@
+package racing
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/odds"
+
+	"github.com/gin-gonic/gin"
+)
+
+// marketPrice is the declared price of a runner and the overround of its race
+type marketPrice struct {
+	price     string
+	odds      float64
+	overround float64
+}
+
+// marketPrices returns the decimal odds of the analysed runners of a race
+// day with the overround of their race, the sum of the probabilities implied
+// by their prices. The win probabilities of a race are shared between the
+// runners with form, so the market is taken over the same runners: those
+// without form, non-runners and runners without a price are left out of it.
+func marketPrices(runners []models.MeetingSelections, analysed []models.EventPrediction) map[int]marketPrice {
+	scored := make(map[int]bool, len(analysed))
+	for _, runner := range analysed {
+		scored[runner.SelectionID] = true
+	}
+
+	prices := make(map[int]marketPrice, len(runners))
+	overrounds := make(map[string]float64)
+	for _, runner := range runners {
+		if !scored[runner.SelectionID] {
+			continue
+		}
+		o, err := odds.Parse(runner.Price)
+		if err != nil {
+			continue
+		}
+		prices[runner.SelectionID] = marketPrice{price: runner.Price, odds: o.Decimal()}
+		overrounds[runner.EventName+" "+runner.EventTime] += o.ImpliedProbability()
+	}
+	for _, runner := range runners {
+		if price, ok := prices[runner.SelectionID]; ok {
+			price.overround = overrounds[runner.EventName+" "+runner.EventTime]
+			prices[runner.SelectionID] = price
+		}
+	}
+	return prices
+}
+
+// ValueBets compares the win probabilities of the analysed runners with the
+// declared prices of their race and returns those worth backing: a positive
+// expected value at the price and a win probability at least edge above the
+// market's, best edge first
+func ValueBets(runners []models.MeetingSelections, analysed []models.EventPrediction, edge float64) []models.ValueBet {
+	prices := marketPrices(runners, analysed)
+
+	bets := []models.ValueBet{}
+	for _, runner := range analysed {
+		price, ok := prices[runner.SelectionID]
+		if !ok {
+			continue
+		}
+
+		implied := 1 / price.odds
+		market := implied / price.overround
+		bet := models.ValueBet{
+			SelectionID:        runner.SelectionID,
+			SelectionName:      runner.SelectionName,
+			EventName:          runner.EventName,
+			EventDate:          runner.EventDate,
+			EventTime:          runner.EventTime,
+			Profile:            runner.Profile,
+			CleanBetScore:      runner.CleanBetScore,
+			Price:              price.price,
+			DecimalOdds:        math.Round(price.odds*1e4) / 1e4,
+			Overround:          math.Round(price.overround*1e4) / 1e4,
+			ImpliedProbability: math.Round(implied*1e4) / 1e4,
+			MarketProbability:  math.Round(market*1e4) / 1e4,
+			WinProbability:     runner.WinProbability,
+			ExpectedValue:      math.Round((runner.WinProbability*price.odds-1)*1e4) / 1e4,
+			Edge:               math.Round((runner.WinProbability/market-1)*1e4) / 1e4,
+		}
+		if bet.ExpectedValue > 0 && bet.Edge >= edge {
+			bets = append(bets, bet)
+		}
+	}
+
+	sort.SliceStable(bets, func(i, j int) bool {
+		return bets[i].Edge > bets[j].Edge
+	})
+	return bets
+}
+
+// GetValueBets godoc
+// @Summary Value bets of a race day
+// @Description Get the runners whose win probability beats the probability implied by their declared price, with the overround of the analysed runners of the race removed, by at least the configured value_edge
+// @Tags racing
+// @Produce  json
+// @Param date query string true "Event date"
+// @Param profile query string false "Scoring profile, default when empty"
+// @Success 200 {array} models.ValueBet "ok"
+// @Router /racing/value-bets [get]
+func (h *Handler) GetValueBets(c *gin.Context) {
+	eventDate := c.Query("date")
+	if _, err := time.Parse("2006-01-02", eventDate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+		return
+	}
+	profile := c.DefaultQuery("profile", models.DefaultScoringProfile)
+
+	runners, err := h.Store.Meetings.Runners(c, eventDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	analysed, err := h.Store.Analysis.Probabilities(c, eventDate, profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range analysed {
+		analysed[i].Profile = profile
+	}
+
+	bets := ValueBets(runners, analysed, h.Config.Current().ValueEdge)
+
+	c.JSON(http.StatusOK, gin.H{"value_bets": bets})
+}
@@ -0,0 +1,40 @@
+package racing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// TestValueBetsScoredRunners takes the market over the runners the win
+// probabilities were shared between, leaving out the one without form
+func TestValueBetsScoredRunners(t *testing.T) {
+	race := models.MeetingSelections{EventName: "Ascot", EventTime: "14:00"}
+	alpha, bravo, charlie := race, race, race
+	alpha.SelectionID, alpha.Price = 1, "1/1"
+	bravo.SelectionID, bravo.Price = 2, "3/1"
+	charlie.SelectionID, charlie.Price = 3, "2/1"
+
+	analysed := []models.EventPrediction{
+		{SelectionID: 1, SelectionName: "Alpha", EventName: "Ascot", EventTime: "14:00", WinProbability: 0.6},
+		{SelectionID: 2, SelectionName: "Bravo", EventName: "Ascot", EventTime: "14:00", WinProbability: 0.4},
+	}
+
+	bets := ValueBets([]models.MeetingSelections{alpha, bravo, charlie}, analysed, -1)
+	if len(bets) != 2 {
+		t.Fatalf("got %d value bets, want Alpha and Bravo", len(bets))
+	}
+
+	// 1/2 + 1/4 without Charlie's 1/3
+	total := 0.0
+	for _, bet := range bets {
+		if bet.Overround != 0.75 {
+			t.Errorf("%s: got an overround of %g, want 0.75", bet.SelectionName, bet.Overround)
+		}
+		total += bet.MarketProbability
+	}
+	if math.Abs(total-1) > 1e-3 {
+		t.Errorf("market probabilities add up to %g, want 1 like the win probabilities", total)
+	}
+}
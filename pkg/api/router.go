@@ -3,9 +3,15 @@ package api
 import (
 	"time"
 
+	"github.com/mmanjoura/clean-bet-backend/pkg/api/admin"
 	"github.com/mmanjoura/clean-bet-backend/pkg/api/racing"
 	"github.com/mmanjoura/clean-bet-backend/pkg/auth"
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/jobs"
 	"github.com/mmanjoura/clean-bet-backend/pkg/middleware"
+	"github.com/mmanjoura/clean-bet-backend/pkg/scheduler"
+	"github.com/mmanjoura/clean-bet-backend/pkg/source"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
@@ -16,8 +22,15 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
-// InitRouter initializes the routes for the API
-func InitRouter() *gin.Engine {
+// InitRouter initializes the routes for the API, handlers read and write
+// through st, read the configuration in force from cfg and the racing data
+// from src, run background jobs through jobManager and report the runs of
+// pipeline
+func InitRouter(st *store.Store, cfg *config.Manager, src source.RacingSource, jobManager *jobs.Manager, pipeline *scheduler.Scheduler) *gin.Engine {
+	racingHandler := racing.NewHandler(st, cfg, src, jobManager)
+	authHandler := auth.NewHandler(st.Users, cfg)
+	adminHandler := admin.NewHandler(st, cfg)
+
 	r := gin.Default()
 	r.Use(gin.Logger())
 	r.Use(middleware.Cors())
@@ -28,18 +41,51 @@ func InitRouter() *gin.Engine {
 	{
 		v1.GET("/docs/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 		// Auth routes
-		v1.POST("/auth/login", auth.LoginHandler)
-		v1.POST("/auth/register", auth.RegisterHandler)
+		v1.POST("/auth/login", authHandler.LoginHandler)
+		v1.POST("/auth/register", authHandler.RegisterHandler)
 		v1.POST("/auth/logout", auth.Logout)
 
 		// meeting routes
-		v1.GET("/racing/events", racing.GetEvents)
-		v1.GET("/racing/selections", racing.GetSelections)
-		v1.POST("/racing/meetings", racing.GetMeetings)
-		v1.POST("/racing/analysis", racing.DoAnalysis)
-		v1.POST("/racing/results", racing.GetResults)
-		v1.POST("/racing/forms", racing.GetForms)
-		v1.POST("/racing/predictions", racing.GetPredictions)
+		v1.GET("/racing/events", racingHandler.GetEvents)
+		v1.GET("/racing/selections", racingHandler.GetSelections)
+		v1.POST("/racing/meetings", racingHandler.GetMeetings)
+		v1.POST("/racing/analysis", racingHandler.DoAnalysis)
+		v1.GET("/racing/analysis/:selection_id/breakdown", racingHandler.GetAnalysisBreakdown)
+		v1.POST("/racing/results", racingHandler.GetResults)
+		v1.POST("/racing/forms", racingHandler.GetForms)
+		v1.POST("/racing/predictions", middleware.OptionalJWTAuth(st.Users, cfg), racingHandler.GetPredictions)
+		v1.GET("/racing/calibration", racingHandler.GetCalibration)
+		v1.GET("/racing/value-bets", racingHandler.GetValueBets)
+		v1.GET("/racing/scoring-profiles", racingHandler.GetScoringProfiles)
+		v1.GET("/racing/scoring-profiles/:name", racingHandler.GetScoringProfile)
+
+		// backtest routes, only authenticated users start one
+		v1.POST("/backtests", middleware.JWTAuth(st.Users, cfg), racingHandler.PostBacktest)
+		v1.GET("/backtests", racingHandler.GetBacktests)
+		v1.GET("/backtests/:id", racingHandler.GetBacktest)
+
+		// bet routes, the bets of the authenticated user
+		betRoutes := v1.Group("", middleware.JWTAuth(st.Users, cfg))
+		betRoutes.POST("/bets", racingHandler.PostBet)
+		betRoutes.GET("/bets", racingHandler.GetBets)
+		betRoutes.POST("/bets/settle", racingHandler.PostSettleBets)
+		betRoutes.GET("/bankroll", racingHandler.GetBankroll)
+		betRoutes.GET("/staking", racingHandler.GetStakingPlan)
+		betRoutes.PUT("/staking", racingHandler.PutStakingPlan)
+
+		// job routes
+		v1.GET("/jobs/:id", jobManager.GetJob)
+
+		// pipeline routes
+		v1.GET("/pipeline/days", pipeline.GetPipelineDays)
+
+		// admin routes
+		adminRoutes := v1.Group("/admin", middleware.JWTAuth(st.Users, cfg), middleware.RequireAdmin())
+		adminRoutes.GET("/config", adminHandler.GetConfig)
+		adminRoutes.PUT("/config", adminHandler.PutConfig)
+		adminRoutes.GET("/config/audit", adminHandler.GetConfigAudit)
+		adminRoutes.PUT("/scoring-profiles/:name", racingHandler.PutScoringProfile)
+		adminRoutes.POST("/scoring-profiles/:name/optimise", racingHandler.PostOptimise)
 	}
 
 	return r
@@ -7,8 +7,9 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
 	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
 
 	"database/sql"
 
@@ -23,7 +24,16 @@ type Claims struct {
 	jwt.StandardClaims
 }
 
-var JwtKey = []byte("k1U6pO+9qZteWy+yE52Z56qSBqmJ1orl27r/28AfkIA=")
+// Handler serves the auth routes
+type Handler struct {
+	Users  store.UserStore
+	Config *config.Manager
+}
+
+// NewHandler returns a Handler looking users up in users
+func NewHandler(users store.UserStore, cfg *config.Manager) *Handler {
+	return &Handler{Users: users, Config: cfg}
+}
 
 // LoginHandler godoc
 // @Summary Login
@@ -34,12 +44,9 @@ var JwtKey = []byte("k1U6pO+9qZteWy+yE52Z56qSBqmJ1orl27r/28AfkIA=")
 // @Param body body models.SignIn true "User credentials"
 // @Success 200 {object} object	"ok"
 // @Router /login [post]
-func LoginHandler(c *gin.Context) {
+func (h *Handler) LoginHandler(c *gin.Context) {
 	var incomingUser models.SignIn
-	var dbUser models.User
-	db := database.Database.DB
-	config := database.Database.Config
-	JwtKey := config["JWT-API-KEY"]
+	JwtKey := h.Config.Current().JWTKey
 	// Get JSON body
 	if err := c.ShouldBindJSON(&incomingUser); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Bad Request"})
@@ -47,9 +54,7 @@ func LoginHandler(c *gin.Context) {
 	}
 
 	// Fetch the user from the database
-	err := db.QueryRow("SELECT id, full_name, email, password, phone_number, user_type, profile, avatar_url, Created_At, Updated_At FROM users WHERE email = ?", incomingUser.Email).
-		Scan(&dbUser.ID, &dbUser.FullName, &dbUser.Email, &dbUser.Password, &dbUser.PhoneNumber, &dbUser.UserType, &dbUser.Profile, &dbUser.AvatarUrl, &dbUser.CreatedAt, &dbUser.UpdatedAt)
-
+	dbUser, err := h.Users.ByEmail(c, incomingUser.Email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
@@ -66,7 +71,7 @@ func LoginHandler(c *gin.Context) {
 	}
 
 	// Generate JWT token
-	token, err := GenerateToken(dbUser.Email)
+	token, err := h.GenerateToken(dbUser.Email)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
 		return
@@ -90,9 +95,8 @@ func LoginHandler(c *gin.Context) {
 // @Param body body models.SignUp true "User credentials"
 // @Success 200 {object} object	"ok"
 // @Router /register [post]
-func RegisterHandler(c *gin.Context) {
+func (h *Handler) RegisterHandler(c *gin.Context) {
 	var user models.SignUp
-	db := database.Database.DB
 
 	if err := c.ShouldBindJSON(&user); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -116,10 +120,8 @@ func RegisterHandler(c *gin.Context) {
 		UpdatedAt:   time.Now(),
 	}
 
-	// Execute the SQL query to insert a new user
-	_, err = db.Exec("INSERT INTO users (full_name, email, password, phone_number, user_type, Created_At, Updated_At) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		newUser.FullName, newUser.Email, newUser.Password, newUser.PhoneNumber, newUser.UserType, newUser.CreatedAt, newUser.UpdatedAt)
-
+	// Save the new user
+	err = h.Users.Create(c, newUser)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save user"})
 		return
@@ -133,9 +135,8 @@ func HashPassword(password string) (string, error) {
 	return string(bytes), err
 }
 
-func GenerateToken(email string) (string, error) {
-	config := database.Database.Config
-	JwtKey := []byte(config["JWT-API-KEY"])
+func (h *Handler) GenerateToken(email string) (string, error) {
+	JwtKey := []byte(h.Config.Current().JWTKey)
 
 	// The expiration time after which the token will be invalid.
 	expirationTime := time.Now().Add(12 * time.Hour).Unix()
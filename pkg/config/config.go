@@ -0,0 +1,435 @@
+// Package config loads the settings of the server and the commands.
+//
+// Settings are layered, each layer overriding the one before it:
+//
+//  1. the defaults below
+//  2. the Configurations table, when the database has one (optional)
+//  3. the YAML file named by --config or CLEAN_BET_CONFIG (optional)
+//  4. environment variables
+//
+// The database settings cannot come from the table, they are needed to open it.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the configuration file when no --config flag is given
+const FileEnv = "CLEAN_BET_CONFIG"
+
+// Config holds every setting the application reads
+type Config struct {
+	// Port is the address the server listens on, e.g. ":8080"
+	Port string `yaml:"port" json:"port"`
+	// DataLink is the base URL of the racing site
+	DataLink string `yaml:"data_link" json:"data_link"`
+	// JWTKey signs the login tokens and is the API key of the protected routes
+	JWTKey string `yaml:"jwt_key" json:"jwt_key"`
+	// BetValue is the level stake of each bet
+	BetValue int `yaml:"bet_value" json:"bet_value"`
+	// Delta is how far in furlongs the race distance may be from the preferred one
+	Delta float64 `yaml:"delta" json:"delta"`
+	// TotalRuns is the number of runs under which experience adds to the score
+	TotalRuns int `yaml:"total_runs" json:"total_runs"`
+	// AveragePosition is the average finishing position a selection should beat
+	AveragePosition float64 `yaml:"average_position" json:"average_position"`
+	// ScoreNoise spreads the analysis scores by up to ScoreNoise/2 either way
+	// with the seeded RNG of the run, 0 keeps the scoring deterministic
+	ScoreNoise float64 `yaml:"score_noise" json:"score_noise"`
+	// WinProbabilityScale turns the scores of a race into win probabilities,
+	// each runner's exp(scale*score) over the race total: 0 makes the runners
+	// equal, the larger the more the top score stands out
+	WinProbabilityScale float64 `yaml:"win_probability_scale" json:"win_probability_scale"`
+	// ValueEdge is how much the win probability of a value bet must beat the
+	// market's, as a fraction of it: 0.05 wants the model 5% above the price
+	ValueEdge float64 `yaml:"value_edge" json:"value_edge"`
+
+	Database DatabaseConfig `yaml:"database" json:"database"`
+	Forms    FormConfig     `yaml:"forms" json:"forms"`
+	// Schedule maps a pipeline stage to its cron expression
+	Schedule map[string]string `yaml:"schedule" json:"schedule"`
+}
+
+// DatabaseConfig selects the database
+type DatabaseConfig struct {
+	// Driver is sqlite3 or postgres
+	Driver string `yaml:"driver" json:"driver"`
+	// URL is the data source name, clean-bet.db for SQLite when empty
+	URL string `yaml:"url" json:"url"`
+}
+
+// FormConfig controls how form pages are fetched
+type FormConfig struct {
+	Workers       int     `yaml:"workers" json:"workers"`
+	RatePerSecond float64 `yaml:"rate_per_second" json:"rate_per_second"`
+	Retries       int     `yaml:"retries" json:"retries"`
+	BackoffMS     int     `yaml:"backoff_ms" json:"backoff_ms"`
+}
+
+// Default returns the settings used when nothing overrides them
+func Default() *Config {
+	return &Config{
+		Port:                ":8080",
+		DataLink:            "https://www.sportinglife.com",
+		BetValue:            10,
+		Delta:               1,
+		TotalRuns:           20,
+		AveragePosition:     5,
+		WinProbabilityScale: 0.1,
+		ValueEdge:           0.05,
+		Database: DatabaseConfig{
+			Driver: string(database.SQLite),
+		},
+		Forms: FormConfig{
+			Workers:       4,
+			RatePerSecond: 2,
+			Retries:       3,
+			BackoffMS:     500,
+		},
+		Schedule: map[string]string{},
+	}
+}
+
+// setting binds a field to its key in the Configurations table and its
+// environment variable, an empty key keeps the field out of the table
+type setting struct {
+	key   string
+	env   string
+	field func(cfg *Config) interface{}
+	// secret settings are neither shown nor changed through the admin API
+	secret bool
+	// restart settings are read once when the server starts
+	restart bool
+}
+
+// settings are applied in order, so of the two Delta rows the table still
+// holds, the lower case one used by the scoring wins
+var settings = []setting{
+	{"PORT", "PORT", func(cfg *Config) interface{} { return &cfg.Port }, false, true},
+	{"DataLink", "CLEAN_BET_DATA_LINK", func(cfg *Config) interface{} { return &cfg.DataLink }, false, true},
+	{"JWT-API-KEY", "CLEAN_BET_JWT_KEY", func(cfg *Config) interface{} { return &cfg.JWTKey }, true, false},
+	{"bet_value", "CLEAN_BET_BET_VALUE", func(cfg *Config) interface{} { return &cfg.BetValue }, false, false},
+	{"Delta", "", func(cfg *Config) interface{} { return &cfg.Delta }, false, false},
+	{"delta", "CLEAN_BET_DELTA", func(cfg *Config) interface{} { return &cfg.Delta }, false, false},
+	{"total_runs", "CLEAN_BET_TOTAL_RUNS", func(cfg *Config) interface{} { return &cfg.TotalRuns }, false, false},
+	{"average_postion", "CLEAN_BET_AVERAGE_POSITION", func(cfg *Config) interface{} { return &cfg.AveragePosition }, false, false},
+	{"score_noise", "CLEAN_BET_SCORE_NOISE", func(cfg *Config) interface{} { return &cfg.ScoreNoise }, false, false},
+	{"win_probability_scale", "CLEAN_BET_WIN_PROBABILITY_SCALE", func(cfg *Config) interface{} { return &cfg.WinProbabilityScale }, false, false},
+	{"value_edge", "CLEAN_BET_VALUE_EDGE", func(cfg *Config) interface{} { return &cfg.ValueEdge }, false, false},
+	{"", "DATABASE_DRIVER", func(cfg *Config) interface{} { return &cfg.Database.Driver }, false, true},
+	{"", "DATABASE_URL", func(cfg *Config) interface{} { return &cfg.Database.URL }, true, true},
+	{"form_workers", "CLEAN_BET_FORM_WORKERS", func(cfg *Config) interface{} { return &cfg.Forms.Workers }, false, false},
+	{"form_rate_per_second", "CLEAN_BET_FORM_RATE_PER_SECOND", func(cfg *Config) interface{} { return &cfg.Forms.RatePerSecond }, false, false},
+	{"form_retries", "CLEAN_BET_FORM_RETRIES", func(cfg *Config) interface{} { return &cfg.Forms.Retries }, false, false},
+	{"form_backoff_ms", "CLEAN_BET_FORM_BACKOFF_MS", func(cfg *Config) interface{} { return &cfg.Forms.BackoffMS }, false, false},
+}
+
+const (
+	scheduleKey = "schedule_"
+	scheduleEnv = "CLEAN_BET_SCHEDULE_"
+)
+
+// Load layers the defaults, the table rows, the file at path and the
+// environment. An empty path falls back to CLEAN_BET_CONFIG and then to no
+// file at all. The result is not validated, call Validate before using it.
+func Load(path string, table map[string]string) (*Config, error) {
+	cfg := Default()
+
+	if err := cfg.overlay(table); err != nil {
+		return nil, err
+	}
+
+	if path == "" {
+		path = os.Getenv(FileEnv)
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// overlay applies the rows of the Configurations table, unknown keys are ignored
+func (cfg *Config) overlay(table map[string]string) error {
+	var errs []error
+	for _, s := range settings {
+		value, ok := table[s.key]
+		if s.key == "" || !ok {
+			continue
+		}
+		if err := set(s.field(cfg), value); err != nil {
+			errs = append(errs, fmt.Errorf("Configurations %s: %w", s.key, err))
+		}
+	}
+
+	for key, value := range table {
+		if stage, ok := strings.CutPrefix(key, scheduleKey); ok && stage != "" {
+			cfg.Schedule[stage] = value
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (cfg *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (cfg *Config) loadEnv() error {
+	var errs []error
+	for _, s := range settings {
+		value, ok := os.LookupEnv(s.env)
+		if s.env == "" || !ok {
+			continue
+		}
+		if err := set(s.field(cfg), value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+		}
+	}
+
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if stage, ok := strings.CutPrefix(name, scheduleEnv); ok && stage != "" {
+			cfg.Schedule[strings.ToLower(stage)] = value
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// lookup returns the setting stored under key in the Configurations table
+func lookup(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key != "" && s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// CheckKey reports whether key is a setting of the Configurations table the
+// admin API may change
+func CheckKey(key string) error {
+	if stage, ok := strings.CutPrefix(key, scheduleKey); ok {
+		if stage == "" {
+			return fmt.Errorf("%s: missing the stage name", key)
+		}
+		return nil
+	}
+	s, ok := lookup(key)
+	if !ok {
+		return fmt.Errorf("%s: unknown setting", key)
+	}
+	if s.secret {
+		return fmt.Errorf("%s: cannot be changed at runtime", key)
+	}
+	return nil
+}
+
+// RequiresRestart reports whether a change to key only applies once the
+// server restarts
+func RequiresRestart(key string) bool {
+	if strings.HasPrefix(key, scheduleKey) {
+		return true
+	}
+	s, ok := lookup(key)
+	return ok && s.restart
+}
+
+// Value returns the value cfg holds for a key of the Configurations table
+func (cfg *Config) Value(key string) string {
+	if stage, ok := strings.CutPrefix(key, scheduleKey); ok {
+		return cfg.Schedule[stage]
+	}
+	s, ok := lookup(key)
+	if !ok {
+		return ""
+	}
+	switch field := s.field(cfg).(type) {
+	case *string:
+		return *field
+	case *int:
+		return strconv.Itoa(*field)
+	case *float64:
+		return strconv.FormatFloat(*field, 'f', -1, 64)
+	}
+	return ""
+}
+
+// Overridden returns the keys of rows whose value cfg does not hold because
+// the file, the environment or a later row of the same setting overrides them
+func (cfg *Config) Overridden(rows map[string]string) []string {
+	var keys []string
+	for key, value := range rows {
+		row := Default()
+		if err := row.overlay(map[string]string{key: value}); err != nil {
+			continue
+		}
+		if row.Value(key) != cfg.Value(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Redacted returns a copy of cfg without its secrets, for display
+func (cfg *Config) Redacted() *Config {
+	redacted := *cfg
+	if redacted.JWTKey != "" {
+		redacted.JWTKey = "redacted"
+	}
+	if link, err := url.Parse(redacted.Database.URL); err == nil && link.User != nil {
+		redacted.Database.URL = link.Redacted()
+	}
+	return &redacted
+}
+
+// set parses value into the field pointed at
+func set(field interface{}, value string) error {
+	value = strings.TrimSpace(value)
+	switch field := field.(type) {
+	case *string:
+		*field = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*field = n
+	case *float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		*field = f
+	default:
+		return fmt.Errorf("unsupported setting type %T", field)
+	}
+	return nil
+}
+
+// Validate reports every setting that is missing or out of range
+func (cfg *Config) Validate() error {
+	var errs []error
+	invalid := func(name, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]interface{}{name}, args...)...))
+	}
+
+	if cfg.Port == "" {
+		invalid("port", "is required")
+	}
+	if link, err := url.Parse(cfg.DataLink); err != nil || link.Host == "" || (link.Scheme != "http" && link.Scheme != "https") {
+		invalid("data_link", "%q is not an http(s) URL", cfg.DataLink)
+	}
+	if cfg.JWTKey == "" {
+		invalid("jwt_key", "is required")
+	}
+	if cfg.BetValue <= 0 {
+		invalid("bet_value", "must be greater than 0, got %d", cfg.BetValue)
+	}
+	if cfg.Delta < 0 {
+		invalid("delta", "must not be negative, got %g", cfg.Delta)
+	}
+	if cfg.TotalRuns <= 0 {
+		invalid("total_runs", "must be greater than 0, got %d", cfg.TotalRuns)
+	}
+	if cfg.AveragePosition < 0 {
+		invalid("average_position", "must not be negative, got %g", cfg.AveragePosition)
+	}
+	if cfg.ScoreNoise < 0 {
+		invalid("score_noise", "must not be negative, got %g", cfg.ScoreNoise)
+	}
+	if cfg.WinProbabilityScale < 0 {
+		invalid("win_probability_scale", "must not be negative, got %g", cfg.WinProbabilityScale)
+	}
+	if cfg.ValueEdge < 0 {
+		invalid("value_edge", "must not be negative, got %g", cfg.ValueEdge)
+	}
+
+	if err := cfg.Database.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.Forms.Workers <= 0 {
+		invalid("forms.workers", "must be greater than 0, got %d", cfg.Forms.Workers)
+	}
+	if cfg.Forms.RatePerSecond <= 0 {
+		invalid("forms.rate_per_second", "must be greater than 0, got %g", cfg.Forms.RatePerSecond)
+	}
+	if cfg.Forms.Retries < 0 {
+		invalid("forms.retries", "must not be negative, got %d", cfg.Forms.Retries)
+	}
+	if cfg.Forms.BackoffMS < 0 {
+		invalid("forms.backoff_ms", "must not be negative, got %d", cfg.Forms.BackoffMS)
+	}
+
+	stages := make([]string, 0, len(cfg.Schedule))
+	for stage := range cfg.Schedule {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		expression := cfg.Schedule[stage]
+		if expression == "" {
+			continue
+		}
+		if _, err := cron.ParseStandard(expression); err != nil {
+			invalid("schedule."+stage, "%q is not a cron expression: %v", expression, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Validate checks the driver is supported and has the URL it needs
+func (db DatabaseConfig) Validate() error {
+	dialect, err := database.ParseDialect(db.Driver)
+	if err != nil {
+		return fmt.Errorf("database.driver: %w", err)
+	}
+	if dialect != database.SQLite && db.URL == "" {
+		return fmt.Errorf("database.url: is required for the %s driver", dialect)
+	}
+	return nil
+}
+
+// Address returns Port as a listen address, so a bare PORT=8080 as set by
+// most hosting platforms works too
+func (cfg *Config) Address() string {
+	if strings.Contains(cfg.Port, ":") {
+		return cfg.Port
+	}
+	return ":" + cfg.Port
+}
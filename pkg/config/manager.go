@@ -0,0 +1,44 @@
+package config
+
+import "sync"
+
+// Manager holds the configuration the handlers read and swaps it when the
+// Configurations table changes. A Config is never modified once current, so
+// a handler keeps a consistent view by calling Current once per request.
+type Manager struct {
+	path    string
+	mu      sync.RWMutex
+	current *Config
+}
+
+// NewManager returns a Manager serving cfg, loaded from the file at path
+func NewManager(path string, cfg *Config) *Manager {
+	return &Manager{path: path, current: cfg}
+}
+
+// Current returns the configuration in force
+func (m *Manager) Current() *Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.current
+}
+
+// Build loads and validates the configuration the rows of table would give,
+// under the same file and environment, without making it current
+func (m *Manager) Build(table map[string]string) (*Config, error) {
+	cfg, err := Load(m.path, table)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Apply makes cfg the configuration in force
+func (m *Manager) Apply(cfg *Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current = cfg
+}
@@ -1,101 +1,146 @@
 package database
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
-	"os"
+	"strconv"
+	"strings"
 
+	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/mmanjoura/clean-bet-backend/pkg/models"
 )
 
-// DbInstance holds the database connection and configuration settings
-type DbInstance struct {
-	DB     *sql.DB
-	Config map[string]string
-}
+// DefaultDSN is the SQLite database used when no URL is configured,
+// background jobs write while handlers read so it waits for locks instead of
+// failing straight away
+const DefaultDSN = "./clean-bet.db?_busy_timeout=5000"
 
-// Global variable to store the database instance
-var Database DbInstance
+// MinSQLiteVersion is the oldest SQLite the queries run on, GroupConcat
+// orders its values with GROUP_CONCAT(x, sep ORDER BY ...) added in 3.44
+const MinSQLiteVersion = "3.44.0"
 
-// ConnectDatabase initializes the database connection and retrieves configurations
-func ConnectDatabase() {
-	var err error
+// DB is a database connection that adapts the ? placeholders of the queries
+// to its dialect
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+}
 
-	// Open a connection to the SQLite database
-	db, err := sql.Open("sqlite3", "./clean-bet.db")
+// ConnectDatabase opens the database and brings its schema up to date, a
+// fresh database gets the full schema
+func ConnectDatabase(driver, dsn string) (*DB, error) {
+	db, err := Open(driver, dsn)
 	if err != nil {
-		// Log fatal error and exit if database connection fails
-		log.Fatalf("Failed to connect to the database: %v\n", err)
-		os.Exit(2)
+		return nil, err
 	}
 
-	// Retrieve configurations from the database
-	configurations, err := GetConfigs(db)
-	if err != nil {
-		fmt.Printf("Error retrieving configurations: %v\n", err)
-		checkErr(err)
+	// Apply pending migrations
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	// Set the global Database variable with the database connection and configurations
-	Database = DbInstance{
-		DB:     db,
-		Config: configurations,
-	}
+	return db, nil
 }
 
-// checkErr logs fatal errors and stops execution if an error is encountered
-func checkErr(err error) {
+// Open opens the database of driver (sqlite3 or postgres) at dsn, SQLite's
+// clean-bet.db when both are empty
+func Open(driver, dsn string) (*DB, error) {
+	dialect, err := ParseDialect(driver)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-}
 
-// FormatLimitOffset returns a formatted string for SQL LIMIT and OFFSET clauses
-func FormatLimitOffset(limit, offset int) string {
-	return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
-}
+	if dsn == "" {
+		if dialect != SQLite {
+			return nil, fmt.Errorf("DATABASE_URL is required for the %s driver", dialect)
+		}
+		dsn = DefaultDSN
+	}
 
-// GetConfigs fetches configurations from the database and returns them as a map
-func GetConfigs(db *sql.DB) (map[string]string, error) {
-	// Create a context for the query execution
-	ctx := context.Background()
+	return OpenDSN(dialect, dsn)
+}
 
-	// Execute SQL query to retrieve all configurations ordered by ID
-	rows, err := db.QueryContext(ctx, `SELECT ID, key, value FROM Configurations ORDER BY id ASC`)
+// OpenDSN opens a connection to dsn with the driver of dialect, SQLite must
+// be MinSQLiteVersion or later
+func OpenDSN(dialect Dialect, dsn string) (*DB, error) {
+	db, err := sql.Open(dialect.DriverName(), dsn)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close() // Ensure rows are closed once processing is complete
-
-	// Create a map to store the configurations
-	configurations := make(map[string]string)
-
-	// Iterate over the rows and scan each configuration into the map
-	for rows.Next() {
-		configuration, err := scanConfiguration(rows)
-		if err != nil {
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if dialect == SQLite {
+		if err := checkSQLiteVersion(db); err != nil {
+			db.Close()
 			return nil, err
 		}
+	}
 
-		// Only add the configuration if its ID is not zero
-		if configuration.ID != 0 {
-			configurations[configuration.Key] = configuration.Value
+	return &DB{DB: db, Dialect: dialect}, nil
+}
+
+// checkSQLiteVersion fails when the SQLite linked into the driver is older
+// than MinSQLiteVersion
+func checkSQLiteVersion(db *sql.DB) error {
+	var version string
+	if err := db.QueryRow(`SELECT sqlite_version()`).Scan(&version); err != nil {
+		return err
+	}
+	if compareVersions(version, MinSQLiteVersion) < 0 {
+		return fmt.Errorf("SQLite %s is too old, %s or later is required", version, MinSQLiteVersion)
+	}
+	return nil
+}
+
+// compareVersions compares two dotted version numbers part by part, missing
+// parts count as 0
+func compareVersions(a, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(partsA), len(partsB)); i++ {
+		var x, y int
+		if i < len(partsA) {
+			x, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			y, _ = strconv.Atoi(partsB[i])
+		}
+		if x != y {
+			return cmp.Compare(x, y)
 		}
 	}
+	return 0
+}
+
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.ExecContext(ctx, db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.Dialect.Rebind(query), args...)
+}
 
-	return configurations, nil
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.QueryContext(ctx, db.Dialect.Rebind(query), args...)
 }
 
-// scanConfiguration reads a single row of configuration data and returns a Configuration model
-func scanConfiguration(rows *sql.Rows) (models.Configuration, error) {
-	// Create an empty Configuration model
-	configuration := models.Configuration{}
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.Dialect.Rebind(query), args...)
+}
 
-	// Scan the row data into the configuration model
-	err := rows.Scan(&configuration.ID, &configuration.Key, &configuration.Value)
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRowContext(ctx, db.Dialect.Rebind(query), args...)
+}
 
-	return configuration, err
+// FormatLimitOffset returns a formatted string for SQL LIMIT and OFFSET clauses
+func FormatLimitOffset(limit, offset int) string {
+	return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
 }
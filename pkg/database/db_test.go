@@ -0,0 +1,38 @@
+package database
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"3.44.0", "3.44.0", 0},
+		{"3.44", "3.44.0", 0},
+		{"3.46.1", "3.44.0", 1},
+		{"3.43.2", "3.44.0", -1},
+		{"3.9.0", "3.44.0", -1},
+		{"4.0.0", "3.44.0", 1},
+	}
+	for _, test := range tests {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+// TestOpenSQLite opens the SQLite linked into the driver, which must be recent
+// enough for the queries
+func TestOpenSQLite(t *testing.T) {
+	db, err := OpenDSN(SQLite, "file:open?mode=memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var version string
+	if err := db.QueryRow(`SELECT sqlite_version()`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("SQLite %s", version)
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect is the SQL flavour of the database, queries are written for SQLite
+// with ? placeholders and the dialect adapts them to the driver in use
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite3"
+	Postgres Dialect = "postgres"
+)
+
+// ParseDialect returns the dialect of a driver name, sqlite3 when empty
+func ParseDialect(driver string) (Dialect, error) {
+	switch strings.ToLower(driver) {
+	case "", "sqlite", "sqlite3":
+		return SQLite, nil
+	case "postgres", "postgresql", "pgx":
+		return Postgres, nil
+	}
+	return "", fmt.Errorf("unsupported database driver %q, expected sqlite3 or postgres", driver)
+}
+
+// DriverName returns the database/sql driver registered for the dialect
+func (d Dialect) DriverName() string {
+	if d == Postgres {
+		return "pgx"
+	}
+	return "sqlite3"
+}
+
+// Rebind replaces the ? placeholders of query with $1, $2... for Postgres.
+// Question marks inside string literals are left alone.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			inString = !inString
+			b.WriteByte(ch)
+		case ch == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// GroupConcat joins the values of expr in orderBy order, separated by separator
+func (d Dialect) GroupConcat(expr, separator, orderBy string) string {
+	if d == Postgres {
+		return fmt.Sprintf("STRING_AGG(CAST(%s AS TEXT), '%s' ORDER BY %s)", expr, separator, orderBy)
+	}
+	return fmt.Sprintf("GROUP_CONCAT(%s, '%s' ORDER BY %s)", expr, separator, orderBy)
+}
+
+// Date returns the YYYY-MM-DD date of a timestamp or date string column
+func (d Dialect) Date(expr string) string {
+	if d == Postgres {
+		return fmt.Sprintf("CAST(%s AS DATE)", expr)
+	}
+	return fmt.Sprintf("DATE(%s)", expr)
+}
+
+// Number reads the leading number of a text column the way SQLite does, so
+// "5/9" is 5, "1m 2f" is 1 and text without a leading number is 0
+func (d Dialect) Number(expr string) string {
+	if d == Postgres {
+		return fmt.Sprintf(`COALESCE(CAST(SUBSTRING(TRIM(%s) FROM '^[-+]?[0-9]*\.?[0-9]+') AS DOUBLE PRECISION), 0)`, expr)
+	}
+	return expr
+}
+
+// Before returns the part of expr before the first separator, or an empty
+// string when expr has none
+func (d Dialect) Before(expr, separator string) string {
+	if d == Postgres {
+		return fmt.Sprintf("CASE WHEN STRPOS(%[1]s, '%[2]s') > 0 THEN SPLIT_PART(%[1]s, '%[2]s', 1) ELSE '' END", expr, separator)
+	}
+	return fmt.Sprintf("SUBSTR(%[1]s, 1, INSTR(%[1]s, '%[2]s') - 1)", expr, separator)
+}
+
+// YearsBetween returns the difference between the years of two timestamps
+func (d Dialect) YearsBetween(from, to string) string {
+	if d == Postgres {
+		return fmt.Sprintf("CAST(EXTRACT(YEAR FROM %s) - EXTRACT(YEAR FROM %s) AS INTEGER)", to, from)
+	}
+	// SQLite subtracts the leading year of the two timestamps
+	return fmt.Sprintf("%s - %s", to, from)
+}
+
+// postgresRewrites turn the SQLite-only parts of the migrations into their
+// Postgres equivalents
+var postgresRewrites = strings.NewReplacer(
+	"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+	"lower(hex(randomblob(32)))", "md5(random()::text) || md5(random()::text)",
+)
+
+// translate adapts a migration script written for SQLite to the dialect
+func (d Dialect) translate(script string) string {
+	if d == Postgres {
+		return postgresRewrites.Replace(script)
+	}
+	return script
+}
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS EventRunners;
+DROP TABLE IF EXISTS score_constants;
+DROP TABLE IF EXISTS Analysis;
+DROP TABLE IF EXISTS Forms;
+DROP TABLE IF EXISTS Meetings;
+DROP TABLE IF EXISTS Events;
+DROP TABLE IF EXISTS Configurations;
+DROP TABLE IF EXISTS Users;
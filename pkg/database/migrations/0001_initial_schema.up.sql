@@ -0,0 +1,118 @@
+-- Tables the application had before migrations were introduced. IF NOT EXISTS
+-- lets an existing clean-bet.db adopt the migrations without losing data.
+
+CREATE TABLE IF NOT EXISTS Users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    full_name TEXT NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    phone_number TEXT NOT NULL DEFAULT '',
+    user_type TEXT NOT NULL DEFAULT 'user',
+    profile TEXT NOT NULL DEFAULT '',
+    avatar_url TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS Configurations (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    key TEXT UNIQUE NOT NULL,
+    value TEXT NOT NULL
+);
+
+-- Racecourses and the country they are in, predictions are filtered by country
+CREATE TABLE IF NOT EXISTS Events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_name TEXT NOT NULL UNIQUE,
+    country TEXT NOT NULL
+);
+
+-- Declared runners of a race day
+CREATE TABLE IF NOT EXISTS Meetings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    selection_link TEXT,
+    selection_id INTEGER,
+    event_link TEXT,
+    selection_name TEXT,
+    event_time TEXT,
+    event_name TEXT,
+    price TEXT,
+    event_date TIMESTAMP,
+    race_distance TEXT,
+    race_category TEXT,
+    track_condition TEXT,
+    number_of_runners TEXT,
+    race_track TEXT,
+    race_class TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Past performances of the runners
+CREATE TABLE IF NOT EXISTS Forms (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    selection_name TEXT,
+    selection_id INTEGER,
+    race_class TEXT,
+    race_date TIMESTAMP,
+    position TEXT,
+    rating TEXT,
+    race_type TEXT,
+    racecourse TEXT,
+    distance TEXT,
+    going TEXT,
+    sp_odds TEXT,
+    Age TEXT,
+    Trainer TEXT,
+    Sex TEXT,
+    Sire TEXT,
+    Dam TEXT,
+    Owner TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Scored runners and, once settled, their result
+CREATE TABLE IF NOT EXISTS Analysis (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_link TEXT,
+    selection_link TEXT,
+    event_date TEXT,
+    race_date TEXT,
+    selection_id INTEGER,
+    selection_name TEXT,
+    odds TEXT,
+    age INTEGER,
+    clean_bet_score DOUBLE PRECISION,
+    average_position DOUBLE PRECISION,
+    average_rating DOUBLE PRECISION,
+    event_name TEXT,
+    event_time TEXT,
+    selection_position TEXT,
+    num_runners INTEGER,
+    number_runs INTEGER,
+    prefered_distance DOUBLE PRECISION,
+    current_distance DOUBLE PRECISION,
+    potential_return TEXT,
+    current_event_price TEXT,
+    current_event_position TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS score_constants (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    category TEXT NOT NULL,
+    item TEXT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    UNIQUE (category, item)
+);
+
+CREATE TABLE IF NOT EXISTS EventRunners (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    selection_id INTEGER,
+    selection_name TEXT,
+    event_name TEXT,
+    event_date TEXT,
+    event_time TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
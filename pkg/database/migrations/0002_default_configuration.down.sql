@@ -0,0 +1,2 @@
+-- Configuration values may have been edited since, they are kept
+SELECT 1;
@@ -0,0 +1,34 @@
+-- Settings read at startup, existing values are left alone
+INSERT INTO Configurations (key, value) VALUES ('PORT', ':8080') ON CONFLICT (key) DO NOTHING;
+INSERT INTO Configurations (key, value) VALUES ('DataLink', 'https://www.sportinglife.com') ON CONFLICT (key) DO NOTHING;
+INSERT INTO Configurations (key, value) VALUES ('JWT-API-KEY', lower(hex(randomblob(32)))) ON CONFLICT (key) DO NOTHING;
+INSERT INTO Configurations (key, value) VALUES ('bet_value', '10') ON CONFLICT (key) DO NOTHING;
+INSERT INTO Configurations (key, value) VALUES ('Delta', '1') ON CONFLICT (key) DO NOTHING;
+INSERT INTO Configurations (key, value) VALUES ('delta', '1') ON CONFLICT (key) DO NOTHING;
+INSERT INTO Configurations (key, value) VALUES ('total_runs', '20') ON CONFLICT (key) DO NOTHING;
+INSERT INTO Configurations (key, value) VALUES ('average_postion', '5') ON CONFLICT (key) DO NOTHING;
+
+INSERT INTO Events (event_name, country) VALUES
+    ('Aintree', 'UK'), ('Ascot', 'UK'), ('Ayr', 'UK'), ('Bangor-on-Dee', 'UK'), ('Bath', 'UK'),
+    ('Beverley', 'UK'), ('Brighton', 'UK'), ('Carlisle', 'UK'), ('Cartmel', 'UK'), ('Catterick', 'UK'),
+    ('Chelmsford City', 'UK'), ('Cheltenham', 'UK'), ('Chepstow', 'UK'), ('Chester', 'UK'), ('Doncaster', 'UK'),
+    ('Epsom', 'UK'), ('Exeter', 'UK'), ('Fakenham', 'UK'), ('Ffos Las', 'UK'), ('Fontwell', 'UK'),
+    ('Goodwood', 'UK'), ('Hamilton', 'UK'), ('Haydock', 'UK'), ('Hereford', 'UK'), ('Hexham', 'UK'),
+    ('Huntingdon', 'UK'), ('Kelso', 'UK'), ('Kempton', 'UK'), ('Leicester', 'UK'), ('Lingfield', 'UK'),
+    ('Ludlow', 'UK'), ('Market Rasen', 'UK'), ('Musselburgh', 'UK'), ('Newbury', 'UK'), ('Newcastle', 'UK'),
+    ('Newmarket', 'UK'), ('Newton Abbot', 'UK'), ('Nottingham', 'UK'), ('Perth', 'UK'), ('Plumpton', 'UK'),
+    ('Pontefract', 'UK'), ('Redcar', 'UK'), ('Ripon', 'UK'), ('Salisbury', 'UK'), ('Sandown', 'UK'),
+    ('Sedgefield', 'UK'), ('Southwell', 'UK'), ('Stratford', 'UK'), ('Taunton', 'UK'), ('Thirsk', 'UK'),
+    ('Uttoxeter', 'UK'), ('Warwick', 'UK'), ('Wetherby', 'UK'), ('Wincanton', 'UK'), ('Windsor', 'UK'),
+    ('Wolverhampton', 'UK'), ('Worcester', 'UK'), ('Yarmouth', 'UK'), ('York', 'UK')
+ON CONFLICT (event_name) DO NOTHING;
+
+INSERT INTO Events (event_name, country) VALUES
+    ('Ballinrobe', 'Ireland'), ('Bellewstown', 'Ireland'), ('Clonmel', 'Ireland'), ('Cork', 'Ireland'),
+    ('Down Royal', 'Ireland'), ('Downpatrick', 'Ireland'), ('Dundalk', 'Ireland'), ('Fairyhouse', 'Ireland'),
+    ('Galway', 'Ireland'), ('Gowran Park', 'Ireland'), ('Kilbeggan', 'Ireland'), ('Killarney', 'Ireland'),
+    ('Laytown', 'Ireland'), ('Leopardstown', 'Ireland'), ('Limerick', 'Ireland'), ('Listowel', 'Ireland'),
+    ('Naas', 'Ireland'), ('Navan', 'Ireland'), ('Punchestown', 'Ireland'), ('Roscommon', 'Ireland'),
+    ('Sligo', 'Ireland'), ('The Curragh', 'Ireland'), ('Thurles', 'Ireland'), ('Tipperary', 'Ireland'),
+    ('Tramore', 'Ireland'), ('Wexford', 'Ireland')
+ON CONFLICT (event_name) DO NOTHING;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS PipelineRuns;
+DROP TABLE IF EXISTS Jobs;
+DROP TABLE IF EXISTS ScrapeRuns;
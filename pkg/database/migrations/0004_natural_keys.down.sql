@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ux_analysis_selection_event_date;
+DROP INDEX IF EXISTS ux_forms_selection_race_date;
+DROP INDEX IF EXISTS ux_meetings_selection_event;
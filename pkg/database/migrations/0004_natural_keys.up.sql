@@ -0,0 +1,18 @@
+-- Natural keys of the ingested tables, writers upsert on them.
+-- Older rows stamped Meetings.event_date with a full timestamp, normalise them
+-- to the date and drop the duplicates before the unique indexes are created.
+UPDATE Meetings SET event_date = DATE(event_date) WHERE event_date <> DATE(event_date);
+
+DELETE FROM Meetings WHERE id NOT IN (
+    SELECT MAX(id) FROM Meetings GROUP BY selection_id, event_date, event_time
+);
+DELETE FROM Forms WHERE id NOT IN (
+    SELECT MAX(id) FROM Forms GROUP BY selection_id, race_date
+);
+DELETE FROM Analysis WHERE id NOT IN (
+    SELECT MAX(id) FROM Analysis GROUP BY selection_id, event_date
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_meetings_selection_event ON Meetings (selection_id, event_date, event_time);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_forms_selection_race_date ON Forms (selection_id, race_date);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_analysis_selection_event_date ON Analysis (selection_id, event_date);
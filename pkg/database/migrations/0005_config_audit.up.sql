@@ -0,0 +1,12 @@
+-- Changes made to the Configurations table through the admin API
+CREATE TABLE IF NOT EXISTS ConfigAudit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    key TEXT NOT NULL,
+    old_value TEXT,
+    new_value TEXT NOT NULL,
+    user_id INTEGER,
+    changed_by TEXT NOT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_config_audit_key ON ConfigAudit (key);
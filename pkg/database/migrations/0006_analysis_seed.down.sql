@@ -0,0 +1 @@
+ALTER TABLE Analysis DROP COLUMN seed;
@@ -0,0 +1,2 @@
+-- Seed of the random source the scores of a day were drawn with
+ALTER TABLE Analysis ADD COLUMN seed INTEGER;
@@ -0,0 +1,18 @@
+DROP INDEX IF EXISTS ux_analysis_selection_event_date_profile;
+DELETE FROM Analysis WHERE profile <> 'default';
+ALTER TABLE Analysis DROP COLUMN profile;
+CREATE UNIQUE INDEX IF NOT EXISTS ux_analysis_selection_event_date ON Analysis (selection_id, event_date);
+
+CREATE TABLE score_constants_single (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    category TEXT NOT NULL,
+    item TEXT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    UNIQUE (category, item)
+);
+INSERT INTO score_constants_single (category, item, score)
+    SELECT category, item, score FROM score_constants
+    WHERE profile = 'default'
+    AND category NOT IN ('last_run_positions', 'days_since_last_run', 'distance_suitability', 'win_count', 'odds', 'weights');
+DROP TABLE score_constants;
+ALTER TABLE score_constants_single RENAME TO score_constants;
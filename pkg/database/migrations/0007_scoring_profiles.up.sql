@@ -0,0 +1,48 @@
+-- Named scoring profiles. score_constants gains a profile, so the same item
+-- can score differently in each, and Analysis keeps one score per profile so
+-- strategies can be compared on the same day.
+CREATE TABLE score_constants_profiles (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    profile TEXT NOT NULL DEFAULT 'default',
+    category TEXT NOT NULL,
+    item TEXT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    UNIQUE (profile, category, item)
+);
+INSERT INTO score_constants_profiles (profile, category, item, score)
+    SELECT 'default', category, item, score FROM score_constants;
+DROP TABLE score_constants;
+ALTER TABLE score_constants_profiles RENAME TO score_constants;
+
+-- Bands of the default profile, the points of the first band whose limit the
+-- value meets, or of "otherwise" when none does
+INSERT INTO score_constants (profile, category, item, score) VALUES
+    ('default', 'last_run_positions', '1.5', 10),
+    ('default', 'last_run_positions', '3', 8),
+    ('default', 'last_run_positions', '5', 6),
+    ('default', 'last_run_positions', 'otherwise', 3),
+    ('default', 'days_since_last_run', '9', 3),
+    ('default', 'days_since_last_run', '21', 10),
+    ('default', 'days_since_last_run', '35', 7),
+    ('default', 'days_since_last_run', 'otherwise', 4),
+    ('default', 'distance_suitability', 'same', 15),
+    ('default', 'distance_suitability', 'shorter', 10),
+    ('default', 'distance_suitability', 'longer', 5),
+    ('default', 'win_count', '0.5', 10),
+    ('default', 'win_count', '0.25', 7),
+    ('default', 'win_count', 'otherwise', 4),
+    ('default', 'win_count', 'no_runs', 0),
+    ('default', 'odds', '3', 9),
+    ('default', 'odds', '5', 7),
+    ('default', 'odds', '10', 5),
+    ('default', 'odds', 'otherwise', 3),
+    ('default', 'weights', 'last_run_positions', 1),
+    ('default', 'weights', 'days_since_last_run', 1),
+    ('default', 'weights', 'distance_suitability', 1),
+    ('default', 'weights', 'win_count', 1),
+    ('default', 'weights', 'odds', 1)
+ON CONFLICT (profile, category, item) DO NOTHING;
+
+ALTER TABLE Analysis ADD COLUMN profile TEXT NOT NULL DEFAULT 'default';
+DROP INDEX IF EXISTS ux_analysis_selection_event_date;
+CREATE UNIQUE INDEX IF NOT EXISTS ux_analysis_selection_event_date_profile ON Analysis (selection_id, event_date, profile);
@@ -0,0 +1,3 @@
+DELETE FROM score_constants WHERE category IN ('race_class', 'age');
+DELETE FROM score_constants WHERE category = 'weights' AND item IN ('race_class', 'age');
+DROP TABLE IF EXISTS AnalysisBreakdown;
@@ -0,0 +1,36 @@
+-- Component scores of each analysed runner: the value it was scored on, the
+-- points of its band, the weight of the profile and their product. The scores
+-- of a runner add up to its Analysis.clean_bet_score.
+CREATE TABLE IF NOT EXISTS AnalysisBreakdown (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    selection_id INTEGER NOT NULL,
+    event_date TEXT NOT NULL,
+    profile TEXT NOT NULL DEFAULT 'default',
+    component TEXT NOT NULL,
+    value DOUBLE PRECISION,
+    points DOUBLE PRECISION NOT NULL,
+    weight DOUBLE PRECISION NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    UNIQUE (selection_id, event_date, profile, component)
+);
+
+-- Race class and age are scored too, without weight unless a profile gives
+-- them one
+INSERT INTO score_constants (profile, category, item, score) VALUES
+    ('default', 'race_class', '1', 10),
+    ('default', 'race_class', '2', 8),
+    ('default', 'race_class', '3', 7),
+    ('default', 'race_class', '4', 6),
+    ('default', 'race_class', 'otherwise', 4),
+    ('default', 'age', '3', 7),
+    ('default', 'age', '5', 10),
+    ('default', 'age', '7', 6),
+    ('default', 'age', 'otherwise', 3)
+ON CONFLICT (profile, category, item) DO NOTHING;
+
+INSERT INTO score_constants (profile, category, item, score)
+    SELECT DISTINCT profile, 'weights', 'race_class', 0 FROM score_constants WHERE category = 'weights'
+ON CONFLICT (profile, category, item) DO NOTHING;
+INSERT INTO score_constants (profile, category, item, score)
+    SELECT DISTINCT profile, 'weights', 'age', 0 FROM score_constants WHERE category = 'weights'
+ON CONFLICT (profile, category, item) DO NOTHING;
@@ -0,0 +1,26 @@
+-- Backtests replayed over past race days, kept to compare scoring profiles
+-- and staking rules. params, per_course and per_region hold JSON.
+CREATE TABLE IF NOT EXISTS Backtests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL DEFAULT '',
+    profile TEXT NOT NULL,
+    from_date TEXT NOT NULL,
+    to_date TEXT NOT NULL,
+    params TEXT NOT NULL,
+    races INTEGER NOT NULL,
+    bets INTEGER NOT NULL,
+    winners INTEGER NOT NULL,
+    unsettled INTEGER NOT NULL,
+    strike_rate DOUBLE PRECISION NOT NULL,
+    staked DOUBLE PRECISION NOT NULL,
+    returned DOUBLE PRECISION NOT NULL,
+    profit DOUBLE PRECISION NOT NULL,
+    roi DOUBLE PRECISION NOT NULL,
+    max_drawdown DOUBLE PRECISION NOT NULL,
+    longest_losing_run INTEGER NOT NULL,
+    per_course TEXT NOT NULL,
+    per_region TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_backtests_profile ON Backtests (profile);
@@ -0,0 +1,3 @@
+-- Chance of a runner winning its race, its share of the softmax of the
+-- clean_bet_score of the runners analysed in the race under the same profile
+ALTER TABLE Analysis ADD COLUMN win_probability DOUBLE PRECISION;
@@ -0,0 +1,3 @@
+ALTER TABLE Analysis DROP COLUMN net_profit;
+ALTER TABLE Analysis DROP COLUMN gross_return;
+ALTER TABLE Analysis DROP COLUMN stake;
@@ -0,0 +1,13 @@
+-- Every analysed selection is a bet of the configured bet value when it is
+-- analysed, settled from its starting price
+ALTER TABLE Analysis ADD COLUMN stake DOUBLE PRECISION;
+ALTER TABLE Analysis ADD COLUMN gross_return DOUBLE PRECISION;
+ALTER TABLE Analysis ADD COLUMN net_profit DOUBLE PRECISION;
+
+-- Selections settled before kept a potential_return of the stake of 10 the
+-- totals assumed times the whole part of the odds, without the stake
+UPDATE Analysis
+SET stake = 10,
+    gross_return = CASE WHEN CAST(potential_return AS DOUBLE PRECISION) > 0 THEN CAST(potential_return AS DOUBLE PRECISION) + 10 ELSE 0 END,
+    net_profit = CASE WHEN CAST(potential_return AS DOUBLE PRECISION) > 0 THEN CAST(potential_return AS DOUBLE PRECISION) ELSE -10 END
+WHERE potential_return IS NOT NULL AND potential_return <> '';
@@ -0,0 +1,3 @@
+ALTER TABLE Analysis DROP COLUMN place_fraction;
+ALTER TABLE Analysis DROP COLUMN place_places;
+ALTER TABLE Analysis DROP COLUMN bet_type;
@@ -0,0 +1,7 @@
+-- Selections priced over 4/1 are backed each-way, bet_type is NULL for the
+-- win bets settled before. The stake covers both parts of an each-way bet.
+ALTER TABLE Analysis ADD COLUMN bet_type TEXT;
+-- Each-way terms the bet was settled on: the first place_places runners pay
+-- 1/place_fraction of the odds
+ALTER TABLE Analysis ADD COLUMN place_places INTEGER;
+ALTER TABLE Analysis ADD COLUMN place_fraction INTEGER;
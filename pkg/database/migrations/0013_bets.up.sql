@@ -0,0 +1,25 @@
+-- Bets users placed on analysed selections at the price they took. The stake
+-- covers both parts of an each-way bet, whose place terms are fixed when it is
+-- placed. gross_return and net_profit are NULL while the bet is open.
+CREATE TABLE IF NOT EXISTS Bets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    selection_id INTEGER NOT NULL,
+    selection_name TEXT NOT NULL DEFAULT '',
+    event_name TEXT NOT NULL DEFAULT '',
+    event_date TEXT NOT NULL,
+    event_time TEXT NOT NULL DEFAULT '',
+    bet_type TEXT NOT NULL,
+    stake DOUBLE PRECISION NOT NULL,
+    price TEXT NOT NULL,
+    place_places INTEGER,
+    place_fraction INTEGER,
+    status TEXT NOT NULL DEFAULT 'open',
+    position TEXT,
+    gross_return DOUBLE PRECISION,
+    net_profit DOUBLE PRECISION,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    settled_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_bets_user ON Bets (user_id, event_date);
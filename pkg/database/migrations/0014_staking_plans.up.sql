@@ -0,0 +1,12 @@
+-- The staking plan each user sizes the recommended stakes of predictions by.
+-- max_stake is 0 when stakes are not capped.
+CREATE TABLE IF NOT EXISTS StakingPlans (
+    user_id INTEGER PRIMARY KEY,
+    plan TEXT NOT NULL,
+    stake DOUBLE PRECISION NOT NULL DEFAULT 0,
+    percent DOUBLE PRECISION NOT NULL DEFAULT 0,
+    bank DOUBLE PRECISION NOT NULL DEFAULT 0,
+    kelly_fraction DOUBLE PRECISION NOT NULL DEFAULT 0,
+    max_stake DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
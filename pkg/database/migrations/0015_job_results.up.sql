@@ -0,0 +1,2 @@
+-- What a finished job produced, as JSON, e.g. the outcome of an optimisation
+ALTER TABLE Jobs ADD COLUMN result TEXT;
@@ -0,0 +1,139 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/source"
+	"golang.org/x/time/rate"
+)
+
+// FormOptions controls how form pages are fetched from the source
+type FormOptions struct {
+	Workers       int
+	RatePerSecond float64
+	Retries       int
+	Backoff       time.Duration
+	// Before drops the form lines run on or after this date, zero keeps them all
+	Before time.Time
+}
+
+// DefaultFormOptions keeps a handful of requests in flight without hammering the site.
+var DefaultFormOptions = FormOptions{
+	Workers:       4,
+	RatePerSecond: 2,
+	Retries:       3,
+	Backoff:       500 * time.Millisecond,
+}
+
+// FormOptionsFromConfig returns the options of the forms settings, which
+// config.Validate has already checked
+func FormOptionsFromConfig(forms config.FormConfig) FormOptions {
+	return FormOptions{
+		Workers:       forms.Workers,
+		RatePerSecond: forms.RatePerSecond,
+		Retries:       forms.Retries,
+		Backoff:       time.Duration(forms.BackoffMS) * time.Millisecond,
+	}
+}
+
+// FormResult is the form fetched for one runner
+type FormResult struct {
+	Runner models.MeetingSelections
+	Form   []models.SelectionForm
+	Err    error
+}
+
+// FetchForms fetches the form of every runner with a pool of workers sharing one
+// rate limit, every form page lives on the same host. Results arrive on the returned channel, which is closed once all
+// runners are done or ctx is cancelled, so the caller can write them one at a time.
+func FetchForms(ctx context.Context, src source.RacingSource, runners []models.MeetingSelections, opts FormOptions) <-chan FormResult {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	limiter := rate.NewLimiter(rate.Limit(opts.RatePerSecond), 1)
+
+	jobs := make(chan models.MeetingSelections)
+	results := make(chan FormResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for runner := range jobs {
+				form, err := fetchForm(ctx, src, limiter, runner.SelectionLink, opts)
+				if !opts.Before.IsZero() {
+					form = formBefore(form, opts.Before)
+				}
+				select {
+				case results <- FormResult{Runner: runner, Form: form, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, runner := range runners {
+			select {
+			case jobs <- runner:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// fetchForm fetches one form page, retrying failed requests with exponential backoff.
+// Pages that stopped yielding rows are not retried since the selectors will not fix themselves.
+func fetchForm(ctx context.Context, src source.RacingSource, limiter *rate.Limiter, selectionLink string, opts FormOptions) ([]models.SelectionForm, error) {
+	var form []models.SelectionForm
+	var err error
+
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(opts.Backoff << (attempt - 1)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if err = limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		form, err = src.SelectionForm(selectionLink)
+		var zeroRows *source.ZeroRowsError
+		if err == nil || errors.As(err, &zeroRows) {
+			return form, err
+		}
+	}
+
+	return form, err
+}
+
+// formBefore keeps the form lines run before date
+func formBefore(form []models.SelectionForm, date time.Time) []models.SelectionForm {
+	var filtered []models.SelectionForm
+	for _, line := range form {
+		if line.RaceDate.Before(date) {
+			filtered = append(filtered, line)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,204 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/source"
+	"golang.org/x/time/rate"
+)
+
+// fakeSource is a RacingSource serving form pages. Each link fails with the
+// errors queued for it, in order, before serving its form; the calls to
+// SelectionForm and the most of them in flight at once are counted.
+type fakeSource struct {
+	source.RacingSource
+	delay   time.Duration
+	onFetch func(link string)
+
+	mu       sync.Mutex
+	failures map[string][]error
+	calls    map[string]int
+	inFlight int
+	peak     int
+}
+
+func (s *fakeSource) SelectionForm(selectionLink string) ([]models.SelectionForm, error) {
+	s.mu.Lock()
+	if s.calls == nil {
+		s.calls = make(map[string]int)
+	}
+	s.calls[selectionLink]++
+	s.inFlight++
+	if s.inFlight > s.peak {
+		s.peak = s.inFlight
+	}
+	var err error
+	if queued := s.failures[selectionLink]; len(queued) > 0 {
+		err, s.failures[selectionLink] = queued[0], queued[1:]
+	}
+	s.mu.Unlock()
+
+	if s.onFetch != nil {
+		s.onFetch(selectionLink)
+	}
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	return []models.SelectionForm{{SelectionName: selectionLink}}, nil
+}
+
+func testRunners(n int) []models.MeetingSelections {
+	runners := make([]models.MeetingSelections, n)
+	for i := range runners {
+		runners[i].SelectionLink = fmt.Sprintf("/horse/%d", i)
+	}
+	return runners
+}
+
+// collect drains the results of FetchForms, failing when the channel is not
+// closed in time
+func collect(t *testing.T, results <-chan FormResult) []FormResult {
+	t.Helper()
+
+	var collected []FormResult
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				return collected
+			}
+			collected = append(collected, result)
+		case <-timeout:
+			t.Fatalf("results still open after %d", len(collected))
+		}
+	}
+}
+
+func TestFetchFormsWorkers(t *testing.T) {
+	tests := []struct {
+		workers int
+		peak    int
+	}{
+		{0, 1},
+		{1, 1},
+		{3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.workers, " workers"), func(t *testing.T) {
+			src := &fakeSource{delay: 20 * time.Millisecond}
+			runners := testRunners(12)
+			opts := FormOptions{Workers: tt.workers, RatePerSecond: 1000, Backoff: time.Millisecond}
+
+			results := collect(t, FetchForms(context.Background(), src, runners, opts))
+			if len(results) != len(runners) {
+				t.Fatalf("got %d results, want one per runner", len(results))
+			}
+			for _, result := range results {
+				if result.Err != nil || len(result.Form) != 1 || result.Form[0].SelectionName != result.Runner.SelectionLink {
+					t.Errorf("got %+v for %s", result, result.Runner.SelectionLink)
+				}
+			}
+			if src.peak > tt.peak {
+				t.Errorf("%d fetches in flight, want at most %d", src.peak, tt.peak)
+			}
+		})
+	}
+}
+
+func TestFetchFormsRetries(t *testing.T) {
+	transient := errors.New("connection reset")
+	zeroRows := &source.ZeroRowsError{Kind: "form", SourceURL: "/horse/0", PreviousRows: 8}
+
+	tests := []struct {
+		name     string
+		failures []error
+		retries  int
+		calls    int
+		err      error
+	}{
+		{"success", nil, 3, 1, nil},
+		{"transient failures", []error{transient, transient}, 3, 3, nil},
+		{"out of retries", []error{transient, transient, transient}, 2, 3, transient},
+		{"no retries", []error{transient}, 0, 1, transient},
+		// The selectors will not match on a second try
+		{"zero rows", []error{zeroRows, zeroRows}, 3, 1, zeroRows},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &fakeSource{failures: map[string][]error{"/horse/0": tt.failures}}
+			opts := FormOptions{Workers: 1, RatePerSecond: 1000, Retries: tt.retries, Backoff: time.Millisecond}
+
+			results := collect(t, FetchForms(context.Background(), src, testRunners(1), opts))
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+			if !errors.Is(results[0].Err, tt.err) {
+				t.Errorf("got %v, want %v", results[0].Err, tt.err)
+			}
+			if src.calls["/horse/0"] != tt.calls {
+				t.Errorf("fetched %d times, want %d", src.calls["/horse/0"], tt.calls)
+			}
+		})
+	}
+}
+
+// TestFetchFormsCancelled stops handing out runners once ctx is cancelled
+// and closes the results without anyone reading the rest
+func TestFetchFormsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := &fakeSource{onFetch: func(link string) {
+		if link == "/horse/2" {
+			cancel()
+		}
+	}}
+	runners := testRunners(100)
+	opts := FormOptions{Workers: 2, RatePerSecond: 1000, Backoff: time.Millisecond}
+
+	collect(t, FetchForms(ctx, src, runners, opts))
+
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if fetched := len(src.calls); fetched >= len(runners) {
+		t.Errorf("fetched all %d runners after the cancellation", fetched)
+	}
+}
+
+// TestFetchFormsCancelledBackoff gives up waiting to retry once ctx is
+// cancelled
+func TestFetchFormsCancelledBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := &fakeSource{
+		failures: map[string][]error{"/horse/0": {errors.New("connection reset")}},
+		onFetch:  func(string) { cancel() },
+	}
+	opts := FormOptions{Workers: 1, RatePerSecond: 1000, Retries: 3, Backoff: time.Hour}
+
+	start := time.Now()
+	form, err := fetchForm(ctx, src, rate.NewLimiter(rate.Inf, 1), "/horse/0", opts)
+	if !errors.Is(err, context.Canceled) || form != nil {
+		t.Errorf("got %v, %v; want %v", form, err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("waited %s for a cancelled retry", elapsed)
+	}
+	if src.calls["/horse/0"] != 1 {
+		t.Errorf("fetched %d times, want 1", src.calls["/horse/0"])
+	}
+}
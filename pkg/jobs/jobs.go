@@ -0,0 +1,221 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// Manager runs jobs in the background and keeps their state in the Jobs table
+type Manager struct {
+	DB *database.DB
+}
+
+// NewManager returns a manager storing jobs in db.
+func NewManager(db *database.DB) *Manager {
+	return &Manager{DB: db}
+}
+
+// RunFunc does the work of a job and reports its progress.
+type RunFunc func(ctx context.Context, progress *Progress) error
+
+// Start records a new job of the given kind and runs fn in the background.
+// The returned job is in the queued state.
+func (m *Manager) Start(kind string, params interface{}, fn RunFunc) (models.Job, error) {
+	encodedParams, err := json.Marshal(params)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	now := time.Now()
+	var id int
+	err = m.DB.QueryRow(`
+		INSERT INTO Jobs (kind, state, params, total, processed, errors, created_at, updated_at)
+		VALUES (?, ?, ?, 0, 0, '[]', ?, ?)
+		RETURNING id`,
+		kind, models.JobQueued, string(encodedParams), now, now).Scan(&id)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	go m.run(id, fn)
+
+	return m.Get(id)
+}
+
+func (m *Manager) run(id int, fn RunFunc) {
+	progress := &Progress{manager: m, id: id}
+
+	_, err := m.DB.Exec(`UPDATE Jobs SET state = ?, started_at = ?, updated_at = ? WHERE id = ?`,
+		models.JobRunning, time.Now(), time.Now(), id)
+	if err != nil {
+		log.Printf("job %d: %v", id, err)
+		return
+	}
+
+	state := models.JobSucceeded
+	if err := fn(context.Background(), progress); err != nil {
+		state = models.JobFailed
+		progress.AddError(err)
+	}
+
+	_, err = m.DB.Exec(`UPDATE Jobs SET state = ?, finished_at = ?, updated_at = ? WHERE id = ?`,
+		state, time.Now(), time.Now(), id)
+	if err != nil {
+		log.Printf("job %d: %v", id, err)
+	}
+}
+
+// MarkInterrupted flags the jobs left queued or running by a previous process.
+func (m *Manager) MarkInterrupted() error {
+	_, err := m.DB.Exec(`UPDATE Jobs SET state = ?, updated_at = ? WHERE state IN (?, ?)`,
+		models.JobInterrupted, time.Now(), models.JobQueued, models.JobRunning)
+	return err
+}
+
+// Get returns the job with the given id.
+func (m *Manager) Get(id int) (models.Job, error) {
+	var job models.Job
+	var encodedErrors, result string
+	var startedAt, finishedAt sql.NullTime
+
+	err := m.DB.QueryRow(`
+		SELECT id, kind, state, params, total, processed, errors, COALESCE(result, ''), started_at, finished_at, created_at, updated_at
+		FROM Jobs WHERE id = ?`, id).
+		Scan(&job.ID, &job.Kind, &job.State, &job.Params, &job.Total, &job.Processed,
+			&encodedErrors, &result, &startedAt, &finishedAt, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return job, err
+	}
+	if result != "" {
+		job.Result = json.RawMessage(result)
+	}
+
+	if err := json.Unmarshal([]byte(encodedErrors), &job.Errors); err != nil {
+		return job, err
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+		end := time.Now()
+		if finishedAt.Valid {
+			job.FinishedAt = &finishedAt.Time
+			end = finishedAt.Time
+		}
+		job.DurationMs = end.Sub(startedAt.Time).Milliseconds()
+	}
+
+	return job, nil
+}
+
+// Progress updates the counters of a running job. A nil Progress ignores
+// every update so the same code can run outside a job.
+type Progress struct {
+	manager *Manager
+	id      int
+	mu      sync.Mutex
+}
+
+// SetTotal sets the number of items the job will process.
+func (p *Progress) SetTotal(total int) {
+	if p == nil {
+		return
+	}
+	p.exec(`UPDATE Jobs SET total = ?, updated_at = ? WHERE id = ?`, total, time.Now(), p.id)
+}
+
+// Done adds n processed items.
+func (p *Progress) Done(n int) {
+	if p == nil {
+		return
+	}
+	p.exec(`UPDATE Jobs SET processed = processed + ?, updated_at = ? WHERE id = ?`, n, time.Now(), p.id)
+}
+
+// SetResult stores what the job produced, encoded as JSON.
+func (p *Progress) SetResult(result interface{}) error {
+	if p == nil {
+		return nil
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	p.exec(`UPDATE Jobs SET result = ?, updated_at = ? WHERE id = ?`, string(encoded), time.Now(), p.id)
+	return nil
+}
+
+// AddError appends err to the errors of the job without failing it.
+func (p *Progress) AddError(err error) {
+	if p == nil || err == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var encodedErrors string
+	if err := p.manager.DB.QueryRow(`SELECT errors FROM Jobs WHERE id = ?`, p.id).Scan(&encodedErrors); err != nil {
+		log.Printf("job %d: %v", p.id, err)
+		return
+	}
+	var jobErrors []string
+	if err := json.Unmarshal([]byte(encodedErrors), &jobErrors); err != nil {
+		log.Printf("job %d: reading its errors: %v", p.id, err)
+	}
+	jobErrors = append(jobErrors, err.Error())
+	updated, err := json.Marshal(jobErrors)
+	if err != nil {
+		log.Printf("job %d: %v", p.id, err)
+		return
+	}
+
+	if _, err := p.manager.DB.Exec(`UPDATE Jobs SET errors = ?, updated_at = ? WHERE id = ?`, string(updated), time.Now(), p.id); err != nil {
+		log.Printf("job %d: %v", p.id, err)
+	}
+}
+
+func (p *Progress) exec(query string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.manager.DB.Exec(query, args...); err != nil {
+		log.Printf("job %d: %v", p.id, err)
+	}
+}
+
+// GetJob godoc
+// @Summary Get a job
+// @Description Get the state, progress and errors of a background job
+// @Tags jobs
+// @Produce  json
+// @Param id path int true "Job ID"
+// @Success 200 {object} models.Job
+// @Router /jobs/{id} [get]
+func (m *Manager) GetJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid job id %q", c.Param("id"))})
+		return
+	}
+
+	job, err := m.Get(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
@@ -0,0 +1,204 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// newTestManager returns a manager over a migrated in-memory SQLite database
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := database.OpenDSN(database.SQLite, fmt.Sprintf("file:%s?mode=memory&cache=shared&_busy_timeout=5000", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(db)
+}
+
+// wait returns the job once it left the queued and running states
+func wait(t *testing.T, m *Manager, id int) models.Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.State != models.JobQueued && job.State != models.JobRunning {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d still %s", id, job.State)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStart(t *testing.T) {
+	m := newTestManager(t)
+
+	release := make(chan struct{})
+	job, err := m.Start("analysis", map[string]string{"event_date": "2024-10-05"}, func(ctx context.Context, progress *Progress) error {
+		<-release
+		progress.SetTotal(3)
+		progress.Done(1)
+		progress.Done(1)
+		progress.AddError(errors.New("selection 7 has no form"))
+		return progress.SetResult(map[string]int{"analysed": 2})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID == 0 || job.Kind != "analysis" || job.Params != `{"event_date":"2024-10-05"}` {
+		t.Errorf("started %+v", job)
+	}
+	if job.State != models.JobQueued && job.State != models.JobRunning {
+		t.Errorf("started in state %s, want it queued or running", job.State)
+	}
+	close(release)
+
+	job = wait(t, m, job.ID)
+	if job.State != models.JobSucceeded {
+		t.Fatalf("finished %s, want %s", job.State, models.JobSucceeded)
+	}
+	if job.Total != 3 || job.Processed != 2 {
+		t.Errorf("processed %d of %d, want 2 of 3", job.Processed, job.Total)
+	}
+	if len(job.Errors) != 1 || job.Errors[0] != "selection 7 has no form" {
+		t.Errorf("got errors %q, want the one added without failing the job", job.Errors)
+	}
+	if string(job.Result) != `{"analysed":2}` {
+		t.Errorf("got result %s", job.Result)
+	}
+	if job.StartedAt == nil || job.FinishedAt == nil || job.DurationMs < 0 {
+		t.Errorf("started at %v, finished at %v", job.StartedAt, job.FinishedAt)
+	}
+}
+
+func TestStartFailed(t *testing.T) {
+	m := newTestManager(t)
+
+	job, err := m.Start("meetings", nil, func(ctx context.Context, progress *Progress) error {
+		progress.AddError(errors.New("page 1 timed out"))
+		return errors.New("the racecards did not load")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job = wait(t, m, job.ID)
+	if job.State != models.JobFailed {
+		t.Fatalf("finished %s, want %s", job.State, models.JobFailed)
+	}
+	want := []string{"page 1 timed out", "the racecards did not load"}
+	if strings.Join(job.Errors, "|") != strings.Join(want, "|") {
+		t.Errorf("got errors %q, want %q", job.Errors, want)
+	}
+	if job.Result != nil {
+		t.Errorf("got result %s from a failed job", job.Result)
+	}
+}
+
+// TestMarkInterrupted flags the jobs a previous process left unfinished on
+// restart, and only those
+func TestMarkInterrupted(t *testing.T) {
+	m := newTestManager(t)
+
+	states := []string{models.JobQueued, models.JobRunning, models.JobSucceeded, models.JobFailed}
+	ids := make(map[string]int)
+	for _, state := range states {
+		var id int
+		err := m.DB.QueryRow(`
+			INSERT INTO Jobs (kind, state, params, total, processed, errors, created_at, updated_at)
+			VALUES ('forms', ?, '{}', 0, 0, '[]', ?, ?)
+			RETURNING id`, state, time.Now(), time.Now()).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[state] = id
+	}
+
+	if err := m.MarkInterrupted(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		models.JobQueued:    models.JobInterrupted,
+		models.JobRunning:   models.JobInterrupted,
+		models.JobSucceeded: models.JobSucceeded,
+		models.JobFailed:    models.JobFailed,
+	}
+	for state, id := range ids {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.State != want[state] {
+			t.Errorf("%s job is %s after a restart, want %s", state, job.State, want[state])
+		}
+	}
+}
+
+// TestNilProgress runs the code of a job outside one
+func TestNilProgress(t *testing.T) {
+	var progress *Progress
+	progress.SetTotal(3)
+	progress.Done(1)
+	progress.AddError(errors.New("ignored"))
+	if err := progress.SetResult(1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetJob(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newTestManager(t)
+
+	job, err := m.Start("results", nil, func(ctx context.Context, progress *Progress) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, job.ID)
+
+	router := gin.New()
+	router.GET("/jobs/:id", m.GetJob)
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{fmt.Sprintf("/jobs/%d", job.ID), http.StatusOK},
+		{"/jobs/999", http.StatusNotFound},
+		{"/jobs/latest", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if recorder.Code != tt.status {
+			t.Errorf("GET %s: got %d, want %d", tt.path, recorder.Code, tt.status)
+		}
+	}
+
+	if _, err := m.Get(999); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("got %v for a job that does not exist, want sql.ErrNoRows", err)
+	}
+}
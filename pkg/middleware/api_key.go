@@ -3,17 +3,17 @@ package middleware
 import (
 	"net/http"
 
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
+
 	"github.com/gin-gonic/gin"
-	"github.com/mmanjoura/clean-bet-backend/pkg/database"
 )
 
-func APIKeyAuth() gin.HandlerFunc {
+func APIKeyAuth(cfg *config.Manager) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 
-		config := database.Database.Config
 		apiKey := c.GetHeader("JWT-API-KEY")
-		if apiKey == config["JWT-API-KEY"] {
+		if apiKey == cfg.Current().JWTKey {
 
 			c.Next()
 		} else {
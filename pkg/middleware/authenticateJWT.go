@@ -1,102 +1,92 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
-	auth "github.com/mmanjoura/clean-bet-backend/pkg/auth"
-	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/config"
 	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/store"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 )
 
-func JWTAuth() gin.HandlerFunc {
+// JWTAuth lets through the requests carrying a login token signed with the
+// current JWT key and sets the user they belong to
+func JWTAuth(users store.UserStore, cfg *config.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenStr, err := c.Cookie("Authorization")
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot Get Authorization token"})
+		user, message := tokenUser(c, users, cfg)
+		if message != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": message})
 			c.Abort()
 			return
 		}
 
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			return auth.JwtKey, nil
-		})
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Cannot parse token"})
-			c.Abort()
-			return
+		c.Set("user", user)
+		c.Next()
+	}
+}
+
+// OptionalJWTAuth lets through every request and, as JWTAuth, sets the user
+// of those carrying a valid login token
+func OptionalJWTAuth(users store.UserStore, cfg *config.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user, message := tokenUser(c, users, cfg); message == "" {
+			c.Set("user", user)
 		}
+		c.Next()
+	}
+}
 
-		claims := jwt.MapClaims{}
-		var ok bool
-		if claims, ok = token.Claims.(jwt.MapClaims); ok && token.Valid {
-			exp := claims["exp"].(float64)
-			if exp < float64(time.Now().Unix()) {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "token expired"})
-				c.Abort()
-				return
-			}
+// tokenUser returns the user the login token of a request belongs to, or why
+// the token does not authenticate one
+func tokenUser(c *gin.Context, users store.UserStore, cfg *config.Manager) (models.User, string) {
+	tokenStr, err := c.Cookie("Authorization")
+	if err != nil {
+		return models.User{}, "cannot Get Authorization token"
+	}
 
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token when mapping Claims"})
-			c.Abort()
-			return
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
 		}
+		return []byte(cfg.Current().JWTKey), nil
+	})
+	if err != nil {
+		return models.User{}, "Cannot parse token"
+	}
 
-		if !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
-		}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return models.User{}, "Invalid token when mapping Claims"
+	}
+	if exp, _ := claims["exp"].(float64); exp < float64(time.Now().Unix()) {
+		return models.User{}, "token expired"
+	}
 
-		user, err := getUser(c, claims["iss"].(string))
+	email, _ := claims["iss"].(string)
+	user, err := users.ByEmail(c, email)
+	if err != nil {
+		return models.User{}, "Error when getting user from token"
+	}
+	if user.ID == 0 {
+		return models.User{}, "User is not found"
+	}
 
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Error when getting user from token"})
-			c.Abort()
-			return
-		}
+	return user, ""
+}
 
-		if user.ID == 0 {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User is not found"})
+// RequireAdmin lets through the users JWTAuth found to be admins
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("user")
+		if user, ok := value.(models.User); !ok || user.UserType != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
 			c.Abort()
 			return
 		}
-
-		c.Set("user", user)
 		c.Next()
 	}
 }
-
-func getUser(c *gin.Context, userEmail string) (models.User, error) {
-	db := database.Database.DB
-
-	user := models.User{}
-
-	err := db.QueryRowContext(c, `
-	SELECT id,
-       full_name,
-       email,
-       password,
-	   user_type,
-       Updated_At,
-       Created_At
-  FROM Users WHERE email = ?`, userEmail).
-		Scan(&user.ID,
-			&user.FullName,
-			&user.Email,
-			&user.Password,
-			&user.UserType,
-			&user.UpdatedAt,
-			&user.CreatedAt,
-		)
-
-	if err != nil {
-		return user, err
-	}
-
-	return user, nil
-}
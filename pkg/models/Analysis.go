@@ -10,8 +10,10 @@ type AnalysisDataResponse struct {
 	RaceConditon    RaceConditon      `json:"race_condition"`
 	UkBetValue      float64           `json:"uk_bet_value"`
 	UKReturn        float64           `json:"uk_return"`
+	UKProfit        float64           `json:"uk_profit"`
 	IrelandBetValue float64           `json:"ireland_bet_value"`
 	IrelandReturn   float64           `json:"ireland_return"`
+	IrelandProfit   float64           `json:"ireland_profit"`
 }
 
 type AnalysisData struct {
@@ -57,8 +59,19 @@ type AnalysisData struct {
 	PreferedDistance float64   `json:"prefered_distance"`
 	AvgPosition      float64   `json:"avg_position"`
 	AvgRating        float64   `json:"avg_rating"`
+	Seed             int64     `json:"seed"`
+	Profile          string    `json:"profile"`
 	CreateAt         time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
+
+	// Components of TotalScore, saved to AnalysisBreakdown
+	Components []ComponentScore `json:"components"`
+	// WinProbability is the chance of winning the race given TotalScore
+	WinProbability float64 `json:"win_probability"`
+	// Stake is the amount staked on the selection when it was analysed: the
+	// configured bet value, on both parts of an each-way BetType
+	Stake   float64 `json:"stake"`
+	BetType string  `json:"bet_type"`
 }
 
 // RaceData holds individual race information
@@ -90,6 +103,104 @@ type RaceParameters struct {
 	Ages           string `json:"ages"`
 	BetAmount      string `json:"bet_amount"`
 	NumRunAnalysis string `json:"num_run_analysis"`
+	// Seed of the random source of the run, 0 derives it from EventDate
+	Seed int64 `json:"seed"`
+	// Profile names the score_constants the runners are scored with,
+	// DefaultScoringProfile when empty
+	Profile string `json:"profile"`
+}
+
+// DefaultScoringProfile is the scoring profile seeded by the migrations, the
+// other profiles fall back to its categories
+const DefaultScoringProfile = "default"
+
+// ScoreConstant is a row of a scoring profile. Band categories hold the
+// points of each limit, keyed by the limit, plus an "otherwise" item.
+type ScoreConstant struct {
+	Category string  `json:"category" binding:"required"`
+	Item     string  `json:"item" binding:"required"`
+	Score    float64 `json:"score"`
+}
+
+// ComponentScore is the part of a runner's score due to one component: the
+// points of the band Value falls in, times the weight of the profile
+type ComponentScore struct {
+	Component string  `json:"component"`
+	Value     float64 `json:"value"`
+	Points    float64 `json:"points"`
+	Weight    float64 `json:"weight"`
+	Score     float64 `json:"score"`
+}
+
+// AnalysisBreakdown explains the clean_bet_score of an analysed runner, its
+// components add up to it
+type AnalysisBreakdown struct {
+	SelectionID    int              `json:"selection_id"`
+	SelectionName  string           `json:"selection_name"`
+	EventName      string           `json:"event_name"`
+	EventDate      string           `json:"event_date"`
+	EventTime      string           `json:"event_time"`
+	Profile        string           `json:"profile"`
+	Seed           int64            `json:"seed"`
+	CleanBetScore  float64          `json:"clean_bet_score"`
+	WinProbability float64          `json:"win_probability"`
+	Components     []ComponentScore `json:"components"`
+}
+
+// CalibrationBucket compares the win probabilities of a range with how often
+// the runners in it won
+type CalibrationBucket struct {
+	Lower           float64 `json:"lower"`
+	Upper           float64 `json:"upper"`
+	Runners         int     `json:"runners"`
+	Winners         int     `json:"winners"`
+	MeanProbability float64 `json:"mean_probability"`
+	WinRate         float64 `json:"win_rate"`
+}
+
+// CalibrationReport measures the win probabilities of the settled runners
+// of a profile. FittedScale is the win probability scale the results are
+// most likely under, nil when they do not settle it.
+type CalibrationReport struct {
+	Profile     string              `json:"profile"`
+	From        string              `json:"from"`
+	To          string              `json:"to"`
+	Races       int                 `json:"races"`
+	Runners     int                 `json:"runners"`
+	Winners     int                 `json:"winners"`
+	BrierScore  float64             `json:"brier_score"`
+	LogLoss     float64             `json:"log_loss"`
+	Scale       float64             `json:"scale"`
+	FittedScale *float64            `json:"fitted_scale"`
+	Buckets     []CalibrationBucket `json:"buckets"`
+}
+
+// ValueBet compares the win probability of a runner with its declared price.
+// MarketProbability is the probability implied by the price with the
+// overround of the analysed runners of the race taken out, ExpectedValue the profit of a unit stake
+// at the price and Edge how far WinProbability beats MarketProbability, as a
+// fraction of it.
+type ValueBet struct {
+	SelectionID        int     `json:"selection_id"`
+	SelectionName      string  `json:"selection_name"`
+	EventName          string  `json:"event_name"`
+	EventDate          string  `json:"event_date"`
+	EventTime          string  `json:"event_time"`
+	Profile            string  `json:"profile"`
+	CleanBetScore      float64 `json:"clean_bet_score"`
+	Price              string  `json:"price"`
+	DecimalOdds        float64 `json:"decimal_odds"`
+	Overround          float64 `json:"overround"`
+	ImpliedProbability float64 `json:"implied_probability"`
+	MarketProbability  float64 `json:"market_probability"`
+	WinProbability     float64 `json:"win_probability"`
+	ExpectedValue      float64 `json:"expected_value"`
+	Edge               float64 `json:"edge"`
+}
+
+// ScoringProfileUpdate is the body of PUT /admin/scoring-profiles/:name
+type ScoringProfileUpdate struct {
+	Constants []ScoreConstant `json:"constants" binding:"required,dive"`
 }
 
 type CurrentHorseData struct {
@@ -203,15 +314,35 @@ type EventPrediction struct {
 	PotentialReturn      string    `json:"potential_return"`
 	CurrentEventPrice    string    `json:"current_event_price"`
 	CurrentEventPosition string    `json:"current_event_position"`
+	Seed                 int64     `json:"seed"`
+	Profile              string    `json:"profile"`
+	WinProbability       float64   `json:"win_probability"`
 	CreatedAt            time.Time `json:"created_at"`
 	UpdatedAt            time.Time `json:"updated_at"`
+
+	// The bet on the selection, settled once CurrentEventPrice is set
+	BetType     string      `json:"bet_type"`
+	Stake       float64     `json:"stake"`
+	PlaceTerms  *PlaceTerms `json:"place_terms,omitempty"`
+	GrossReturn float64     `json:"gross_return"`
+	NetProfit   float64     `json:"net_profit"`
+
+	// RecommendedStake is what the staking plan of the request stakes on
+	// the selection to win at its declared price
+	RecommendedStake float64 `json:"recommended_stake"`
 }
 
+// EventPredictionResponse is the body of POST /racing/predictions, the totals
+// are those of the settled selections. The stakes of the selections are
+// recommended by Staking on a bank of Bank.
 type EventPredictionResponse struct {
 	Selections  []EventPrediction `json:"selections"`
 	TotalBet    float64           `json:"total_bet"`
 	TotalReturn float64           `json:"total_return"`
+	TotalProfit float64           `json:"total_profit"`
 	Status      string            `json:"status"`
+	Staking     StakingPlan       `json:"staking"`
+	Bank        float64           `json:"bank"`
 }
 
 type GetWinnerParams struct {
@@ -223,6 +354,11 @@ type GetWinnerParams struct {
 	Stake       int    `json:"stake"`
 	MeetingName string `json:"meeting_name"`
 	Region      string `json:"region"`
+	Profile     string `json:"profile"`
+
+	// Staking sizes the recommended stakes of predictions, the saved plan of
+	// the user or a level Stake, the configured bet value by default, when nil
+	Staking *StakingPlan `json:"staking"`
 }
 
 type HistoricalData struct {
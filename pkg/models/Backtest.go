@@ -0,0 +1,123 @@
+package models
+
+import "time"
+
+// Staking rules of a backtest, and plans of a StakingPlan
+const (
+	StakingLevel      = "level"
+	StakingPercentage = "percentage"
+	// StakingKelly stakes the Kelly fraction of the bank, predictions only
+	StakingKelly = "kelly"
+)
+
+// BacktestParameters is the body of POST /backtests
+type BacktestParameters struct {
+	// Name labels the backtest to compare it with others
+	Name string `json:"name"`
+	From string `json:"from" binding:"required"`
+	To   string `json:"to"`
+	// Profile is the scoring profile, DefaultScoringProfile when empty
+	Profile string `json:"profile"`
+	// Picks is the number of top scored runners backed in each race, 1 by
+	// default, runners scoring under MinScore are never backed
+	Picks    int     `json:"picks"`
+	MinScore float64 `json:"min_score"`
+	// Staking is StakingLevel, Stake on every bet (the configured bet value
+	// by default), or StakingPercentage, Percent of the running Bank
+	Staking string  `json:"staking"`
+	Stake   float64 `json:"stake"`
+	Percent float64 `json:"percent"`
+	Bank    float64 `json:"bank"`
+}
+
+// BacktestPnL is the profit and loss of the bets of a course or region
+type BacktestPnL struct {
+	Bets    int     `json:"bets"`
+	Winners int     `json:"winners"`
+	Staked  float64 `json:"staked"`
+	Profit  float64 `json:"profit"`
+	ROI     float64 `json:"roi"`
+}
+
+// Backtest is a stored backtest run with its metrics. StrikeRate and ROI are
+// fractions, drawdowns are in stake currency.
+type Backtest struct {
+	ID               int                    `json:"id"`
+	Name             string                 `json:"name"`
+	Profile          string                 `json:"profile"`
+	From             string                 `json:"from"`
+	To               string                 `json:"to"`
+	Params           BacktestParameters     `json:"params"`
+	Races            int                    `json:"races"`
+	Bets             int                    `json:"bets"`
+	Winners          int                    `json:"winners"`
+	Unsettled        int                    `json:"unsettled"`
+	StrikeRate       float64                `json:"strike_rate"`
+	Staked           float64                `json:"staked"`
+	Returned         float64                `json:"returned"`
+	Profit           float64                `json:"profit"`
+	ROI              float64                `json:"roi"`
+	MaxDrawdown      float64                `json:"max_drawdown"`
+	LongestLosingRun int                    `json:"longest_losing_run"`
+	PerCourse        map[string]BacktestPnL `json:"per_course"`
+	PerRegion        map[string]BacktestPnL `json:"per_region"`
+	CreatedAt        time.Time              `json:"created_at"`
+}
+
+// Searches of the optimiser
+const (
+	SearchGrid   = "grid"
+	SearchRandom = "random"
+)
+
+// OptimiseParameters is the body of POST /admin/scoring-profiles/:name/optimise
+type OptimiseParameters struct {
+	// Base is the profile the candidates start from, DefaultScoringProfile
+	// when empty
+	Base string `json:"base"`
+	// Candidates are fitted on the training window and the best one is
+	// validated on the test window that follows it. The test window starts
+	// the day after TrainTo and lasts as long as the training one by default.
+	TrainFrom string `json:"train_from" binding:"required"`
+	TrainTo   string `json:"train_to" binding:"required"`
+	TestFrom  string `json:"test_from"`
+	TestTo    string `json:"test_to"`
+	// Search is SearchGrid, every combination of Steps as component weights,
+	// or SearchRandom, Iterations weights drawn up to MaxWeight with band
+	// limits scaled by up to LimitSpread either way, from Seed
+	Search      string    `json:"search"`
+	Steps       []float64 `json:"steps"`
+	Iterations  int       `json:"iterations"`
+	MaxWeight   float64   `json:"max_weight"`
+	LimitSpread float64   `json:"limit_spread"`
+	Seed        int64     `json:"seed"`
+	// Objective is what the best candidate maximises on the training
+	// window: roi, profit or strike_rate. Candidates with fewer than MinBets
+	// training bets are not considered.
+	Objective string `json:"objective"`
+	MinBets   int    `json:"min_bets"`
+	// Picks and the staking rule of the backtests, as in BacktestParameters
+	Picks    int     `json:"picks"`
+	MinScore float64 `json:"min_score"`
+	Staking  string  `json:"staking"`
+	Stake    float64 `json:"stake"`
+	Percent  float64 `json:"percent"`
+	Bank     float64 `json:"bank"`
+}
+
+// Optimisation is the outcome of an optimiser run: the profile saved and its
+// backtests on the training window and, out of sample, on the test window,
+// next to the base profile on the test window. Parameters is the mean form of
+// the winners the profile backed on the training window.
+type Optimisation struct {
+	Profile      string             `json:"profile"`
+	Params       OptimiseParameters `json:"params"`
+	Candidates   int                `json:"candidates"`
+	Weights      map[string]float64 `json:"weights"`
+	LimitFactors map[string]float64 `json:"limit_factors"`
+	Constants    []ScoreConstant    `json:"constants"`
+	Parameters   OptimalParameters  `json:"parameters"`
+	InSample     Backtest           `json:"in_sample"`
+	OutOfSample  Backtest           `json:"out_of_sample"`
+	Baseline     Backtest           `json:"baseline"`
+}
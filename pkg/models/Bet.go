@@ -0,0 +1,125 @@
+package models
+
+import "time"
+
+// Types of bet
+const (
+	BetTypeWin = "win"
+	// BetTypeEachWay is a bet of the same stake to win and to place
+	BetTypeEachWay = "each_way"
+)
+
+// Outcomes of a settled bet
+const (
+	OutcomeWon  = "won"
+	OutcomeLost = "lost"
+	// OutcomePlaced is the each-way bet on a runner placed but not first
+	OutcomePlaced = "placed"
+	// OutcomeVoid is the bet on a non-runner, its stake is returned
+	OutcomeVoid = "void"
+)
+
+// PlaceTerms are the each-way terms of a race: the first Places runners pay
+// 1/Fraction of the odds on the place part
+type PlaceTerms struct {
+	Places   int `json:"places"`
+	Fraction int `json:"fraction"`
+}
+
+// Settlement is what a bet of Stake at Price paid: GrossReturn includes the
+// stake returned on a winner, NetProfit is GrossReturn less Stake. The Stake
+// of an each-way bet covers both parts.
+type Settlement struct {
+	BetType     string      `json:"bet_type"`
+	Stake       float64     `json:"stake"`
+	Price       string      `json:"price"`
+	PlaceTerms  *PlaceTerms `json:"place_terms,omitempty"`
+	Outcome     string      `json:"outcome"`
+	GrossReturn float64     `json:"gross_return"`
+	NetProfit   float64     `json:"net_profit"`
+}
+
+// BetStatusOpen is the status of a bet whose race has no result yet, settled
+// bets take the Outcome they were settled with
+const BetStatusOpen = "open"
+
+// BetRequest is the body of POST /bets, a bet placed on a selection analysed
+// for EventDate
+type BetRequest struct {
+	SelectionID int    `json:"selection_id" binding:"required"`
+	EventDate   string `json:"event_date" binding:"required"`
+	// BetType is BetTypeWin, the default, or BetTypeEachWay
+	BetType string `json:"bet_type"`
+	// Stake is the amount staked on each part of an each-way bet
+	Stake float64 `json:"stake" binding:"required"`
+	// Price is the price taken, the declared price of the analysis when empty
+	Price string `json:"price"`
+	// PlaceTerms of an each-way bet, the standard terms of the declared field
+	// of a non-handicap when nil
+	PlaceTerms *PlaceTerms `json:"place_terms"`
+}
+
+// StakingPlan is how the stakes recommended on predictions are sized: Stake
+// on every bet for StakingLevel, Percent of the Bank for StakingPercentage,
+// or KellyFraction of the Kelly stake on the Bank for StakingKelly, 1 for
+// full Kelly and 0.5 for half Kelly. No stake is ever above MaxStake, unless
+// it is 0.
+type StakingPlan struct {
+	Plan          string  `json:"plan"`
+	Stake         float64 `json:"stake"`
+	Percent       float64 `json:"percent"`
+	Bank          float64 `json:"bank"`
+	KellyFraction float64 `json:"kelly_fraction"`
+	MaxStake      float64 `json:"max_stake"`
+}
+
+// Bet is a bet a user placed on an analysed selection. Stake covers both parts
+// of an each-way bet, GrossReturn and NetProfit are set once it is settled.
+type Bet struct {
+	ID            int         `json:"id"`
+	UserID        int         `json:"user_id"`
+	SelectionID   int         `json:"selection_id"`
+	SelectionName string      `json:"selection_name"`
+	EventName     string      `json:"event_name"`
+	EventDate     string      `json:"event_date"`
+	EventTime     string      `json:"event_time"`
+	BetType       string      `json:"bet_type"`
+	Stake         float64     `json:"stake"`
+	Price         string      `json:"price"`
+	PlaceTerms    *PlaceTerms `json:"place_terms,omitempty"`
+	Status        string      `json:"status"`
+	Position      string      `json:"position,omitempty"`
+	GrossReturn   *float64    `json:"gross_return,omitempty"`
+	NetProfit     *float64    `json:"net_profit,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	SettledAt     *time.Time  `json:"settled_at,omitempty"`
+}
+
+// BankrollPoint is the bankroll at the end of a race day: the day's settled
+// bets and the running totals of every day up to it. ROI is a fraction,
+// Drawdown the fall of Balance from its highest.
+type BankrollPoint struct {
+	Date     string  `json:"date"`
+	Bets     int     `json:"bets"`
+	Staked   float64 `json:"staked"`
+	Returned float64 `json:"returned"`
+	Profit   float64 `json:"profit"`
+	Balance  float64 `json:"balance"`
+	ROI      float64 `json:"roi"`
+	Drawdown float64 `json:"drawdown"`
+}
+
+// Bankroll is the body of GET /bankroll, the settled bets of a user from a
+// starting Bank, day by day. Open is the amount staked on open bets.
+type Bankroll struct {
+	Bank        float64         `json:"bank"`
+	Bets        int             `json:"bets"`
+	Staked      float64         `json:"staked"`
+	Returned    float64         `json:"returned"`
+	Profit      float64         `json:"profit"`
+	Balance     float64         `json:"balance"`
+	ROI         float64         `json:"roi"`
+	MaxDrawdown float64         `json:"max_drawdown"`
+	Open        float64         `json:"open"`
+	Series      []BankrollPoint `json:"series"`
+}
@@ -1,7 +1,26 @@
 package models
 
+import "time"
+
 type Configuration struct {
 	ID    int    `json:"id"`
 	Key   string `json:"key" binding:"required"`
 	Value string `json:"value" binding:"required"`
 }
+
+// ConfigUpdate is the body of PUT /admin/config, settings are keyed like the
+// rows of the Configurations table
+type ConfigUpdate struct {
+	Settings map[string]string `json:"settings" binding:"required"`
+}
+
+// ConfigAudit records a change made to a setting through the admin API
+type ConfigAudit struct {
+	ID        int       `json:"id"`
+	Key       string    `json:"key"`
+	OldValue  *string   `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	UserID    int       `json:"user_id"`
+	ChangedBy string    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job states
+const (
+	JobQueued      = "queued"
+	JobRunning     = "running"
+	JobSucceeded   = "succeeded"
+	JobFailed      = "failed"
+	JobInterrupted = "interrupted"
+)
+
+// Job is a background ingestion or analysis run. Result is what the job
+// produced, for the kinds that produce more than stored rows.
+type Job struct {
+	ID         int             `json:"id"`
+	Kind       string          `json:"kind"`
+	State      string          `json:"state"`
+	Params     string          `json:"params"`
+	Total      int             `json:"total"`
+	Processed  int             `json:"processed"`
+	Errors     []string        `json:"errors"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	DurationMs int64           `json:"duration_ms"`
+	StartedAt  *time.Time      `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
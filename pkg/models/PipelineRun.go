@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Pipeline run states
+const (
+	StageRunning   = "running"
+	StageSucceeded = "succeeded"
+	StageFailed    = "failed"
+	StageSkipped   = "skipped"
+)
+
+// PipelineRun records one stage of the daily pipeline run for a race date
+type PipelineRun struct {
+	ID         int        `json:"id"`
+	RunDate    string     `json:"run_date"`
+	Stage      string     `json:"stage"`
+	State      string     `json:"state"`
+	Error      string     `json:"error"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// PipelineDay summarises the latest run of every stage for a race date
+type PipelineDay struct {
+	RunDate  string                 `json:"run_date"`
+	Complete bool                   `json:"complete"`
+	Stages   map[string]PipelineRun `json:"stages"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ScrapeRun records a single page fetched from the racing source
+type ScrapeRun struct {
+	ID         int       `json:"id"`
+	Kind       string    `json:"kind"`
+	SourceURL  string    `json:"source_url"`
+	StatusCode int       `json:"status_code"`
+	Rows       int       `json:"rows_extracted"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,216 @@
+// Package odds parses the prices quoted on racecards and the starting prices
+// of results, fractional ("11/4"), decimal ("3.75") or evens ("Evs"), and
+// converts them between formats and to implied probabilities.
+package odds
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Favourite markers following a starting price, "5/2F" or "7/2JF"
+const (
+	Favourite      = "F"
+	JointFavourite = "JF"
+	CoFavourite    = "CF"
+)
+
+var (
+	// ErrNonRunner is returned for the prices of runners that did not run or
+	// are not priced: "", "-" or "NR"
+	ErrNonRunner = errors.New("non-runner")
+	// ErrNoPrice is returned for runners that ran without a price shown:
+	// "SP" before the starting price is returned, or a favourite marker alone
+	ErrNoPrice = errors.New("no price")
+	// ErrInvalid is returned for prices that do not read as odds
+	ErrInvalid = errors.New("invalid odds")
+)
+
+// maxDenominator bounds the fractions decimal odds are converted to
+const maxDenominator = 100
+
+// Odds is a price of Numerator to Denominator, as quoted: 100/30 is not
+// reduced to 10/3. Favourite is the marker it was quoted with, if any.
+type Odds struct {
+	Numerator   int64  `json:"numerator"`
+	Denominator int64  `json:"denominator"`
+	Favourite   string `json:"favourite,omitempty"`
+}
+
+// Evens is the price of 1/1
+var Evens = Odds{Numerator: 1, Denominator: 1}
+
+// Clean trims a scraped price and undoes the doubling of pages that print it
+// twice, "11/411/4" or "EvsEvs". Numbers such as "11" are left alone.
+func Clean(price string) string {
+	price = strings.TrimSpace(price)
+	if _, err := strconv.ParseFloat(price, 64); err == nil {
+		return price
+	}
+	if half := len(price) / 2; len(price)%2 == 0 && half > 0 && price[:half] == price[half:] {
+		return price[:half]
+	}
+	return price
+}
+
+// Parse reads a price: fractional, decimal or evens, with or without a
+// favourite marker in either case. Non-runners and prices without a value
+// return ErrNonRunner, "SP" and a marker without a price ErrNoPrice, and
+// anything else that is not odds ErrInvalid. A whole number such as "2" is
+// rejected as it could be 2/1 as well as decimal 2.0.
+func Parse(price string) (Odds, error) {
+	price = Clean(price)
+	switch strings.ToUpper(price) {
+	case "", "-", "NR", "N/R":
+		return Odds{}, ErrNonRunner
+	case "SP", JointFavourite, CoFavourite, Favourite:
+		return Odds{}, ErrNoPrice
+	}
+
+	var favourite string
+	for _, marker := range []string{JointFavourite, CoFavourite, Favourite} {
+		if strings.HasSuffix(strings.ToUpper(price), marker) {
+			price, favourite = price[:len(price)-len(marker)], marker
+			break
+		}
+	}
+
+	var odds Odds
+	var err error
+	switch strings.ToLower(price) {
+	case "evs", "evens", "even":
+		odds = Evens
+	default:
+		if numerator, denominator, ok := cutFraction(price); ok {
+			odds, err = fraction(numerator, denominator)
+		} else if _, whole := strconv.ParseInt(price, 10, 64); whole == nil {
+			err = ErrInvalid
+		} else {
+			var decimal float64
+			decimal, err = strconv.ParseFloat(price, 64)
+			if err == nil {
+				odds, err = FromDecimal(decimal)
+			}
+		}
+	}
+	if err != nil {
+		return Odds{}, fmt.Errorf("%w %q", ErrInvalid, price)
+	}
+
+	odds.Favourite = favourite
+	return odds, nil
+}
+
+// cutFraction splits "11/4" or "11-4" into its numerator and denominator
+func cutFraction(price string) (string, string, bool) {
+	if numerator, denominator, ok := strings.Cut(price, "/"); ok {
+		return numerator, denominator, true
+	}
+	return strings.Cut(price, "-")
+}
+
+// fraction returns the odds of numerator to denominator, both positive
+// integers
+func fraction(numerator, denominator string) (Odds, error) {
+	num, err := strconv.ParseInt(strings.TrimSpace(numerator), 10, 64)
+	if err != nil {
+		return Odds{}, err
+	}
+	den, err := strconv.ParseInt(strings.TrimSpace(denominator), 10, 64)
+	if err != nil {
+		return Odds{}, err
+	}
+	if num <= 0 || den <= 0 {
+		return Odds{}, ErrInvalid
+	}
+	return Odds{Numerator: num, Denominator: den}, nil
+}
+
+// FromDecimal returns the reduced fraction of decimal odds, exact when its
+// denominator is at most 100 and the nearest hundredth otherwise
+func FromDecimal(decimal float64) (Odds, error) {
+	if math.IsNaN(decimal) || math.IsInf(decimal, 0) || decimal <= 1 {
+		return Odds{}, fmt.Errorf("%w %g, decimal odds must be above 1", ErrInvalid, decimal)
+	}
+	toOne := decimal - 1
+	for den := int64(1); den <= maxDenominator; den++ {
+		num := math.Round(toOne * float64(den))
+		if num >= 1 && math.Abs(num/float64(den)-toOne) < 1e-9 {
+			return reduce(int64(num), den), nil
+		}
+	}
+	return reduce(max(int64(math.Round(toOne*maxDenominator)), 1), maxDenominator), nil
+}
+
+func reduce(num, den int64) Odds {
+	a, b := num, den
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return Odds{Numerator: num / a, Denominator: den / a}
+}
+
+// IsZero reports whether o is the zero Odds, the odds of no price
+func (o Odds) IsZero() bool {
+	return o.Denominator == 0
+}
+
+// ToOne returns the fractional odds as a number, 2.75 for 11/4
+func (o Odds) ToOne() float64 {
+	if o.IsZero() {
+		return 0
+	}
+	return float64(o.Numerator) / float64(o.Denominator)
+}
+
+// Decimal returns the decimal odds, the return of a unit stake: 3.75 for 11/4
+func (o Odds) Decimal() float64 {
+	if o.IsZero() {
+		return 0
+	}
+	return o.ToOne() + 1
+}
+
+// ImpliedProbability returns the probability of winning the price implies,
+// the overround of the book left in
+func (o Odds) ImpliedProbability() float64 {
+	if o.IsZero() {
+		return 0
+	}
+	return float64(o.Denominator) / float64(o.Numerator+o.Denominator)
+}
+
+// Profit returns what a winning stake wins at the price, the stake excluded
+func (o Odds) Profit(stake float64) float64 {
+	return stake * o.ToOne()
+}
+
+// Return returns what a winning stake pays back at the price, the stake
+// included
+func (o Odds) Return(stake float64) float64 {
+	return stake * o.Decimal()
+}
+
+// Fractional returns the fractional odds without the favourite marker,
+// "11/4" or "Evs"
+func (o Odds) Fractional() string {
+	switch {
+	case o.IsZero():
+		return "-"
+	case o.Numerator == o.Denominator:
+		return "Evs"
+	}
+	return strconv.FormatInt(o.Numerator, 10) + "/" + strconv.FormatInt(o.Denominator, 10)
+}
+
+// String returns the price as quoted, the fractional odds followed by the
+// favourite marker: "5/2F"
+func (o Odds) String() string {
+	if o.IsZero() {
+		return o.Fractional()
+	}
+	return o.Fractional() + o.Favourite
+}
@@ -0,0 +1,131 @@
+package odds
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		price      string
+		want       Odds
+		fractional string
+		decimal    float64
+	}{
+		{"11/4", Odds{Numerator: 11, Denominator: 4}, "11/4", 3.75},
+		{" 100/30 ", Odds{Numerator: 100, Denominator: 30}, "100/30", 100.0/30 + 1},
+		{"5-2", Odds{Numerator: 5, Denominator: 2}, "5/2", 3.5},
+		{"1/2", Odds{Numerator: 1, Denominator: 2}, "1/2", 1.5},
+		{"3.75", Odds{Numerator: 11, Denominator: 4}, "11/4", 3.75},
+		{"2.0", Odds{Numerator: 1, Denominator: 1}, "Evs", 2},
+		{"1.01", Odds{Numerator: 1, Denominator: 100}, "1/100", 1.01},
+		{"Evs", Evens, "Evs", 2},
+		{"evens", Evens, "Evs", 2},
+		{"EvensF", Odds{Numerator: 1, Denominator: 1, Favourite: Favourite}, "Evs", 2},
+		{"EvsF", Odds{Numerator: 1, Denominator: 1, Favourite: Favourite}, "Evs", 2},
+		{"5/2F", Odds{Numerator: 5, Denominator: 2, Favourite: Favourite}, "5/2", 3.5},
+		{"5/2f", Odds{Numerator: 5, Denominator: 2, Favourite: Favourite}, "5/2", 3.5},
+		{"7/2JF", Odds{Numerator: 7, Denominator: 2, Favourite: JointFavourite}, "7/2", 4.5},
+		{"7/2jf", Odds{Numerator: 7, Denominator: 2, Favourite: JointFavourite}, "7/2", 4.5},
+		{"4/1CF", Odds{Numerator: 4, Denominator: 1, Favourite: CoFavourite}, "4/1", 5},
+		{"11/411/4", Odds{Numerator: 11, Denominator: 4}, "11/4", 3.75},
+		{"5/2F5/2F", Odds{Numerator: 5, Denominator: 2, Favourite: Favourite}, "5/2", 3.5},
+		{"EvsEvs", Evens, "Evs", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.price, func(t *testing.T) {
+			got, err := Parse(tt.price)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if got.Fractional() != tt.fractional {
+				t.Errorf("got %s, want %s", got.Fractional(), tt.fractional)
+			}
+			if diff := got.Decimal() - tt.decimal; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("got decimal %g, want %g", got.Decimal(), tt.decimal)
+			}
+		})
+	}
+}
+
+func TestParseRejected(t *testing.T) {
+	tests := []struct {
+		price string
+		err   error
+	}{
+		{"", ErrNonRunner},
+		{"-", ErrNonRunner},
+		{"NR", ErrNonRunner},
+		{"n/r", ErrNonRunner},
+		{"SP", ErrNoPrice},
+		{"sp", ErrNoPrice},
+		{"JF", ErrNoPrice},
+		{"F", ErrNoPrice},
+		// A whole number could be 2/1 as well as decimal 2.0
+		{"2", ErrInvalid},
+		{"11", ErrInvalid},
+		{"1.0", ErrInvalid},
+		{"0.5", ErrInvalid},
+		{"0/1", ErrInvalid},
+		{"5/0", ErrInvalid},
+		{"-5/1", ErrInvalid},
+		{"11/4/2", ErrInvalid},
+		{"five to two", ErrInvalid},
+		{"XF", ErrInvalid},
+		{"NaN", ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.price, func(t *testing.T) {
+			got, err := Parse(tt.price)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %+v, %v; want %v", got, err, tt.err)
+			}
+			if !got.IsZero() {
+				t.Errorf("got %+v with the error", got)
+			}
+		})
+	}
+}
+
+func TestOdds(t *testing.T) {
+	o := Odds{Numerator: 3, Denominator: 1, Favourite: JointFavourite}
+	if got := o.ImpliedProbability(); got != 0.25 {
+		t.Errorf("implied probability %g, want 0.25", got)
+	}
+	if got := o.Profit(10); got != 30 {
+		t.Errorf("profit %g, want 30", got)
+	}
+	if got := o.Return(10); got != 40 {
+		t.Errorf("return %g, want 40", got)
+	}
+	if got := o.String(); got != "3/1JF" {
+		t.Errorf("quoted as %s, want 3/1JF", got)
+	}
+
+	var none Odds
+	if none.Decimal() != 0 || none.ImpliedProbability() != 0 || none.String() != "-" {
+		t.Errorf("zero odds read as %g, %g, %s", none.Decimal(), none.ImpliedProbability(), none)
+	}
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		price string
+		want  string
+	}{
+		{" 11/4 ", "11/4"},
+		{"11/411/4", "11/4"},
+		{"EvsEvs", "Evs"},
+		{"11", "11"},
+		{"1111", "1111"},
+		{"5/2F", "5/2F"},
+	}
+	for _, tt := range tests {
+		if got := Clean(tt.price); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.price, got, tt.want)
+		}
+	}
+}
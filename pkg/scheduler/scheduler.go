@@ -0,0 +1,254 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/robfig/cron/v3"
+)
+
+// Stage is one step of the daily pipeline
+type Stage struct {
+	Name string
+	// Requires lists the stages that must have succeeded for the same date
+	Requires []string
+	Run      func(ctx context.Context, date string) error
+}
+
+// Scheduler runs the pipeline stages on the cron expressions of the schedule
+// settings, e.g. schedule_meetings = "0 7 * * *" in the Configurations table.
+type Scheduler struct {
+	DB     *database.DB
+	Stages []Stage
+	cron   *cron.Cron
+}
+
+// New returns a scheduler for the stages, which must be given in pipeline order.
+func New(db *database.DB, stages []Stage) *Scheduler {
+	return &Scheduler{DB: db, Stages: stages}
+}
+
+// Start schedules every stage that has an expression in schedule, keyed by
+// stage name. Stages without one can still be run with RunStage.
+func (s *Scheduler) Start(schedule map[string]string) error {
+	s.cron = cron.New()
+
+	for _, stage := range s.Stages {
+		expression := schedule[stage.Name]
+		if expression == "" {
+			continue
+		}
+
+		stage := stage
+		_, err := s.cron.AddFunc(expression, func() {
+			date := time.Now().Format("2006-01-02")
+			if err := s.RunStage(context.Background(), stage, date); err != nil {
+				log.Printf("scheduler: %s for %s: %v", stage.Name, date, err)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("invalid schedule_%s %q: %w", stage.Name, expression, err)
+		}
+		log.Printf("scheduler: %s scheduled at %q", stage.Name, expression)
+	}
+
+	s.cron.Start()
+	return nil
+}
+
+// Stop waits for running stages to finish and stops scheduling new ones.
+func (s *Scheduler) Stop() {
+	if s.cron != nil {
+		<-s.cron.Stop().Done()
+	}
+}
+
+// RunAll runs every stage for the date in order, stopping at the first failure.
+func (s *Scheduler) RunAll(ctx context.Context, date string) error {
+	for _, stage := range s.Stages {
+		if err := s.RunStage(ctx, stage, date); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunPending runs the stages that have not yet succeeded for the date, in order,
+// stopping at the first failure. Running it again after an interruption resumes
+// where the previous run stopped.
+func (s *Scheduler) RunPending(ctx context.Context, date string) error {
+	for _, stage := range s.Stages {
+		state, err := s.LatestState(date, stage.Name)
+		if err != nil {
+			return err
+		}
+		if state == models.StageSucceeded {
+			continue
+		}
+		if err := s.RunStage(ctx, stage, date); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunStage runs a stage for the date and records the run. The stage is
+// recorded as skipped when one of its prerequisites has not succeeded.
+func (s *Scheduler) RunStage(ctx context.Context, stage Stage, date string) error {
+	for _, required := range stage.Requires {
+		state, err := s.LatestState(date, required)
+		if err != nil {
+			return err
+		}
+		if state != models.StageSucceeded {
+			reason := fmt.Errorf("prerequisite %s has not succeeded for %s", required, date)
+			if err := s.record(date, stage.Name, models.StageSkipped, reason); err != nil {
+				return err
+			}
+			return reason
+		}
+	}
+
+	var id int
+	err := s.DB.QueryRow(`
+		INSERT INTO PipelineRuns (run_date, stage, state, error, started_at)
+		VALUES (?, ?, ?, '', ?)
+		RETURNING id`,
+		date, stage.Name, models.StageRunning, time.Now()).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	state := models.StageSucceeded
+	errorText := ""
+	runErr := stage.Run(ctx, date)
+	if runErr != nil {
+		state = models.StageFailed
+		errorText = runErr.Error()
+	}
+
+	_, err = s.DB.Exec(`UPDATE PipelineRuns SET state = ?, error = ?, finished_at = ? WHERE id = ?`,
+		state, errorText, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return runErr
+}
+
+// record stores a finished stage run
+func (s *Scheduler) record(date, stage, state string, reason error) error {
+	now := time.Now()
+	_, err := s.DB.Exec(`
+		INSERT INTO PipelineRuns (run_date, stage, state, error, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		date, stage, state, reason.Error(), now, now)
+	return err
+}
+
+// LatestState returns the state of the latest run of a stage for the date,
+// or an empty string when the stage never ran.
+func (s *Scheduler) LatestState(date, stage string) (string, error) {
+	var state string
+	err := s.DB.QueryRow(`
+		SELECT state FROM PipelineRuns
+		WHERE run_date = ? AND stage = ?
+		ORDER BY id DESC LIMIT 1`, date, stage).Scan(&state)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return state, err
+}
+
+// Days returns the latest run of every stage for each date between from and to.
+func (s *Scheduler) Days(from, to string) ([]models.PipelineDay, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, run_date, stage, state, error, started_at, finished_at
+		FROM PipelineRuns
+		WHERE run_date BETWEEN ? AND ?
+		ORDER BY id`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := make(map[string]*models.PipelineDay)
+	for rows.Next() {
+		var run models.PipelineRun
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&run.ID, &run.RunDate, &run.Stage, &run.State, &run.Error, &run.StartedAt, &finishedAt); err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+
+		day, ok := days[run.RunDate]
+		if !ok {
+			day = &models.PipelineDay{RunDate: run.RunDate, Stages: make(map[string]models.PipelineRun)}
+			days[run.RunDate] = day
+		}
+		// Rows are ordered by id so the latest run of a stage wins
+		day.Stages[run.Stage] = run
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	first, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return nil, err
+	}
+	last, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Days the pipeline never ran are listed too, they are the most incomplete of all
+	var result []models.PipelineDay
+	for date := first; !date.After(last); date = date.AddDate(0, 0, 1) {
+		day, ok := days[date.Format("2006-01-02")]
+		if !ok {
+			day = &models.PipelineDay{RunDate: date.Format("2006-01-02"), Stages: make(map[string]models.PipelineRun)}
+		}
+
+		day.Complete = true
+		for _, stage := range s.Stages {
+			if day.Stages[stage.Name].State != models.StageSucceeded {
+				day.Complete = false
+			}
+		}
+		result = append(result, *day)
+	}
+
+	return result, nil
+}
+
+// GetPipelineDays godoc
+// @Summary Get pipeline runs
+// @Description Get the latest run of every pipeline stage for each day between from and to
+// @Tags pipeline
+// @Produce  json
+// @Param from query string false "First date (YYYY-MM-DD), defaults to 7 days ago"
+// @Param to query string false "Last date (YYYY-MM-DD), defaults to today"
+// @Success 200 {object} object	"ok"
+// @Router /pipeline/days [get]
+func (s *Scheduler) GetPipelineDays(c *gin.Context) {
+	to := c.DefaultQuery("to", time.Now().Format("2006-01-02"))
+	from := c.DefaultQuery("from", time.Now().AddDate(0, 0, -7).Format("2006-01-02"))
+
+	days, err := s.Days(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"days": days})
+}
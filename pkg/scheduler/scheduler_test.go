@@ -0,0 +1,238 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+const testDate = "2024-10-05"
+
+// pipeline records the stages it runs, a stage in failing fails with its error
+type pipeline struct {
+	ran     []string
+	failing map[string]error
+}
+
+// stages returns the meetings, forms, analysis and results stages, each
+// requiring the one before
+func (p *pipeline) stages() []Stage {
+	names := []string{"meetings", "forms", "analysis", "results"}
+	stages := make([]Stage, len(names))
+	for i, name := range names {
+		name := name
+		stages[i] = Stage{Name: name, Run: func(ctx context.Context, date string) error {
+			p.ran = append(p.ran, name)
+			return p.failing[name]
+		}}
+		if i > 0 {
+			stages[i].Requires = []string{names[i-1]}
+		}
+	}
+	return stages
+}
+
+// newTestScheduler returns a scheduler of the stages of p over a migrated
+// in-memory SQLite database
+func newTestScheduler(t *testing.T, p *pipeline) *Scheduler {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := database.OpenDSN(database.SQLite, fmt.Sprintf("file:%s?mode=memory&cache=shared", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return New(db, p.stages())
+}
+
+// states returns the latest state of every stage for the date
+func states(t *testing.T, s *Scheduler, date string) []string {
+	t.Helper()
+
+	var states []string
+	for _, stage := range s.Stages {
+		state, err := s.LatestState(date, stage.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+func TestRunAll(t *testing.T) {
+	failed := errors.New("the form pages did not load")
+
+	tests := []struct {
+		name    string
+		failing map[string]error
+		ran     []string
+		states  []string
+	}{
+		{
+			name:   "every stage",
+			ran:    []string{"meetings", "forms", "analysis", "results"},
+			states: []string{models.StageSucceeded, models.StageSucceeded, models.StageSucceeded, models.StageSucceeded},
+		},
+		{
+			name:    "stops at the first failure",
+			failing: map[string]error{"forms": failed},
+			ran:     []string{"meetings", "forms"},
+			states:  []string{models.StageSucceeded, models.StageFailed, "", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pipeline{failing: tt.failing}
+			s := newTestScheduler(t, p)
+
+			err := s.RunAll(context.Background(), testDate)
+			if want := tt.failing["forms"]; !errors.Is(err, want) {
+				t.Errorf("got %v, want %v", err, want)
+			}
+			if strings.Join(p.ran, ",") != strings.Join(tt.ran, ",") {
+				t.Errorf("ran %v, want %v", p.ran, tt.ran)
+			}
+			if got := states(t, s, testDate); strings.Join(got, ",") != strings.Join(tt.states, ",") {
+				t.Errorf("got states %q, want %q", got, tt.states)
+			}
+		})
+	}
+}
+
+// TestRunPending resumes a day where its last run stopped
+func TestRunPending(t *testing.T) {
+	p := &pipeline{failing: map[string]error{"analysis": errors.New("no scoring profile")}}
+	s := newTestScheduler(t, p)
+
+	if err := s.RunPending(context.Background(), testDate); err == nil {
+		t.Fatal("got no error from the failed analysis")
+	}
+
+	p.ran, p.failing = nil, nil
+	if err := s.RunPending(context.Background(), testDate); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"analysis", "results"}; strings.Join(p.ran, ",") != strings.Join(want, ",") {
+		t.Errorf("ran %v, want %v", p.ran, want)
+	}
+
+	p.ran = nil
+	if err := s.RunPending(context.Background(), testDate); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.ran) != 0 {
+		t.Errorf("ran %v for a complete day", p.ran)
+	}
+}
+
+// TestRunStageSkipped records a stage whose prerequisite has not succeeded
+// as skipped without running it
+func TestRunStageSkipped(t *testing.T) {
+	p := &pipeline{}
+	s := newTestScheduler(t, p)
+	forms := s.Stages[1]
+
+	err := s.RunStage(context.Background(), forms, testDate)
+	if err == nil || !strings.Contains(err.Error(), "prerequisite meetings") {
+		t.Errorf("got %v, want the missing prerequisite", err)
+	}
+	if len(p.ran) != 0 {
+		t.Errorf("ran %v", p.ran)
+	}
+	if state, _ := s.LatestState(testDate, forms.Name); state != models.StageSkipped {
+		t.Errorf("forms %q, want %s", state, models.StageSkipped)
+	}
+
+	// The prerequisite succeeded the day before only
+	if err := s.RunStage(context.Background(), s.Stages[0], "2024-10-04"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RunStage(context.Background(), forms, testDate); err == nil {
+		t.Error("ran forms on the meetings of another day")
+	}
+}
+
+func TestDays(t *testing.T) {
+	p := &pipeline{failing: map[string]error{"results": errors.New("results not in yet")}}
+	s := newTestScheduler(t, p)
+
+	if err := s.RunAll(context.Background(), "2024-10-04"); err == nil {
+		t.Fatal("got no error from the failed results")
+	}
+	p.failing = nil
+	if err := s.RunPending(context.Background(), "2024-10-04"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RunAll(context.Background(), testDate); err != nil {
+		t.Fatal(err)
+	}
+	p.failing = map[string]error{"analysis": errors.New("no scoring profile")}
+	if err := s.RunAll(context.Background(), "2024-10-06"); err == nil {
+		t.Fatal("got no error from the failed analysis")
+	}
+
+	days, err := s.Days("2024-10-04", "2024-10-07")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		date     string
+		complete bool
+		stages   int
+		results  string
+	}{
+		// The latest run of results succeeded
+		{"2024-10-04", true, 4, models.StageSucceeded},
+		{testDate, true, 4, models.StageSucceeded},
+		{"2024-10-06", false, 3, ""},
+		// Never ran
+		{"2024-10-07", false, 0, ""},
+	}
+	if len(days) != len(tests) {
+		t.Fatalf("got %d days, want %d", len(days), len(tests))
+	}
+	for i, tt := range tests {
+		day := days[i]
+		if day.RunDate != tt.date || day.Complete != tt.complete || len(day.Stages) != tt.stages {
+			t.Errorf("%s: got %s complete %t with %d stages, want complete %t with %d",
+				tt.date, day.RunDate, day.Complete, len(day.Stages), tt.complete, tt.stages)
+		}
+		if got := day.Stages["results"].State; got != tt.results {
+			t.Errorf("%s: results %q, want %q", tt.date, got, tt.results)
+		}
+	}
+
+	if _, err := s.Days("2024-10-04", "next week"); err == nil {
+		t.Error("got no error for a date that does not parse")
+	}
+}
+
+func TestStart(t *testing.T) {
+	s := newTestScheduler(t, &pipeline{})
+
+	err := s.Start(map[string]string{"meetings": "0 7 * * *", "forms": "at seven"})
+	if err == nil || !strings.Contains(err.Error(), "schedule_forms") {
+		t.Errorf("got %v, want the invalid schedule_forms", err)
+	}
+
+	s = newTestScheduler(t, &pipeline{})
+	if err := s.Start(map[string]string{"meetings": "0 7 * * *", "results": "30 21 * * *"}); err != nil {
+		t.Fatal(err)
+	}
+	if entries := s.cron.Entries(); len(entries) != 2 {
+		t.Errorf("scheduled %d stages, want meetings and results", len(entries))
+	}
+	s.Stop()
+}
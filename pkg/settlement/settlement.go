@@ -0,0 +1,185 @@
+// Package settlement works out what a bet pays once its race is run: the
+// gross return, stake included, and the net profit of the stake at the price
+// the bet was struck at.
+package settlement
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/odds"
+)
+
+// ErrUnsettled is returned for a bet whose runner has no result yet
+var ErrUnsettled = errors.New("the race has no result yet")
+
+// nonRunnerPositions are the position lines of runners withdrawn from their
+// race, bets on them are void
+var nonRunnerPositions = map[string]bool{"NR": true, "N/R": true, "W": true, "WD": true}
+
+// Placing is the finish of a runner read from a position line such as "1/8".
+// Position is 0 for runners that did not finish ("PU/10", "F/12"), DeadHeat
+// is the number of runners sharing Position, 1 without a dead heat.
+type Placing struct {
+	Position  int
+	Runners   int
+	DeadHeat  int
+	NonRunner bool
+}
+
+// ParsePlacing reads a position line: "1/8", a dead heat marked "DH1/8",
+// "1dh/8" or "=1/8", which is taken to be between two runners, or a
+// non-runner. ErrUnsettled is returned for an empty line.
+func ParsePlacing(position string) (Placing, error) {
+	position = strings.TrimSpace(position)
+	if position == "" {
+		return Placing{}, ErrUnsettled
+	}
+	if nonRunnerPositions[strings.ToUpper(position)] {
+		return Placing{NonRunner: true, DeadHeat: 1}, nil
+	}
+
+	finish, runners, _ := strings.Cut(position, "/")
+	placing := Placing{DeadHeat: 1}
+	placing.Runners, _ = strconv.Atoi(strings.TrimSpace(runners))
+
+	finish = strings.ToUpper(strings.TrimSpace(finish))
+	if marked := strings.NewReplacer("DH", "", "=", "", " ", "").Replace(finish); marked != finish {
+		finish = marked
+		placing.DeadHeat = 2
+	}
+	if finished, err := strconv.Atoi(finish); err == nil && finished > 0 {
+		placing.Position = finished
+	}
+	return placing, nil
+}
+
+// share returns the part of a stake paid out on a placing when the first
+// places pay, reduced by a dead heat for the last of them: half the stake
+// when two runners dead heat for the last place
+func (p Placing) share(places int) float64 {
+	if p.Position == 0 || p.Position > places {
+		return 0
+	}
+	return float64(min(p.DeadHeat, places-p.Position+1)) / float64(p.DeadHeat)
+}
+
+// IsHandicap reports whether a race type or category names a handicap
+func IsHandicap(descriptions ...string) bool {
+	for _, description := range descriptions {
+		description = strings.ToLower(description)
+		if strings.Contains(description, "handicap") || strings.Contains(description, "hcap") || strings.Contains(description, "nursery") {
+			return true
+		}
+	}
+	return false
+}
+
+// StandardPlaceTerms returns the each-way terms of Tattersalls' rules for a
+// field of runners: 1/4 the odds for the first 2 of 5 to 7 runners, 1/5 for
+// the first 3 of 8 or more, and in handicaps 1/4 for the first 3 of 12 to 15
+// runners and the first 4 of 16 or more. Fields of 4 or fewer are win only,
+// the place part of a bet is then settled as a win.
+func StandardPlaceTerms(runners int, handicap bool) models.PlaceTerms {
+	switch {
+	case runners <= 4:
+		return models.PlaceTerms{Places: 1, Fraction: 1}
+	case runners <= 7:
+		return models.PlaceTerms{Places: 2, Fraction: 4}
+	case !handicap || runners <= 11:
+		return models.PlaceTerms{Places: 3, Fraction: 5}
+	case runners <= 15:
+		return models.PlaceTerms{Places: 3, Fraction: 4}
+	}
+	return models.PlaceTerms{Places: 4, Fraction: 4}
+}
+
+// Win settles a win bet of stake at price on a runner's position line. A
+// non-runner, by its price or its position, voids the bet and returns the
+// stake, a dead heat for first pays the share of the stake. ErrUnsettled is
+// returned while position is empty.
+func Win(stake float64, price, position string) (models.Settlement, error) {
+	settlement := models.Settlement{BetType: models.BetTypeWin, Stake: roundMoney(stake), Price: price}
+
+	o, placing, err := parse(price, position)
+	if err != nil {
+		return settlement, err
+	}
+	if placing.NonRunner {
+		return void(settlement), nil
+	}
+
+	settlement.GrossReturn = roundMoney(o.Return(stake * placing.share(1)))
+	return outcome(settlement, placing, 1), nil
+}
+
+// EachWay settles an each-way bet of stake on the win and stake on the place
+// at price on a runner's position line: the place part pays terms.Fraction of
+// the odds when the runner finishes within terms.Places. Non-runners and dead
+// heats are settled as for Win, on each part.
+func EachWay(stake float64, price, position string, terms models.PlaceTerms) (models.Settlement, error) {
+	settlement := models.Settlement{BetType: models.BetTypeEachWay, Stake: roundMoney(2 * stake), Price: price, PlaceTerms: &terms}
+
+	o, placing, err := parse(price, position)
+	if err != nil {
+		return settlement, err
+	}
+	if placing.NonRunner {
+		return void(settlement), nil
+	}
+	if terms.Places < 1 || terms.Fraction < 1 {
+		return settlement, errors.New("place terms need at least 1 place at a fraction of at least 1")
+	}
+
+	win := o.Return(stake * placing.share(1))
+	place := stake * placing.share(terms.Places) * (1 + o.ToOne()/float64(terms.Fraction))
+	settlement.GrossReturn = roundMoney(win + place)
+	return outcome(settlement, placing, terms.Places), nil
+}
+
+// parse reads the price and position line of a bet, the price of a
+// non-runner is not needed
+func parse(price, position string) (odds.Odds, Placing, error) {
+	placing, err := ParsePlacing(position)
+	if err != nil {
+		return odds.Odds{}, placing, err
+	}
+	o, err := odds.Parse(price)
+	switch {
+	case errors.Is(err, odds.ErrNonRunner):
+		placing.NonRunner = true
+	case err != nil:
+		return o, placing, err
+	}
+	return o, placing, nil
+}
+
+// void returns the whole stake of settlement
+func void(settlement models.Settlement) models.Settlement {
+	settlement.Outcome = models.OutcomeVoid
+	settlement.GrossReturn = settlement.Stake
+	return settlement
+}
+
+// outcome sets the net profit of a settlement and its outcome from the
+// placing of the runner among the places paid
+func outcome(settlement models.Settlement, placing Placing, places int) models.Settlement {
+	settlement.NetProfit = roundMoney(settlement.GrossReturn - settlement.Stake)
+	switch {
+	case placing.share(1) > 0:
+		settlement.Outcome = models.OutcomeWon
+	case placing.share(places) > 0:
+		settlement.Outcome = models.OutcomePlaced
+	default:
+		settlement.Outcome = models.OutcomeLost
+	}
+	return settlement
+}
+
+// roundMoney rounds an amount to pennies
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
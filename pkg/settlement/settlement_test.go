@@ -0,0 +1,184 @@
+package settlement
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/odds"
+)
+
+func TestWin(t *testing.T) {
+	tests := []struct {
+		name     string
+		price    string
+		position string
+		gross    float64
+		net      float64
+		outcome  string
+	}{
+		{"winner", "11/4", "1/8", 37.5, 27.5, models.OutcomeWon},
+		{"evens favourite", "EvsF", "1/5", 20, 10, models.OutcomeWon},
+		{"loser", "11/4", "2/8", 0, -10, models.OutcomeLost},
+		{"pulled up", "12/1", "PU/10", 0, -10, models.OutcomeLost},
+		// Half the stake at 4/1, the other half lost
+		{"dead heat for first", "4/1", "DH1/8", 25, 15, models.OutcomeWon},
+		{"dead heat marked after", "4/1", "1dh/8", 25, 15, models.OutcomeWon},
+		{"dead heat for second", "4/1", "=2/8", 0, -10, models.OutcomeLost},
+		{"non-runner", "5/1", "NR", 10, 0, models.OutcomeVoid},
+		{"non-runner price", "NR", "0/8", 10, 0, models.OutcomeVoid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settled, err := Win(10, tt.price, tt.position)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if settled.GrossReturn != tt.gross || settled.NetProfit != tt.net || settled.Outcome != tt.outcome {
+				t.Errorf("got %g back, %g profit, %s; want %g, %g, %s",
+					settled.GrossReturn, settled.NetProfit, settled.Outcome, tt.gross, tt.net, tt.outcome)
+			}
+			if settled.Stake != 10 || settled.BetType != models.BetTypeWin {
+				t.Errorf("settled a %s bet of %g", settled.BetType, settled.Stake)
+			}
+		})
+	}
+}
+
+func TestEachWay(t *testing.T) {
+	fifth := models.PlaceTerms{Places: 3, Fraction: 5}
+	tests := []struct {
+		name     string
+		price    string
+		position string
+		terms    models.PlaceTerms
+		gross    float64
+		outcome  string
+	}{
+		// 10 at 10/1 to win and 10 at 2/1 to place
+		{"winner", "10/1", "1/10", fifth, 140, models.OutcomeWon},
+		{"placed", "10/1", "3/10", fifth, 30, models.OutcomePlaced},
+		{"unplaced", "10/1", "4/10", fifth, 0, models.OutcomeLost},
+		{"quarter the odds", "10/1", "2/14", models.PlaceTerms{Places: 3, Fraction: 4}, 35, models.OutcomePlaced},
+		{"fourth of a big handicap", "10/1", "4/18", models.PlaceTerms{Places: 4, Fraction: 4}, 35, models.OutcomePlaced},
+		// Two runners share the last place paid, half the place stake pays
+		{"dead heat for third", "10/1", "DH3/10", fifth, 15, models.OutcomePlaced},
+		// Half of each part on the win, the whole place part
+		{"dead heat for first", "10/1", "DH1/10", fifth, 85, models.OutcomeWon},
+		{"win only field", "2/1", "2/4", models.PlaceTerms{Places: 1, Fraction: 1}, 0, models.OutcomeLost},
+		{"win only field winner", "2/1", "1/4", models.PlaceTerms{Places: 1, Fraction: 1}, 60, models.OutcomeWon},
+		{"non-runner", "10/1", "NR", fifth, 20, models.OutcomeVoid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settled, err := EachWay(10, tt.price, tt.position, tt.terms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if settled.GrossReturn != tt.gross || settled.Outcome != tt.outcome {
+				t.Errorf("got %g back, %s; want %g, %s", settled.GrossReturn, settled.Outcome, tt.gross, tt.outcome)
+			}
+			if settled.NetProfit != tt.gross-20 && tt.outcome != models.OutcomeVoid {
+				t.Errorf("got %g profit on a stake of 20 returning %g", settled.NetProfit, tt.gross)
+			}
+			if settled.Stake != 20 || settled.PlaceTerms == nil || *settled.PlaceTerms != tt.terms {
+				t.Errorf("settled %g on place terms %+v", settled.Stake, settled.PlaceTerms)
+			}
+		})
+	}
+}
+
+func TestUnsettled(t *testing.T) {
+	tests := []struct {
+		name     string
+		price    string
+		position string
+		err      error
+	}{
+		{"no result", "5/1", "", ErrUnsettled},
+		{"blank result", "5/1", "  ", ErrUnsettled},
+		{"price does not read", "five", "1/8", odds.ErrInvalid},
+		{"negative price", "-5/1", "1/8", odds.ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Win(10, tt.price, tt.position); !errors.Is(err, tt.err) {
+				t.Errorf("win: got %v, want %v", err, tt.err)
+			}
+			if _, err := EachWay(10, tt.price, tt.position, models.PlaceTerms{Places: 3, Fraction: 5}); !errors.Is(err, tt.err) {
+				t.Errorf("each way: got %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	if _, err := EachWay(10, "5/1", "1/8", models.PlaceTerms{}); err == nil {
+		t.Error("settled an each-way bet without place terms")
+	}
+}
+
+func TestStandardPlaceTerms(t *testing.T) {
+	tests := []struct {
+		runners  int
+		handicap bool
+		want     models.PlaceTerms
+	}{
+		{3, false, models.PlaceTerms{Places: 1, Fraction: 1}},
+		{4, true, models.PlaceTerms{Places: 1, Fraction: 1}},
+		{5, false, models.PlaceTerms{Places: 2, Fraction: 4}},
+		{7, true, models.PlaceTerms{Places: 2, Fraction: 4}},
+		{8, false, models.PlaceTerms{Places: 3, Fraction: 5}},
+		{11, true, models.PlaceTerms{Places: 3, Fraction: 5}},
+		{12, false, models.PlaceTerms{Places: 3, Fraction: 5}},
+		{12, true, models.PlaceTerms{Places: 3, Fraction: 4}},
+		{15, true, models.PlaceTerms{Places: 3, Fraction: 4}},
+		{16, true, models.PlaceTerms{Places: 4, Fraction: 4}},
+		{20, false, models.PlaceTerms{Places: 3, Fraction: 5}},
+	}
+	for _, tt := range tests {
+		if got := StandardPlaceTerms(tt.runners, tt.handicap); got != tt.want {
+			t.Errorf("%d runners, handicap %t: got %+v, want %+v", tt.runners, tt.handicap, got, tt.want)
+		}
+	}
+}
+
+func TestParsePlacing(t *testing.T) {
+	tests := []struct {
+		position string
+		want     Placing
+	}{
+		{"1/8", Placing{Position: 1, Runners: 8, DeadHeat: 1}},
+		{"PU/10", Placing{Runners: 10, DeadHeat: 1}},
+		{"DH3/12", Placing{Position: 3, Runners: 12, DeadHeat: 2}},
+		{"=1/8", Placing{Position: 1, Runners: 8, DeadHeat: 2}},
+		{"nr", Placing{NonRunner: true, DeadHeat: 1}},
+		{"4", Placing{Position: 4, DeadHeat: 1}},
+	}
+	for _, tt := range tests {
+		got, err := ParsePlacing(tt.position)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.position, got, tt.want)
+		}
+	}
+}
+
+func TestIsHandicap(t *testing.T) {
+	tests := []struct {
+		descriptions []string
+		want         bool
+	}{
+		{[]string{"Flat", "Class 4 Handicap"}, true},
+		{[]string{"Handicap Hurdle"}, true},
+		{[]string{"Hcap Chase"}, true},
+		{[]string{"Flat", "Nursery"}, true},
+		{[]string{"Flat", "Group 3"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsHandicap(tt.descriptions...); got != tt.want {
+			t.Errorf("%q: got %t, want %t", tt.descriptions, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package source
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fixtureBaseURL is the host the fixture source pretends to scrape
+const fixtureBaseURL = "http://fixtures.local"
+
+// NewFixtureSource returns a source reading saved pages from dir instead of the
+// racing site. A page is looked up by its URL path with an .html extension, so
+// /racing/profiles/horse/123 is served from dir/racing/profiles/horse/123.html.
+func NewFixtureSource(dir string) *WebSource {
+	return &WebSource{
+		BaseURL:   fixtureBaseURL,
+		Transport: fixtureTransport{dir: dir},
+	}
+}
+
+// fixtureTransport answers requests from files on disk, missing pages are a 404
+type fixtureTransport struct {
+	dir string
+}
+
+func (t fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := filepath.Join(t.dir, filepath.FromSlash(strings.TrimSuffix(req.URL.Path, "/"))+".html")
+
+	status := http.StatusOK
+	body, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		status = http.StatusNotFound
+		body = []byte("fixture not found: " + req.URL.Path)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,131 @@
+package source
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocolly/colly"
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// Kinds of pages recorded in ScrapeRuns
+const (
+	KindRunners    = "runners"
+	KindConditions = "conditions"
+	KindForm       = "form"
+	KindResult     = "result"
+)
+
+// Monitor records scrape runs and remembers what each page yielded before.
+type Monitor interface {
+	RecordRun(run models.ScrapeRun) error
+	// PreviousRows returns the most rows an earlier run of the URL extracted.
+	PreviousRows(sourceURL string) (int, error)
+}
+
+// ZeroRowsError is returned when a page that used to yield rows yields none,
+// which almost always means the site changed and a selector no longer matches.
+type ZeroRowsError struct {
+	Kind         string
+	SourceURL    string
+	PreviousRows int
+}
+
+func (e *ZeroRowsError) Error() string {
+	return fmt.Sprintf("%s page %s extracted 0 rows but previously extracted %d, the selectors may be out of date",
+		e.Kind, e.SourceURL, e.PreviousRows)
+}
+
+// visit fetches url with c, records the run with the monitor and reports a
+// ZeroRowsError when rows() is zero for a page that used to yield rows.
+func (s *WebSource) visit(c *colly.Collector, kind, url string, rows func() int) error {
+	statusCode := 0
+	c.OnResponse(func(r *colly.Response) {
+		statusCode = r.StatusCode
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		statusCode = r.StatusCode
+	})
+
+	start := time.Now()
+	visitErr := c.Visit(url)
+
+	run := models.ScrapeRun{
+		Kind:       kind,
+		SourceURL:  url,
+		StatusCode: statusCode,
+		Rows:       rows(),
+		DurationMs: time.Since(start).Milliseconds(),
+		CreatedAt:  time.Now(),
+	}
+	if visitErr != nil {
+		run.Error = visitErr.Error()
+	}
+
+	if s.Monitor == nil {
+		return visitErr
+	}
+
+	previousRows := 0
+	if visitErr == nil && run.Rows == 0 {
+		var err error
+		previousRows, err = s.Monitor.PreviousRows(url)
+		if err != nil {
+			return err
+		}
+		if previousRows > 0 {
+			run.Error = (&ZeroRowsError{Kind: kind, SourceURL: url, PreviousRows: previousRows}).Error()
+		}
+	}
+
+	if err := s.Monitor.RecordRun(run); err != nil {
+		return err
+	}
+
+	if visitErr != nil {
+		return visitErr
+	}
+	if previousRows > 0 {
+		return &ZeroRowsError{Kind: kind, SourceURL: url, PreviousRows: previousRows}
+	}
+	return nil
+}
+
+// ScrapeMonitor stores scrape runs in the ScrapeRuns table
+type ScrapeMonitor struct {
+	DB *database.DB
+}
+
+// NewScrapeMonitor returns a monitor writing to db.
+func NewScrapeMonitor(db *database.DB) *ScrapeMonitor {
+	return &ScrapeMonitor{DB: db}
+}
+
+func (m *ScrapeMonitor) RecordRun(run models.ScrapeRun) error {
+	_, err := m.DB.Exec(`
+		INSERT INTO ScrapeRuns (
+			kind,
+			source_url,
+			status_code,
+			rows_extracted,
+			duration_ms,
+			error,
+			created_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		run.Kind, run.SourceURL, run.StatusCode, run.Rows, run.DurationMs, run.Error, run.CreatedAt)
+	return err
+}
+
+func (m *ScrapeMonitor) PreviousRows(sourceURL string) (int, error) {
+	var rows int
+	err := m.DB.QueryRow(`
+		SELECT COALESCE(MAX(rows_extracted), 0)
+		FROM ScrapeRuns
+		WHERE source_url = ?`, sourceURL).Scan(&rows)
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
@@ -0,0 +1,190 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gocolly/colly"
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// memoryMonitor is a Monitor keeping its runs in memory, previous holds the
+// rows an earlier run of each URL extracted
+type memoryMonitor struct {
+	runs     []models.ScrapeRun
+	previous map[string]int
+	err      error
+}
+
+func (m *memoryMonitor) RecordRun(run models.ScrapeRun) error {
+	m.runs = append(m.runs, run)
+	return nil
+}
+
+func (m *memoryMonitor) PreviousRows(sourceURL string) (int, error) {
+	return m.previous[sourceURL], m.err
+}
+
+// newHealthServer serves a page listing three rows, an empty page and a
+// missing one
+func newHealthServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rows", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body><ul><li>1</li><li>2</li><li>3</li></ul></body></html>")
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body><p>Moved</p></body></html>")
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVisit(t *testing.T) {
+	server := newHealthServer(t)
+	monitorErr := errors.New("database is locked")
+
+	tests := []struct {
+		name      string
+		path      string
+		previous  int
+		monitor   error
+		rows      int
+		status    int
+		zeroRows  bool
+		visitErr  bool
+		recorded  bool
+		runFailed bool
+	}{
+		{name: "rows", path: "/rows", previous: 3, rows: 3, status: http.StatusOK, recorded: true},
+		{name: "never had rows", path: "/empty", status: http.StatusOK, recorded: true},
+		{name: "lost its rows", path: "/empty", previous: 8, status: http.StatusOK, zeroRows: true, recorded: true, runFailed: true},
+		{name: "not found", path: "/missing", previous: 8, status: http.StatusNotFound, visitErr: true, recorded: true, runFailed: true},
+		{name: "monitor failed", path: "/empty", monitor: monitorErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := server.URL + tt.path
+			monitor := &memoryMonitor{previous: map[string]int{url: tt.previous}, err: tt.monitor}
+			src := &WebSource{BaseURL: server.URL, Monitor: monitor}
+
+			c := src.newCollector()
+			rows := 0
+			c.OnHTML("li", func(e *colly.HTMLElement) { rows++ })
+			err := src.visit(c, KindForm, url, func() int { return rows })
+
+			var zeroRows *ZeroRowsError
+			switch {
+			case tt.monitor != nil:
+				if !errors.Is(err, tt.monitor) {
+					t.Errorf("got %v, want the monitor's %v", err, tt.monitor)
+				}
+			case tt.zeroRows:
+				if !errors.As(err, &zeroRows) {
+					t.Fatalf("got %v, want a ZeroRowsError", err)
+				}
+				if *zeroRows != (ZeroRowsError{Kind: KindForm, SourceURL: url, PreviousRows: tt.previous}) {
+					t.Errorf("got %+v", *zeroRows)
+				}
+			case tt.visitErr:
+				if err == nil || errors.As(err, &zeroRows) {
+					t.Errorf("got %v, want the error of the visit", err)
+				}
+			case err != nil:
+				t.Errorf("got %v", err)
+			}
+
+			if !tt.recorded {
+				if len(monitor.runs) != 0 {
+					t.Errorf("recorded %+v", monitor.runs)
+				}
+				return
+			}
+			if len(monitor.runs) != 1 {
+				t.Fatalf("recorded %d runs, want 1", len(monitor.runs))
+			}
+			run := monitor.runs[0]
+			if run.Kind != KindForm || run.SourceURL != url || run.Rows != tt.rows || run.StatusCode != tt.status {
+				t.Errorf("recorded %+v", run)
+			}
+			if (run.Error != "") != tt.runFailed {
+				t.Errorf("recorded error %q", run.Error)
+			}
+		})
+	}
+}
+
+// TestVisitWithoutMonitor only reports the errors of the visit
+func TestVisitWithoutMonitor(t *testing.T) {
+	server := newHealthServer(t)
+	src := NewWebSource(server.URL)
+
+	if err := src.visit(src.newCollector(), KindForm, server.URL+"/empty", func() int { return 0 }); err != nil {
+		t.Errorf("got %v for an empty page without a monitor", err)
+	}
+	if err := src.visit(src.newCollector(), KindForm, server.URL+"/missing", func() int { return 0 }); err == nil {
+		t.Error("got no error for a missing page")
+	}
+}
+
+// TestSelectionFormZeroRows flags a form page that lost its form lines
+func TestSelectionFormZeroRows(t *testing.T) {
+	server := newHealthServer(t)
+	monitor := &memoryMonitor{previous: map[string]int{server.URL + "/empty": 12}}
+	src := &WebSource{BaseURL: server.URL, Monitor: monitor}
+
+	form, err := src.SelectionForm("/empty")
+	var zeroRows *ZeroRowsError
+	if !errors.As(err, &zeroRows) || zeroRows.Kind != KindForm || zeroRows.PreviousRows != 12 {
+		t.Fatalf("got %v, want a ZeroRowsError of the form page", err)
+	}
+	if len(form) != 0 {
+		t.Errorf("got %d form lines", len(form))
+	}
+	if !strings.Contains(err.Error(), "previously extracted 12") {
+		t.Errorf("got message %q", err)
+	}
+}
+
+func TestScrapeMonitor(t *testing.T) {
+	db, err := database.OpenDSN(database.SQLite, "file:scrape_monitor?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	monitor := NewScrapeMonitor(db)
+
+	for _, rows := range []int{5, 9, 0} {
+		run := models.ScrapeRun{Kind: KindForm, SourceURL: "/horse/1", StatusCode: http.StatusOK, Rows: rows}
+		if err := monitor.RecordRun(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{"/horse/1", 9},
+		{"/horse/2", 0},
+	}
+	for _, tt := range tests {
+		got, err := monitor.PreviousRows(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %d previous rows, want %d", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package source
+
+import (
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// RacingSource is a provider of racecards, form and results.
+// Handlers read racing data through this interface so that the scraped site
+// can be swapped for another provider or an offline copy.
+type RacingSource interface {
+	// Runners returns every declared runner for the given date (YYYY-MM-DD).
+	Runners(date string) ([]models.MeetingSelections, error)
+	// RaceConditions returns the distance, field size and other conditions of a race.
+	RaceConditions(eventLink string) (models.RaceConditon, error)
+	// SelectionForm returns the form lines of a horse, most recent first.
+	SelectionForm(selectionLink string) ([]models.SelectionForm, error)
+	// Result returns the form line of a horse on the given date (YYYY-MM-DD):
+	// its position, SP and the type of the race.
+	Result(selectionLink string, eventDate string) (models.SelectionForm, error)
+}
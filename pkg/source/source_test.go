@@ -0,0 +1,147 @@
+package source
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files from the current output:
+//
+//	go test ./pkg/source -update
+var update = flag.Bool("update", false, "rewrite the golden files from the current output")
+
+// fixtureDir holds the saved pages, cases.json and the golden files
+const fixtureDir = "fixtures"
+
+// goldenCase is one scrape checked against a saved golden result.
+// Method is one of Runners, RaceConditions, SelectionForm or Result.
+type goldenCase struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+	Arg    string `json:"arg"`
+	Date   string `json:"date"`
+}
+
+// goldenMismatch describes a case whose output differs from its golden file
+type goldenMismatch struct {
+	Line     int
+	Expected string
+	Actual   string
+}
+
+func (m goldenMismatch) String() string {
+	return fmt.Sprintf("line %d\n  expected: %s\n  actual:   %s", m.Line, m.Expected, m.Actual)
+}
+
+// TestGolden scrapes the saved pages of the fixture directory and compares
+// the extracted rows with the golden files, so a renamed selector fails here
+// instead of silently ingesting zero rows
+func TestGolden(t *testing.T) {
+	cases, err := loadGoldenCases(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatalf("%s/cases.json lists no cases", fixtureDir)
+	}
+
+	src := NewFixtureSource(fixtureDir)
+	for _, gc := range cases {
+		t.Run(gc.Name, func(t *testing.T) {
+			mismatch, ok, err := checkGolden(src, fixtureDir, gc, *update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Errorf("differs from golden/%s.json at %s", gc.Name, mismatch)
+			}
+		})
+	}
+}
+
+// loadGoldenCases reads the cases.json file of a fixture directory
+func loadGoldenCases(dir string) ([]goldenCase, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "cases.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []goldenCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+// checkGolden runs a case against src and compares the JSON output with
+// dir/golden/<name>.json. With update set the golden file is rewritten instead.
+func checkGolden(src RacingSource, dir string, gc goldenCase, update bool) (goldenMismatch, bool, error) {
+	result, err := runGoldenCase(src, gc)
+	if err != nil {
+		return goldenMismatch{}, false, err
+	}
+
+	actual, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return goldenMismatch{}, false, err
+	}
+	actual = append(actual, '\n')
+
+	goldenFile := filepath.Join(dir, "golden", gc.Name+".json")
+	if update {
+		if err := os.MkdirAll(filepath.Dir(goldenFile), 0o755); err != nil {
+			return goldenMismatch{}, false, err
+		}
+		return goldenMismatch{}, true, os.WriteFile(goldenFile, actual, 0o644)
+	}
+
+	expected, err := os.ReadFile(goldenFile)
+	if err != nil {
+		return goldenMismatch{}, false, err
+	}
+	mismatch, ok := compareGolden(expected, actual)
+	return mismatch, ok, nil
+}
+
+func runGoldenCase(src RacingSource, gc goldenCase) (interface{}, error) {
+	switch gc.Method {
+	case "Runners":
+		return src.Runners(gc.Arg)
+	case "RaceConditions":
+		return src.RaceConditions(gc.Arg)
+	case "SelectionForm":
+		return src.SelectionForm(gc.Arg)
+	case "Result":
+		return src.Result(gc.Arg, gc.Date)
+	}
+	return nil, fmt.Errorf("unknown method %q", gc.Method)
+}
+
+// compareGolden reports the first line where expected and actual differ
+func compareGolden(expected, actual []byte) (goldenMismatch, bool) {
+	if bytes.Equal(expected, actual) {
+		return goldenMismatch{}, true
+	}
+
+	expectedLines := strings.Split(string(expected), "\n")
+	actualLines := strings.Split(string(actual), "\n")
+	for i := 0; i < len(expectedLines) || i < len(actualLines); i++ {
+		var e, a string
+		if i < len(expectedLines) {
+			e = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			a = actualLines[i]
+		}
+		if e != a {
+			return goldenMismatch{Line: i + 1, Expected: strings.TrimSpace(e), Actual: strings.TrimSpace(a)}, false
+		}
+	}
+	return goldenMismatch{}, true
+}
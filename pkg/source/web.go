@@ -0,0 +1,261 @@
+package source
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocolly/colly"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/odds"
+)
+
+// CSS selectors of the racing site. The site uses styled-components so the
+// class suffixes change whenever it is redeployed.
+const (
+	runnersSelector    = "table.AbcTable__TableContent-sc-9z9a8v-3 tbody tr"
+	conditionsSelector = "li.RacingRacecardSummary__StyledAdditionalInfo-sc-1intsbr-2"
+	headerSelector     = "table.Header__DataTable-xeaizz-1"
+	headerValue        = "td.Header__DataValue-xeaizz-4"
+	formSelector       = "table.FormTable__StyledTable-sc-1xr7jxa-1 tbody tr"
+)
+
+var selectionIDPattern = regexp.MustCompile(`/horse/(\d+)$`)
+
+// WebSource scrapes the racing site configured by DataLink.
+type WebSource struct {
+	BaseURL string
+	// Transport replaces the HTTP transport of the collectors when set
+	Transport http.RoundTripper
+	// Monitor records every page fetched when set
+	Monitor Monitor
+}
+
+// NewWebSource returns a source scraping the site at baseURL.
+func NewWebSource(baseURL string) *WebSource {
+	return &WebSource{BaseURL: baseURL}
+}
+
+func (s *WebSource) newCollector() *colly.Collector {
+	c := colly.NewCollector()
+	if s.Transport != nil {
+		c.WithTransport(s.Transport)
+	}
+	return c
+}
+
+// runnersPath returns the A-Z guide for the date, today's guide has no date suffix.
+func runnersPath(date string) string {
+	if date == "" || date == time.Now().Format("2006-01-02") {
+		return "/racing/abc-guide"
+	}
+	return "/racing/abc-guide/" + date
+}
+
+func (s *WebSource) Runners(date string) ([]models.MeetingSelections, error) {
+	c := s.newCollector()
+
+	// Slice to store all horse information
+	horses := []models.MeetingSelections{}
+
+	c.OnHTML(runnersSelector, func(e *colly.HTMLElement) {
+		horses = append(horses, parseRunner(e))
+	})
+
+	// Start scraping the URL
+	err := s.visit(c, KindRunners, s.BaseURL+runnersPath(date), func() int { return len(horses) })
+	if err != nil {
+		return horses, err
+	}
+
+	return horses, nil
+}
+
+func (s *WebSource) RaceConditions(eventLink string) (models.RaceConditon, error) {
+	c := s.newCollector()
+	raceConditons := models.RaceConditon{}
+	found := 0
+
+	c.OnHTML(conditionsSelector, func(e *colly.HTMLElement) {
+		raceConditons = extractRaceInfo(e.Text)
+		found = 1
+	})
+
+	err := s.visit(c, KindConditions, s.BaseURL+eventLink, func() int { return found })
+	if err != nil {
+		return raceConditons, err
+	}
+
+	return raceConditons, nil
+}
+
+func (s *WebSource) SelectionForm(selectionLink string) ([]models.SelectionForm, error) {
+	c := s.newCollector()
+
+	// Slice to store all horse information
+	selectionsForm := []models.SelectionForm{}
+
+	var header models.SelectionForm
+
+	c.OnHTML(headerSelector, func(e *colly.HTMLElement) {
+		header = parseFormHeader(e)
+	})
+
+	c.OnHTML(formSelector, func(e *colly.HTMLElement) {
+		selectionForm, ok := parseFormLine(e)
+		if !ok {
+			return
+		}
+		selectionForm.Age = header.Age
+		selectionForm.Trainer = header.Trainer
+		selectionForm.Sex = header.Sex
+		selectionForm.Sire = header.Sire
+		selectionForm.Dam = header.Dam
+		selectionForm.Owner = header.Owner
+
+		selectionsForm = append(selectionsForm, selectionForm)
+	})
+
+	err := s.visit(c, KindForm, s.BaseURL+selectionLink, func() int { return len(selectionsForm) })
+	if err != nil {
+		return selectionsForm, err
+	}
+
+	return selectionsForm, nil
+}
+
+func (s *WebSource) Result(selectionLink string, eventDate string) (models.SelectionForm, error) {
+	c := s.newCollector()
+
+	selectionForm := models.SelectionForm{}
+
+	date, err := time.Parse("2006-01-02", eventDate)
+	if err != nil {
+		return selectionForm, err
+	}
+
+	lines := 0
+	c.OnHTML(formSelector, func(e *colly.HTMLElement) {
+		line, ok := parseFormLine(e)
+		if ok {
+			lines++
+		}
+		if ok && line.RaceDate.Equal(date) {
+			selectionForm = line
+		}
+	})
+
+	err = s.visit(c, KindResult, s.BaseURL+selectionLink, func() int { return lines })
+	if err != nil {
+		return selectionForm, err
+	}
+
+	return selectionForm, nil
+}
+
+// parseRunner reads one row of the A-Z guide.
+func parseRunner(e *colly.HTMLElement) models.MeetingSelections {
+	name := e.ChildText("td:nth-child(1) a")
+	selectionLink := e.ChildAttr("td:nth-child(1) a", "href")
+	event := e.ChildText("td:nth-child(3) a")
+	eventLink := e.ChildAttr("td:nth-child(3) a", "href")
+	price := e.ChildText("th:nth-child(5) span")
+
+	// The event cell reads "14:30 Ascot"
+	eventTime, eventName, _ := strings.Cut(event, " ")
+
+	selectionId := 0
+	if match := selectionIDPattern.FindStringSubmatch(selectionLink); len(match) > 1 {
+		selectionId, _ = strconv.Atoi(match[1])
+	}
+
+	return models.MeetingSelections{
+		SelectionName: name,
+		SelectionLink: selectionLink,
+		EventLink:     eventLink,
+		EventTime:     eventTime,
+		EventName:     eventName,
+		Price:         odds.Clean(price),
+		SelectionID:   selectionId,
+	}
+}
+
+// parseFormHeader reads the horse details table at the top of a form page.
+func parseFormHeader(e *colly.HTMLElement) models.SelectionForm {
+	return models.SelectionForm{
+		Age:     e.ChildText("tr:nth-child(1) " + headerValue),
+		Trainer: e.ChildText("tr:nth-child(2) " + headerValue + " a"),
+		Sex:     e.ChildText("tr:nth-child(3) " + headerValue),
+		Sire:    e.ChildText("tr:nth-child(4) " + headerValue),
+		Dam:     e.ChildText("tr:nth-child(5) " + headerValue),
+		Owner:   e.ChildText("tr:nth-child(6) " + headerValue),
+	}
+}
+
+// parseFormLine reads one row of a form table, rows without a dd/mm/yy date are skipped.
+func parseFormLine(e *colly.HTMLElement) (models.SelectionForm, bool) {
+	raceDate := e.ChildText("td:nth-child(1) a")
+
+	dateParts := strings.Split(raceDate, "/")
+	if len(dateParts) != 3 {
+		return models.SelectionForm{}, false
+	}
+	parsedRaceDate, err := time.Parse("2006-01-02", "20"+dateParts[2]+"-"+dateParts[1]+"-"+dateParts[0])
+	if err != nil {
+		return models.SelectionForm{}, false
+	}
+
+	return models.SelectionForm{
+		RaceDate:   parsedRaceDate,
+		Position:   e.ChildText("td:nth-child(2)"),
+		Rating:     e.ChildText("td:nth-child(3)"),
+		RaceType:   e.ChildText("td:nth-child(4)"),
+		Racecourse: e.ChildText("td:nth-child(5)"),
+		Distance:   e.ChildText("td:nth-child(6)"),
+		Going:      e.ChildText("td:nth-child(7)"),
+		RaceClass:  e.ChildText("td:nth-child(8)"),
+		SpOdds:     odds.Clean(e.ChildText("td:nth-child(9)")),
+		RaceURL:    e.ChildAttr("td:nth-child(1) a", "href"),
+		EventDate:  parsedRaceDate,
+	}, true
+}
+
+func extractRaceInfo(content string) models.RaceConditon {
+	// Split the content by '|'
+	parts := strings.Split(content, "|")
+
+	// Trim whitespace from each part
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	// Patterns to recognize specific parts
+	distancePattern := regexp.MustCompile(`\d+m \d+f \d+y|\d+f \d+y|\d+m|\d+f|\d+y`) // Extended pattern for various distance formats
+	runnersPattern := regexp.MustCompile(`\d+ Runners`)
+
+	// Assign defaults
+	raceDistance := "Unknown"
+	numberOfRunners := "Unknown"
+	raceCategory := ""
+
+	// Assign values based on regex patterns
+	for i, part := range parts {
+		switch {
+		case distancePattern.MatchString(part):
+			raceDistance = part
+		case runnersPattern.MatchString(part):
+			numberOfRunners = part
+		case i == 0:
+			// The summary opens with the category: "Class 4 Handicap", "Group 3"
+			raceCategory = part
+		}
+	}
+
+	return models.RaceConditon{
+		RaceCategory:    raceCategory,
+		RaceDistance:    raceDistance,
+		NumberOfRunners: numberOfRunners,
+	}
+}
@@ -0,0 +1,638 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// AnalysisStore reads and writes the scored runners and their results
+type AnalysisStore interface {
+	// Upsert saves the analysis of a selection under data.Profile with its
+	// component scores, replacing the scores of an earlier run of the profile
+	// for the same event date but keeping any settled result and the stake of
+	// the first run
+	Upsert(ctx context.Context, eventDate, price string, data models.AnalysisData) error
+	// Breakdown returns the component scores of a selection analysed under
+	// profile on eventDate, or on its latest analysed date when eventDate is
+	// empty. sql.ErrNoRows is returned when it was not analysed.
+	Breakdown(ctx context.Context, selectionID int, eventDate, profile string) (models.AnalysisBreakdown, error)
+	// Predictions returns the selections of the date run in region best scored
+	// by profile, "Both" covers the UK and Ireland
+	Predictions(ctx context.Context, eventDate, region, profile string, limit int) ([]models.EventPrediction, error)
+	// Selection returns the analysis of a selection under profile, or under
+	// any profile when profile is empty, with its result, if settled. Its
+	// SelectionID is 0 when the selection was not analysed.
+	Selection(ctx context.Context, eventDate string, selectionID int, profile string) (models.EventPrediction, error)
+	// Settled returns the runners analysed under profile from from to to that
+	// have a win probability and a result, race by race
+	Settled(ctx context.Context, from, to, profile string) ([]models.EventPrediction, error)
+	// Probabilities returns the runners of the date analysed under profile
+	// that have a win probability, race by race
+	Probabilities(ctx context.Context, eventDate, profile string) ([]models.EventPrediction, error)
+	// Unsettled returns the selection and profile of the analyses of the
+	// date that have no result yet
+	Unsettled(ctx context.Context, eventDate string) ([]models.EventPrediction, error)
+	// Settle stores the result, stake, return and profit of a selection
+	// analysed under prediction.Profile
+	Settle(ctx context.Context, prediction models.EventPrediction) error
+	// TotalBet returns the amount staked on the settled selections run in
+	// country, as scored by the default profile
+	TotalBet(ctx context.Context, country string) (float64, error)
+	// TotalReturn returns the amount returned, stakes included, by the
+	// settled selections run in country, as scored by the default profile
+	TotalReturn(ctx context.Context, country string) (float64, error)
+	// ConstantScore returns the score_constants value of an item of the
+	// default profile
+	ConstantScore(ctx context.Context, category, item string) (float64, error)
+	// ScoringProfile returns the score_constants of a profile: its own
+	// categories, and those of the default profile it does not set.
+	// ErrUnknownProfile is returned when the profile has no rows.
+	ScoringProfile(ctx context.Context, profile string) ([]models.ScoreConstant, error)
+	// ScoringProfiles returns the names of the profiles, sorted
+	ScoringProfiles(ctx context.Context) ([]string, error)
+	// SaveScoringProfile replaces the score_constants of a profile
+	SaveScoringProfile(ctx context.Context, profile string, constants []models.ScoreConstant) error
+}
+
+// SQLAnalysisStore is the AnalysisStore backed by the Analysis table
+type SQLAnalysisStore struct {
+	DB *database.DB
+}
+
+func (s *SQLAnalysisStore) Upsert(ctx context.Context, eventDate, price string, data models.AnalysisData) error {
+	raceDate := data.RaceDate
+	if len(raceDate) > 10 {
+		raceDate = raceDate[:10]
+	}
+
+	ageStr := strings.Split(data.Age, " ")[0]
+	ageInt, _ := strconv.Atoi(ageStr)
+	numberOfRuns := strings.Split(data.AllCources, ",")
+
+	numRunners := strings.Split(data.NumberOfRunners, " ")[0]
+	intNumRunners, _ := strconv.Atoi(numRunners)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, s.DB.Dialect.Rebind(`
+		INSERT INTO Analysis (
+					event_link,
+					selection_link,
+					event_date, race_date, selection_id,
+					selection_name, odds, age,
+					clean_bet_score, average_position,
+					average_rating, event_name,
+					event_time, selection_position, num_runners, number_runs, prefered_distance, current_distance, seed, profile, win_probability, stake, bet_type)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (selection_id, event_date, profile) DO UPDATE SET
+					event_link = excluded.event_link,
+					selection_link = excluded.selection_link,
+					race_date = excluded.race_date,
+					selection_name = excluded.selection_name,
+					odds = excluded.odds,
+					age = excluded.age,
+					clean_bet_score = excluded.clean_bet_score,
+					average_position = excluded.average_position,
+					average_rating = excluded.average_rating,
+					event_name = excluded.event_name,
+					event_time = excluded.event_time,
+					selection_position = excluded.selection_position,
+					num_runners = excluded.num_runners,
+					number_runs = excluded.number_runs,
+					prefered_distance = excluded.prefered_distance,
+					current_distance = excluded.current_distance,
+					seed = excluded.seed,
+					win_probability = excluded.win_probability,
+					stake = COALESCE(Analysis.stake, excluded.stake),
+					bet_type = COALESCE(Analysis.bet_type, excluded.bet_type),
+					updated_at = CURRENT_TIMESTAMP`),
+		data.EventLink,
+		data.SelecionLink,
+		eventDate,
+		raceDate,
+		data.SelectionID,
+		data.SelectionName,
+		price,
+		ageInt,
+		math.Round(data.TotalScore*1000)/1000,
+		data.AvgPosition,
+		math.Round(data.AvgRating*1000)/1000,
+		data.EventName,
+		data.EventTime,
+		data.Position,
+		intNumRunners,
+		len(numberOfRuns),
+		math.Round(data.PreferedDistance*1000)/1000,
+		math.Round(data.CurrentDistance*1000)/1000,
+		data.Seed,
+		data.Profile,
+		math.Round(data.WinProbability*1e6)/1e6,
+		data.Stake,
+		data.BetType,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, s.DB.Dialect.Rebind(`
+		DELETE FROM AnalysisBreakdown WHERE selection_id = ? AND event_date = ? AND profile = ?`),
+		data.SelectionID, eventDate, data.Profile)
+	if err != nil {
+		return err
+	}
+
+	for _, component := range data.Components {
+		_, err = tx.ExecContext(ctx, s.DB.Dialect.Rebind(`
+			INSERT INTO AnalysisBreakdown (selection_id, event_date, profile, component, value, points, weight, score)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+			data.SelectionID, eventDate, data.Profile, component.Component,
+			math.Round(component.Value*1000)/1000,
+			math.Round(component.Points*1000)/1000,
+			component.Weight,
+			math.Round(component.Score*1000)/1000,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLAnalysisStore) Breakdown(ctx context.Context, selectionID int, eventDate, profile string) (models.AnalysisBreakdown, error) {
+	var breakdown models.AnalysisBreakdown
+
+	query := `
+		SELECT selection_id,
+			selection_name,
+			COALESCE(event_name, ''),
+			event_date,
+			COALESCE(event_time, ''),
+			profile,
+			COALESCE(seed, 0),
+			COALESCE(clean_bet_score, 0),
+			COALESCE(win_probability, 0)
+		FROM Analysis
+		WHERE selection_id = ? AND profile = ?`
+	args := []interface{}{selectionID, profile}
+	if eventDate != "" {
+		query += ` AND event_date = ?`
+		args = append(args, eventDate)
+	}
+	query += ` ORDER BY event_date DESC LIMIT 1`
+
+	err := s.DB.QueryRowContext(ctx, query, args...).Scan(
+		&breakdown.SelectionID,
+		&breakdown.SelectionName,
+		&breakdown.EventName,
+		&breakdown.EventDate,
+		&breakdown.EventTime,
+		&breakdown.Profile,
+		&breakdown.Seed,
+		&breakdown.CleanBetScore,
+		&breakdown.WinProbability,
+	)
+	if err != nil {
+		return breakdown, err
+	}
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT component, COALESCE(value, 0), points, weight, score
+		FROM AnalysisBreakdown
+		WHERE selection_id = ? AND event_date = ? AND profile = ?
+		ORDER BY id`,
+		breakdown.SelectionID, breakdown.EventDate, breakdown.Profile)
+	if err != nil {
+		return breakdown, err
+	}
+	defer rows.Close()
+
+	breakdown.Components = []models.ComponentScore{}
+	for rows.Next() {
+		var component models.ComponentScore
+		if err := rows.Scan(&component.Component, &component.Value, &component.Points, &component.Weight, &component.Score); err != nil {
+			return breakdown, err
+		}
+		breakdown.Components = append(breakdown.Components, component)
+	}
+
+	return breakdown, rows.Err()
+}
+
+func (s *SQLAnalysisStore) Predictions(ctx context.Context, eventDate, region, profile string, limit int) ([]models.EventPrediction, error) {
+	query := `
+		SELECT id,
+			selection_id,
+			selection_name,
+			COALESCE(odds, '') as odds,
+			COALESCE(age, 0) as age,
+			COALESCE(clean_bet_score, 0) as clean_bet_score,
+			COALESCE(average_position, 0) as average_position,
+			COALESCE(average_rating, 0) as average_rating,
+			event_name,
+			COALESCE(event_date, '') as event_date,
+			COALESCE(race_date, '') as race_date,
+			COALESCE(event_time, '') as event_time,
+			COALESCE(selection_position, '') as selection_position,
+			ABS(prefered_distance - current_distance) as distanceTolerence,
+			COALESCE(num_runners, 0) as num_runners,
+			COALESCE(number_runs, 0) as number_runs,
+			COALESCE(prefered_distance, 0) as prefered_distance,
+			COALESCE(current_distance, 0) as current_distance,
+			COALESCE(potential_return, '') as potential_return,
+			COALESCE(current_event_price, '') as current_event_price,
+			COALESCE(current_event_position, '') as current_event_position,
+			COALESCE(seed, 0) as seed,
+			profile,
+			COALESCE(win_probability, 0) as win_probability,
+			COALESCE(bet_type, 'win') as bet_type,
+			COALESCE(stake, 0) as stake,
+			place_places,
+			place_fraction,
+			COALESCE(gross_return, 0) as gross_return,
+			COALESCE(net_profit, 0) as net_profit,
+			created_at,
+			updated_at
+		FROM Analysis
+		WHERE event_date = ? AND profile = ? and age < 8`
+	args := []interface{}{eventDate, profile}
+
+	// Modify query based on region parameter
+	if strings.EqualFold(region, "Both") {
+		query += ` AND event_name IN (SELECT event_name FROM Events WHERE country IN ('UK', 'Ireland'))`
+	} else {
+		query += ` AND event_name IN (SELECT event_name FROM Events WHERE country = ?)`
+		args = append(args, region)
+	}
+
+	query += ` ORDER BY clean_bet_score DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var predictions []models.EventPrediction
+	for rows.Next() {
+		prediction := models.EventPrediction{}
+		var places, fraction sql.NullInt64
+		err := rows.Scan(
+			&prediction.ID,
+			&prediction.SelectionID,
+			&prediction.SelectionName,
+			&prediction.Odds,
+			&prediction.Age,
+			&prediction.CleanBetScore,
+			&prediction.AveragePosition,
+			&prediction.AverageRating,
+			&prediction.EventName,
+			&prediction.EventDate,
+			&prediction.RaceDate,
+			&prediction.EventTime,
+			&prediction.SelectionPosition,
+			&prediction.DistanceTolerence,
+			&prediction.NumRunners,
+			&prediction.NumbeRuns,
+			&prediction.PreferredDistance,
+			&prediction.CurrentDistance,
+			&prediction.PotentialReturn,
+			&prediction.CurrentEventPrice,
+			&prediction.CurrentEventPosition,
+			&prediction.Seed,
+			&prediction.Profile,
+			&prediction.WinProbability,
+			&prediction.BetType,
+			&prediction.Stake,
+			&places,
+			&fraction,
+			&prediction.GrossReturn,
+			&prediction.NetProfit,
+			&prediction.CreatedAt,
+			&prediction.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		prediction.PlaceTerms = placeTerms(places, fraction)
+		predictions = append(predictions, prediction)
+	}
+
+	return predictions, rows.Err()
+}
+
+func (s *SQLAnalysisStore) Selection(ctx context.Context, eventDate string, selectionID int, profile string) (models.EventPrediction, error) {
+	var prediction models.EventPrediction
+
+	query := `
+		SELECT selection_id,
+			selection_name,
+			selection_link,
+			potential_return,
+			current_event_price,
+			current_event_position,
+			COALESCE(stake, 0),
+			COALESCE(bet_type, 'win'),
+			COALESCE(num_runners, 0),
+			COALESCE(odds, ''),
+			COALESCE(event_name, ''),
+			COALESCE(event_time, ''),
+			profile
+		FROM Analysis
+		WHERE event_date = ? AND selection_id = ?`
+	args := []interface{}{eventDate, selectionID}
+	if profile != "" {
+		query += ` AND profile = ?`
+		args = append(args, profile)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return prediction, err
+	}
+	defer rows.Close()
+
+	var potentialReturn, currentEventPrice, currentEventPosition sql.NullString
+	for rows.Next() {
+		if err := rows.Scan(
+			&prediction.SelectionID,
+			&prediction.SelectionName,
+			&prediction.SelectionLink,
+			&potentialReturn,
+			&currentEventPrice,
+			&currentEventPosition,
+			&prediction.Stake,
+			&prediction.BetType,
+			&prediction.NumRunners,
+			&prediction.Odds,
+			&prediction.EventName,
+			&prediction.EventTime,
+			&prediction.Profile,
+		); err != nil {
+			return prediction, err
+		}
+
+		prediction.CurrentEventPrice = nullableToString(currentEventPrice)
+	}
+
+	return prediction, rows.Err()
+}
+
+func (s *SQLAnalysisStore) Settled(ctx context.Context, from, to, profile string) ([]models.EventPrediction, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT selection_id,
+			selection_name,
+			event_date,
+			COALESCE(event_name, ''),
+			COALESCE(event_time, ''),
+			COALESCE(clean_bet_score, 0),
+			win_probability,
+			COALESCE(current_event_position, '')
+		FROM Analysis
+		WHERE profile = ? AND event_date >= ? AND event_date <= ?
+		AND win_probability IS NOT NULL AND COALESCE(current_event_price, '') <> ''
+		ORDER BY event_date, event_name, event_time, selection_id`,
+		profile, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var predictions []models.EventPrediction
+	for rows.Next() {
+		var prediction models.EventPrediction
+		if err := rows.Scan(
+			&prediction.SelectionID,
+			&prediction.SelectionName,
+			&prediction.EventDate,
+			&prediction.EventName,
+			&prediction.EventTime,
+			&prediction.CleanBetScore,
+			&prediction.WinProbability,
+			&prediction.CurrentEventPosition,
+		); err != nil {
+			return nil, err
+		}
+		predictions = append(predictions, prediction)
+	}
+
+	return predictions, rows.Err()
+}
+
+func (s *SQLAnalysisStore) Probabilities(ctx context.Context, eventDate, profile string) ([]models.EventPrediction, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT selection_id,
+			selection_name,
+			event_date,
+			COALESCE(event_name, ''),
+			COALESCE(event_time, ''),
+			COALESCE(clean_bet_score, 0),
+			win_probability
+		FROM Analysis
+		WHERE event_date = ? AND profile = ? AND win_probability IS NOT NULL
+		ORDER BY event_name, event_time, clean_bet_score DESC, selection_id`,
+		eventDate, profile)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var predictions []models.EventPrediction
+	for rows.Next() {
+		var prediction models.EventPrediction
+		if err := rows.Scan(
+			&prediction.SelectionID,
+			&prediction.SelectionName,
+			&prediction.EventDate,
+			&prediction.EventName,
+			&prediction.EventTime,
+			&prediction.CleanBetScore,
+			&prediction.WinProbability,
+		); err != nil {
+			return nil, err
+		}
+		predictions = append(predictions, prediction)
+	}
+
+	return predictions, rows.Err()
+}
+
+func (s *SQLAnalysisStore) Unsettled(ctx context.Context, eventDate string) ([]models.EventPrediction, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT selection_id, profile
+		FROM Analysis
+		WHERE event_date = ? AND COALESCE(current_event_price, '') = ''
+		ORDER BY selection_id, profile`, eventDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var unsettled []models.EventPrediction
+	for rows.Next() {
+		prediction := models.EventPrediction{EventDate: eventDate}
+		if err := rows.Scan(&prediction.SelectionID, &prediction.Profile); err != nil {
+			return nil, err
+		}
+		unsettled = append(unsettled, prediction)
+	}
+
+	return unsettled, rows.Err()
+}
+
+func (s *SQLAnalysisStore) Settle(ctx context.Context, prediction models.EventPrediction) error {
+	var places, fraction sql.NullInt64
+	if prediction.PlaceTerms != nil {
+		places = sql.NullInt64{Int64: int64(prediction.PlaceTerms.Places), Valid: true}
+		fraction = sql.NullInt64{Int64: int64(prediction.PlaceTerms.Fraction), Valid: true}
+	}
+
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE Analysis
+		SET current_event_price = ?,
+			current_event_position = ?,
+			potential_return = ?,
+			stake = ?,
+			place_places = ?,
+			place_fraction = ?,
+			gross_return = ?,
+			net_profit = ?
+		WHERE selection_id = ? AND event_date = ? AND profile = ?`,
+		prediction.CurrentEventPrice,
+		prediction.CurrentEventPosition,
+		prediction.PotentialReturn,
+		prediction.Stake,
+		places,
+		fraction,
+		prediction.GrossReturn,
+		prediction.NetProfit,
+		prediction.SelectionID, prediction.EventDate, prediction.Profile)
+	return err
+}
+
+// placeTerms returns the each-way terms of a settled bet, nil for a win bet
+func placeTerms(places, fraction sql.NullInt64) *models.PlaceTerms {
+	if !places.Valid || !fraction.Valid {
+		return nil
+	}
+	return &models.PlaceTerms{Places: int(places.Int64), Fraction: int(fraction.Int64)}
+}
+
+func (s *SQLAnalysisStore) TotalBet(ctx context.Context, country string) (float64, error) {
+	var totalBet float64
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COALESCE(sum(stake), 0)
+		FROM Analysis
+		WHERE gross_return IS NOT NULL AND profile = ?
+		AND event_name IN (SELECT event_name FROM Events WHERE country = ?)`, models.DefaultScoringProfile, country).Scan(&totalBet)
+	return totalBet, err
+}
+
+func (s *SQLAnalysisStore) TotalReturn(ctx context.Context, country string) (float64, error) {
+	var totalReturn float64
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COALESCE(sum(gross_return), 0)
+		FROM Analysis
+		WHERE gross_return IS NOT NULL AND profile = ?
+		AND event_name IN (SELECT event_name FROM Events WHERE country = ?)`,
+		models.DefaultScoringProfile, country).Scan(&totalReturn)
+	return totalReturn, err
+}
+
+func (s *SQLAnalysisStore) ConstantScore(ctx context.Context, category, item string) (float64, error) {
+	var score float64
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT score FROM score_constants WHERE profile = ? AND category = ? AND item = ?`,
+		models.DefaultScoringProfile, category, item).Scan(&score)
+	return score, err
+}
+
+func (s *SQLAnalysisStore) ScoringProfile(ctx context.Context, profile string) ([]models.ScoreConstant, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT profile, category, item, score
+		FROM score_constants
+		WHERE profile = ?
+		OR (profile = ? AND category NOT IN (SELECT category FROM score_constants WHERE profile = ?))
+		ORDER BY category, item`,
+		profile, models.DefaultScoringProfile, profile)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var constants []models.ScoreConstant
+	found := false
+	for rows.Next() {
+		var rowProfile string
+		var constant models.ScoreConstant
+		if err := rows.Scan(&rowProfile, &constant.Category, &constant.Item, &constant.Score); err != nil {
+			return nil, err
+		}
+		found = found || rowProfile == profile
+		constants = append(constants, constant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w %q", ErrUnknownProfile, profile)
+	}
+
+	return constants, nil
+}
+
+func (s *SQLAnalysisStore) ScoringProfiles(ctx context.Context) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT DISTINCT profile FROM score_constants ORDER BY profile`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []string
+	for rows.Next() {
+		var profile string
+		if err := rows.Scan(&profile); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, rows.Err()
+}
+
+func (s *SQLAnalysisStore) SaveScoringProfile(ctx context.Context, profile string, constants []models.ScoreConstant) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, s.DB.Dialect.Rebind(`DELETE FROM score_constants WHERE profile = ?`), profile)
+	if err != nil {
+		return err
+	}
+
+	for _, constant := range constants {
+		_, err = tx.ExecContext(ctx, s.DB.Dialect.Rebind(`
+			INSERT INTO score_constants (profile, category, item, score) VALUES (?, ?, ?, ?)`),
+			profile, constant.Category, constant.Item, constant.Score)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// TestPredictions returns the best scored selections of the region and
+// profile, settled ones with their result
+func TestPredictions(t *testing.T) {
+	eachDialect(t, testPredictions)
+}
+
+func testPredictions(t *testing.T, db *database.DB) {
+	ctx := context.Background()
+	st := New(db)
+
+	analyses := []models.AnalysisData{
+		{SelectionID: 1, SelectionName: "Alpha", EventName: "Ascot", EventTime: "14:30", Age: "4", TotalScore: 30, WinProbability: 0.6},
+		{SelectionID: 2, SelectionName: "Bravo", EventName: "Ascot", EventTime: "14:30", Age: "5", TotalScore: 20, WinProbability: 0.4},
+		{SelectionID: 3, SelectionName: "Charlie", EventName: "The Curragh", EventTime: "15:05", Age: "3", TotalScore: 40, WinProbability: 1},
+		{SelectionID: 4, SelectionName: "Delta", EventName: "Ascot", EventTime: "16:10", Age: "9", TotalScore: 50, WinProbability: 1},
+	}
+	for _, data := range analyses {
+		data.Profile = models.DefaultScoringProfile
+		data.Stake = 10
+		data.BetType = models.BetTypeWin
+		if err := st.Analysis.Upsert(ctx, "2024-10-05", "2/1", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := analyses[1]
+	other.Profile, other.TotalScore = "aggressive", 60
+	if err := st.Analysis.Upsert(ctx, "2024-10-05", "2/1", other); err != nil {
+		t.Fatal(err)
+	}
+
+	settled := models.EventPrediction{SelectionID: 1, EventDate: "2024-10-05", Profile: models.DefaultScoringProfile,
+		CurrentEventPrice: "2/1", CurrentEventPosition: "1/8", Stake: 10, GrossReturn: 30, NetProfit: 20, PotentialReturn: "30.00"}
+	if err := st.Analysis.Settle(ctx, settled); err != nil {
+		t.Fatal(err)
+	}
+
+	// Delta is too old and Charlie runs in Ireland
+	predictions, err := st.Analysis.Predictions(ctx, "2024-10-05", "UK", models.DefaultScoringProfile, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(predictions) != 2 || predictions[0].SelectionName != "Alpha" || predictions[1].SelectionName != "Bravo" {
+		t.Fatalf("got %+v, want Alpha then Bravo", predictions)
+	}
+	if predictions[0].CurrentEventPosition != "1/8" || predictions[0].NetProfit != 20 {
+		t.Errorf("got Alpha finishing %q for %g, want its settled result", predictions[0].CurrentEventPosition, predictions[0].NetProfit)
+	}
+	if predictions[1].CleanBetScore != 20 {
+		t.Errorf("got Bravo scored %g, want the default profile's 20", predictions[1].CleanBetScore)
+	}
+
+	both, err := st.Analysis.Predictions(ctx, "2024-10-05", "Both", models.DefaultScoringProfile, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(both) != 2 || both[0].SelectionName != "Charlie" || both[1].SelectionName != "Alpha" {
+		t.Errorf("got %+v, want Charlie then Alpha", both)
+	}
+}
+
+// TestSettleProfile settles the analysis of one profile, leaving the stake
+// and result of the other profiles of the selection alone
+func TestSettleProfile(t *testing.T) {
+	eachDialect(t, testSettleProfile)
+}
+
+func testSettleProfile(t *testing.T, db *database.DB) {
+	ctx := context.Background()
+	st := New(db)
+
+	data := models.AnalysisData{SelectionID: 1, SelectionName: "Alpha", EventName: "Ascot", EventTime: "14:30", BetType: models.BetTypeWin}
+	for profile, stake := range map[string]float64{models.DefaultScoringProfile: 10, "aggressive": 25} {
+		data.Profile, data.Stake = profile, stake
+		if err := st.Analysis.Upsert(ctx, "2024-10-05", "2/1", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	unsettled, err := st.Analysis.Unsettled(ctx, "2024-10-05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unsettled) != 2 || unsettled[0].Profile != "aggressive" || unsettled[1].Profile != models.DefaultScoringProfile {
+		t.Fatalf("got %+v, want Alpha under both profiles", unsettled)
+	}
+
+	settled := models.EventPrediction{SelectionID: 1, EventDate: "2024-10-05", Profile: models.DefaultScoringProfile,
+		CurrentEventPrice: "2/1", CurrentEventPosition: "1/8", Stake: 10, GrossReturn: 30, NetProfit: 20, PotentialReturn: "30.00"}
+	if err := st.Analysis.Settle(ctx, settled); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := st.Analysis.Selection(ctx, "2024-10-05", 1, "aggressive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.CurrentEventPrice != "" || other.Stake != 25 {
+		t.Errorf("got the aggressive analysis settled at %q with a stake of %g, want it untouched", other.CurrentEventPrice, other.Stake)
+	}
+	unsettled, err = st.Analysis.Unsettled(ctx, "2024-10-05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unsettled) != 1 || unsettled[0].Profile != "aggressive" {
+		t.Errorf("got %+v, want only the aggressive analysis unsettled", unsettled)
+	}
+}
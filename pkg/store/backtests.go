@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// BacktestStore reads and writes the stored backtest runs
+type BacktestStore interface {
+	// Save stores a backtest and returns it with its ID
+	Save(ctx context.Context, backtest models.Backtest) (models.Backtest, error)
+	// Get returns a backtest, sql.ErrNoRows when there is none with id
+	Get(ctx context.Context, id int) (models.Backtest, error)
+	// List returns the latest limit backtests, newest first, of profile or
+	// of every profile when it is empty
+	List(ctx context.Context, profile string, limit int) ([]models.Backtest, error)
+}
+
+// SQLBacktestStore is the BacktestStore backed by the Backtests table
+type SQLBacktestStore struct {
+	DB *database.DB
+}
+
+const backtestColumns = `id, name, profile, from_date, to_date, params, races, bets, winners, unsettled,
+			strike_rate, staked, returned, profit, roi, max_drawdown, longest_losing_run,
+			per_course, per_region, created_at`
+
+func (s *SQLBacktestStore) Save(ctx context.Context, backtest models.Backtest) (models.Backtest, error) {
+	params, err := json.Marshal(backtest.Params)
+	if err != nil {
+		return backtest, err
+	}
+	perCourse, err := json.Marshal(backtest.PerCourse)
+	if err != nil {
+		return backtest, err
+	}
+	perRegion, err := json.Marshal(backtest.PerRegion)
+	if err != nil {
+		return backtest, err
+	}
+
+	err = s.DB.QueryRowContext(ctx, `
+		INSERT INTO Backtests (name, profile, from_date, to_date, params, races, bets, winners, unsettled,
+			strike_rate, staked, returned, profit, roi, max_drawdown, longest_losing_run,
+			per_course, per_region)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, created_at`,
+		backtest.Name, backtest.Profile, backtest.From, backtest.To, string(params),
+		backtest.Races, backtest.Bets, backtest.Winners, backtest.Unsettled,
+		backtest.StrikeRate, backtest.Staked, backtest.Returned, backtest.Profit, backtest.ROI,
+		backtest.MaxDrawdown, backtest.LongestLosingRun,
+		string(perCourse), string(perRegion),
+	).Scan(&backtest.ID, &backtest.CreatedAt)
+	return backtest, err
+}
+
+func (s *SQLBacktestStore) Get(ctx context.Context, id int) (models.Backtest, error) {
+	row := s.DB.QueryRowContext(ctx, `SELECT `+backtestColumns+` FROM Backtests WHERE id = ?`, id)
+	return scanBacktest(row)
+}
+
+func (s *SQLBacktestStore) List(ctx context.Context, profile string, limit int) ([]models.Backtest, error) {
+	query := `SELECT ` + backtestColumns + ` FROM Backtests`
+	var args []interface{}
+	if profile != "" {
+		query += ` WHERE profile = ?`
+		args = append(args, profile)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	backtests := []models.Backtest{}
+	for rows.Next() {
+		backtest, err := scanBacktest(rows)
+		if err != nil {
+			return nil, err
+		}
+		backtests = append(backtests, backtest)
+	}
+
+	return backtests, rows.Err()
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBacktest(row scanner) (models.Backtest, error) {
+	var backtest models.Backtest
+	var params, perCourse, perRegion string
+	err := row.Scan(
+		&backtest.ID, &backtest.Name, &backtest.Profile, &backtest.From, &backtest.To, &params,
+		&backtest.Races, &backtest.Bets, &backtest.Winners, &backtest.Unsettled,
+		&backtest.StrikeRate, &backtest.Staked, &backtest.Returned, &backtest.Profit, &backtest.ROI,
+		&backtest.MaxDrawdown, &backtest.LongestLosingRun,
+		&perCourse, &perRegion, &backtest.CreatedAt,
+	)
+	if err != nil {
+		return backtest, err
+	}
+
+	if err := json.Unmarshal([]byte(params), &backtest.Params); err != nil {
+		return backtest, err
+	}
+	if err := json.Unmarshal([]byte(perCourse), &backtest.PerCourse); err != nil {
+		return backtest, err
+	}
+	if err := json.Unmarshal([]byte(perRegion), &backtest.PerRegion); err != nil {
+		return backtest, err
+	}
+	return backtest, nil
+}
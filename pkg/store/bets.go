@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// BetStore reads and writes the bets users placed and the plans they stake
+// them by
+type BetStore interface {
+	// Create stores a bet and returns it with its ID
+	Create(ctx context.Context, bet models.Bet) (models.Bet, error)
+	// List returns the bets of a user run from from to to, either of which
+	// may be empty, with status when it is not empty, in the order they were
+	// run
+	List(ctx context.Context, userID int, from, to, status string) ([]models.Bet, error)
+	// Open returns the open bets of a user run up to date, of every user when
+	// userID is 0
+	Open(ctx context.Context, userID int, date string) ([]models.Bet, error)
+	// Settle stores the status, position, return and profit of a bet
+	Settle(ctx context.Context, bet models.Bet) error
+	// StakingPlan returns the staking plan of a user, sql.ErrNoRows when the
+	// user saved none
+	StakingPlan(ctx context.Context, userID int) (models.StakingPlan, error)
+	// SaveStakingPlan replaces the staking plan of a user
+	SaveStakingPlan(ctx context.Context, userID int, plan models.StakingPlan) error
+}
+
+// SQLBetStore is the BetStore backed by the Bets table
+type SQLBetStore struct {
+	DB *database.DB
+}
+
+const betColumns = `id, user_id, selection_id, selection_name, event_name, event_date, event_time,
+			bet_type, stake, price, place_places, place_fraction, status, position,
+			gross_return, net_profit, created_at, settled_at`
+
+func (s *SQLBetStore) Create(ctx context.Context, bet models.Bet) (models.Bet, error) {
+	var places, fraction sql.NullInt64
+	if bet.PlaceTerms != nil {
+		places = sql.NullInt64{Int64: int64(bet.PlaceTerms.Places), Valid: true}
+		fraction = sql.NullInt64{Int64: int64(bet.PlaceTerms.Fraction), Valid: true}
+	}
+	bet.Status = models.BetStatusOpen
+
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO Bets (user_id, selection_id, selection_name, event_name, event_date, event_time,
+			bet_type, stake, price, place_places, place_fraction, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, created_at`,
+		bet.UserID, bet.SelectionID, bet.SelectionName, bet.EventName, bet.EventDate, bet.EventTime,
+		bet.BetType, bet.Stake, bet.Price, places, fraction, bet.Status,
+	).Scan(&bet.ID, &bet.CreatedAt)
+	return bet, err
+}
+
+func (s *SQLBetStore) List(ctx context.Context, userID int, from, to, status string) ([]models.Bet, error) {
+	query := `SELECT ` + betColumns + ` FROM Bets WHERE user_id = ?`
+	args := []interface{}{userID}
+	if from != "" {
+		query += ` AND event_date >= ?`
+		args = append(args, from)
+	}
+	if to != "" {
+		query += ` AND event_date <= ?`
+		args = append(args, to)
+	}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY event_date, event_time, id`
+
+	return s.query(ctx, query, args...)
+}
+
+func (s *SQLBetStore) Open(ctx context.Context, userID int, date string) ([]models.Bet, error) {
+	query := `SELECT ` + betColumns + ` FROM Bets WHERE status = ? AND event_date <= ?`
+	args := []interface{}{models.BetStatusOpen, date}
+	if userID != 0 {
+		query += ` AND user_id = ?`
+		args = append(args, userID)
+	}
+	query += ` ORDER BY event_date, event_time, id`
+
+	return s.query(ctx, query, args...)
+}
+
+func (s *SQLBetStore) Settle(ctx context.Context, bet models.Bet) error {
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE Bets
+		SET status = ?,
+			position = ?,
+			gross_return = ?,
+			net_profit = ?,
+			settled_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		bet.Status, bet.Position, bet.GrossReturn, bet.NetProfit, bet.ID)
+	return err
+}
+
+func (s *SQLBetStore) StakingPlan(ctx context.Context, userID int) (models.StakingPlan, error) {
+	var plan models.StakingPlan
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT plan, stake, percent, bank, kelly_fraction, max_stake
+		FROM StakingPlans WHERE user_id = ?`, userID).
+		Scan(&plan.Plan, &plan.Stake, &plan.Percent, &plan.Bank, &plan.KellyFraction, &plan.MaxStake)
+	return plan, err
+}
+
+func (s *SQLBetStore) SaveStakingPlan(ctx context.Context, userID int, plan models.StakingPlan) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO StakingPlans (user_id, plan, stake, percent, bank, kelly_fraction, max_stake)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			plan = excluded.plan,
+			stake = excluded.stake,
+			percent = excluded.percent,
+			bank = excluded.bank,
+			kelly_fraction = excluded.kelly_fraction,
+			max_stake = excluded.max_stake,
+			updated_at = CURRENT_TIMESTAMP`,
+		userID, plan.Plan, plan.Stake, plan.Percent, plan.Bank, plan.KellyFraction, plan.MaxStake)
+	return err
+}
+
+func (s *SQLBetStore) query(ctx context.Context, query string, args ...interface{}) ([]models.Bet, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bets := []models.Bet{}
+	for rows.Next() {
+		bet, err := scanBet(rows)
+		if err != nil {
+			return nil, err
+		}
+		bets = append(bets, bet)
+	}
+
+	return bets, rows.Err()
+}
+
+func scanBet(row scanner) (models.Bet, error) {
+	var bet models.Bet
+	var places, fraction sql.NullInt64
+	var position sql.NullString
+	var grossReturn, netProfit sql.NullFloat64
+	var settledAt sql.NullTime
+	err := row.Scan(
+		&bet.ID, &bet.UserID, &bet.SelectionID, &bet.SelectionName, &bet.EventName, &bet.EventDate, &bet.EventTime,
+		&bet.BetType, &bet.Stake, &bet.Price, &places, &fraction, &bet.Status, &position,
+		&grossReturn, &netProfit, &bet.CreatedAt, &settledAt,
+	)
+	if err != nil {
+		return bet, err
+	}
+
+	bet.PlaceTerms = placeTerms(places, fraction)
+	bet.Position = nullableToString(position)
+	if grossReturn.Valid {
+		bet.GrossReturn = &grossReturn.Float64
+	}
+	if netProfit.Valid {
+		bet.NetProfit = &netProfit.Float64
+	}
+	if settledAt.Valid {
+		bet.SettledAt = &settledAt.Time
+	}
+	return bet, nil
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// TestBets places, settles and lists the bets of a user and saves the plan
+// they stake by
+func TestBets(t *testing.T) {
+	eachDialect(t, testBets)
+}
+
+func testBets(t *testing.T, db *database.DB) {
+	ctx := context.Background()
+	st := New(db)
+
+	bets := []models.Bet{
+		{UserID: 7, SelectionID: 1, SelectionName: "Alpha", EventName: "Ascot", EventDate: "2024-10-05", EventTime: "14:30", BetType: models.BetTypeWin, Stake: 10, Price: "2/1"},
+		{UserID: 7, SelectionID: 2, SelectionName: "Bravo", EventName: "Ascot", EventDate: "2024-10-06", EventTime: "13:10", BetType: models.BetTypeEachWay, Stake: 20, Price: "8/1",
+			PlaceTerms: &models.PlaceTerms{Places: 3, Fraction: 5}},
+		{UserID: 8, SelectionID: 1, SelectionName: "Alpha", EventName: "Ascot", EventDate: "2024-10-05", EventTime: "14:30", BetType: models.BetTypeWin, Stake: 5, Price: "2/1"},
+	}
+	for i := range bets {
+		bet, err := st.Bets.Create(ctx, bets[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bet.ID == 0 || bet.Status != models.BetStatusOpen {
+			t.Fatalf("created bet %d in state %q", bet.ID, bet.Status)
+		}
+		bets[i] = bet
+	}
+
+	open, err := st.Bets.Open(ctx, 0, "2024-10-05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 2 {
+		t.Fatalf("got %d open bets run by the 5th, want both users' Alpha", len(open))
+	}
+
+	won := bets[0]
+	won.Status, won.Position = models.OutcomeWon, "1/8"
+	gross, net := 30.0, 20.0
+	won.GrossReturn, won.NetProfit = &gross, &net
+	if err := st.Bets.Settle(ctx, won); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := st.Bets.List(ctx, 7, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != won.ID || list[1].ID != bets[1].ID {
+		t.Fatalf("got %+v, want user 7's bets in race order", list)
+	}
+	if list[0].Status != models.OutcomeWon || list[0].NetProfit == nil || *list[0].NetProfit != 20 || list[0].SettledAt == nil {
+		t.Errorf("got %+v, want the settled win", list[0])
+	}
+	if terms := list[1].PlaceTerms; terms == nil || terms.Places != 3 || terms.Fraction != 5 {
+		t.Errorf("got place terms %+v, want 3 places at 1/5", terms)
+	}
+
+	open, err = st.Bets.List(ctx, 7, "2024-10-06", "2024-10-06", models.BetStatusOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 || open[0].SelectionName != "Bravo" {
+		t.Errorf("got %+v, want Bravo still open on the 6th", open)
+	}
+
+	if _, err := st.Bets.StakingPlan(ctx, 7); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("got %v before a plan was saved, want sql.ErrNoRows", err)
+	}
+	for _, percent := range []float64{2, 3} {
+		plan := models.StakingPlan{Plan: models.StakingPercentage, Percent: percent, Bank: 500}
+		if err := st.Bets.SaveStakingPlan(ctx, 7, plan); err != nil {
+			t.Fatal(err)
+		}
+	}
+	plan, err := st.Bets.StakingPlan(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Plan != models.StakingPercentage || plan.Percent != 3 || plan.Bank != 500 {
+		t.Errorf("got %+v, want the 3%% plan saved last", plan)
+	}
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// ConfigStore reads and writes the settings kept in the Configurations table
+type ConfigStore interface {
+	// All returns every setting keyed by name
+	All(ctx context.Context) (map[string]string, error)
+	// Update saves settings and records the ones that changed in ConfigAudit
+	// as made by user, all or nothing
+	Update(ctx context.Context, settings map[string]string, user models.User) ([]models.ConfigAudit, error)
+	// Audit returns the latest limit changes, newest first
+	Audit(ctx context.Context, limit int) ([]models.ConfigAudit, error)
+}
+
+// SQLConfigStore is the ConfigStore backed by the Configurations table
+type SQLConfigStore struct {
+	DB *database.DB
+}
+
+func (s *SQLConfigStore) All(ctx context.Context) (map[string]string, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT ID, key, value FROM Configurations ORDER BY id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	configurations := make(map[string]string)
+	for rows.Next() {
+		configuration := models.Configuration{}
+		if err := rows.Scan(&configuration.ID, &configuration.Key, &configuration.Value); err != nil {
+			return nil, err
+		}
+
+		// Only add the configuration if its ID is not zero
+		if configuration.ID != 0 {
+			configurations[configuration.Key] = configuration.Value
+		}
+	}
+
+	return configurations, rows.Err()
+}
+
+func (s *SQLConfigStore) Update(ctx context.Context, settings map[string]string, user models.User) ([]models.ConfigAudit, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changedAt := time.Now()
+	var changes []models.ConfigAudit
+	for _, key := range keys {
+		change := models.ConfigAudit{
+			Key:       key,
+			NewValue:  settings[key],
+			UserID:    user.ID,
+			ChangedBy: user.Email,
+			ChangedAt: changedAt,
+		}
+
+		var oldValue string
+		err := tx.QueryRowContext(ctx, s.DB.Dialect.Rebind(`SELECT value FROM Configurations WHERE key = ?`), key).Scan(&oldValue)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return nil, err
+		case oldValue == change.NewValue:
+			continue
+		default:
+			change.OldValue = &oldValue
+		}
+
+		_, err = tx.ExecContext(ctx, s.DB.Dialect.Rebind(`
+			INSERT INTO Configurations (key, value) VALUES (?, ?)
+			ON CONFLICT (key) DO UPDATE SET value = excluded.value`),
+			key, change.NewValue)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.QueryRowContext(ctx, s.DB.Dialect.Rebind(`
+			INSERT INTO ConfigAudit (key, old_value, new_value, user_id, changed_by, changed_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			RETURNING id`),
+			key, change.OldValue, change.NewValue, user.ID, user.Email, changedAt).Scan(&change.ID)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, tx.Commit()
+}
+
+func (s *SQLConfigStore) Audit(ctx context.Context, limit int) ([]models.ConfigAudit, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, key, old_value, new_value, COALESCE(user_id, 0), changed_by, changed_at
+		FROM ConfigAudit
+		ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []models.ConfigAudit
+	for rows.Next() {
+		var change models.ConfigAudit
+		var oldValue sql.NullString
+		if err := rows.Scan(&change.ID, &change.Key, &oldValue, &change.NewValue,
+			&change.UserID, &change.ChangedBy, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		if oldValue.Valid {
+			change.OldValue = &oldValue.String
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
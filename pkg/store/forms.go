@@ -0,0 +1,313 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+	"github.com/mmanjoura/clean-bet-backend/pkg/odds"
+)
+
+// FormStore reads and writes the past performances of the runners
+type FormStore interface {
+	// Upsert saves a form line of a selection, updating it if already stored
+	Upsert(ctx context.Context, selectionName string, selectionID int, form models.SelectionForm) error
+	// Summary aggregates the form lines of a selection run strictly before
+	// the date before, every line when before is empty. ErrNoForm is returned
+	// when the selection has none.
+	Summary(ctx context.Context, selectionID int, before string) (models.AnalysisData, error)
+	// Result returns how a selection finished in the race of date
+	Result(ctx context.Context, selectionID int, date string) (models.WinLose, error)
+	// Position returns the position line of a selection in the race of date
+	Position(ctx context.Context, selectionID int, date string) (string, error)
+	// Outcome returns the position line and starting price of a selection in
+	// the race of date, from its form line or else from the result settled on
+	// its analysis. sql.ErrNoRows is returned when neither is known.
+	Outcome(ctx context.Context, selectionID int, date string) (position, price string, err error)
+	// LastRuns returns the dates of the latest limit runs, newest first
+	LastRuns(ctx context.Context, selectionID int, limit int) ([]models.DaySince, error)
+}
+
+// SQLFormStore is the FormStore backed by the Forms table
+type SQLFormStore struct {
+	DB *database.DB
+}
+
+func (s *SQLFormStore) Upsert(ctx context.Context, selectionName string, selectionID int, selectionForm models.SelectionForm) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO Forms (
+			selection_name,
+			selection_id,
+			race_class,
+			race_date,
+			position,
+			rating,
+			race_type,
+			racecourse,
+			distance,
+			going,
+			sp_odds,
+			Age,
+			Trainer,
+			Sex,
+			Sire,
+			Dam,
+			Owner,
+			created_at,
+			updated_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (selection_id, race_date) DO UPDATE SET
+			selection_name = excluded.selection_name,
+			race_class = excluded.race_class,
+			position = excluded.position,
+			rating = excluded.rating,
+			race_type = excluded.race_type,
+			racecourse = excluded.racecourse,
+			distance = excluded.distance,
+			going = excluded.going,
+			sp_odds = excluded.sp_odds,
+			Age = excluded.Age,
+			Trainer = excluded.Trainer,
+			Sex = excluded.Sex,
+			Sire = excluded.Sire,
+			Dam = excluded.Dam,
+			Owner = excluded.Owner,
+			updated_at = excluded.updated_at`,
+		selectionName, selectionID, selectionForm.RaceClass, selectionForm.RaceDate, selectionForm.Position,
+		selectionForm.Rating, selectionForm.RaceType, selectionForm.Racecourse,
+		selectionForm.Distance, selectionForm.Going,
+		selectionForm.SpOdds, selectionForm.Age, selectionForm.Trainer,
+		selectionForm.Sex, selectionForm.Sire, selectionForm.Dam, selectionForm.Owner,
+		time.Now(),
+		time.Now())
+	return err
+}
+
+func (s *SQLFormStore) Summary(ctx context.Context, selectionID int, before string) (models.AnalysisData, error) {
+	var data models.AnalysisData
+
+	d := s.DB.Dialect
+
+	filter := ""
+	args := []interface{}{selectionID}
+	if before != "" {
+		filter = fmt.Sprintf(" AND %s < ?", d.Date("race_date"))
+		args = append(args, before)
+	}
+
+	// The descriptive columns come from the first form line of the selection
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT
+			COALESCE(earliest.selection_id, 0),
+			COALESCE(earliest.selection_name, ''),
+			COALESCE(earliest.position, ''),
+			COALESCE(earliest.Age, ''),
+			COALESCE(earliest.Trainer, ''),
+			COALESCE(earliest.Sex, ''),
+			COALESCE(earliest.Sire, ''),
+			COALESCE(earliest.Dam, ''),
+			COALESCE(earliest.Owner, ''),
+			COALESCE(earliest.race_class, ''),
+			earliest.race_date,
+			totals.num_runs,
+			totals.last_run_date,
+			COALESCE(totals.duration, 0),
+			totals.win_count,
+			COALESCE(totals.avg_position, 0),
+			COALESCE(totals.avg_rating, 0),
+			COALESCE(totals.avg_distance_furlongs, 0),
+			totals.all_odds,
+			COALESCE(totals.all_positions, ''),
+			COALESCE(totals.all_distances, ''),
+			COALESCE(totals.all_racecources, ''),
+			COALESCE(totals.all_race_dates, '')
+		FROM (
+			SELECT selection_id, selection_name, position, Age, Trainer, Sex, Sire, Dam, Owner, race_class, race_date
+			FROM Forms
+			WHERE selection_id = ?%s
+			ORDER BY race_date LIMIT 1
+		) earliest
+		CROSS JOIN (
+			SELECT
+				COUNT(id) AS num_runs,
+				MAX(race_date) AS last_run_date,
+				%s AS duration,
+				COUNT(CASE WHEN position = '1' THEN 1 END) AS win_count,
+				AVG(%s) AS avg_position,
+				AVG(%s) AS avg_rating,
+				AVG(%s) AS avg_distance_furlongs,
+				COALESCE(%s, '') AS all_odds,
+				%s AS all_positions,
+				%s AS all_distances,
+				%s AS all_racecources,
+				%s AS all_race_dates
+			FROM Forms
+			WHERE selection_id = ?%s
+		) totals`,
+		filter,
+		d.YearsBetween("MIN(race_date)", "MAX(race_date)"),
+		d.Number("position"),
+		d.Number("rating"),
+		d.Number("distance"),
+		d.GroupConcat("sp_odds", ", ", "race_date"),
+		d.GroupConcat("position", ", ", "race_date"),
+		d.GroupConcat("distance", ", ", "race_date"),
+		d.GroupConcat("racecourse", ", ", "race_date"),
+		d.GroupConcat(d.Date("race_date"), ", ", "race_date"),
+		filter,
+	), append(args, args...)...)
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return data, err
+		}
+		return data, ErrNoForm
+	}
+
+	// Lines saved without a race date are summarised without one
+	var allOdds string
+	var raceDate, lastRunDate sql.NullString
+	if err := rows.Scan(
+		&data.SelectionID,
+		&data.SelectionName,
+		&data.Position,
+		&data.Age,
+		&data.Trainer,
+		&data.Sex,
+		&data.Sire,
+		&data.Dam,
+		&data.Owner,
+		&data.EventClass,
+		&raceDate,
+		&data.NumRuns,
+		&lastRunDate,
+		&data.Duration,
+		&data.WinCount,
+		&data.AvgPosition,
+		&data.AvgRating,
+		&data.AvgDistanceFurlongs,
+		&allOdds,
+		&data.AllPositions,
+		&data.AllDistances,
+		&data.AllCources,
+		&data.AllRaceDates,
+	); err != nil {
+		return models.AnalysisData{}, fmt.Errorf("form summary of selection %d: %w", selectionID, err)
+	}
+	if data.NumRuns == 0 {
+		return models.AnalysisData{}, ErrNoForm
+	}
+	data.RaceDate = nullableToString(raceDate)
+	data.LastRunDate = nullableToString(lastRunDate)
+	data.AvgOdds = averageOdds(strings.Split(allOdds, ", "))
+
+	return data, nil
+}
+
+// averageOdds returns the mean of the starting prices as odds to one,
+// leaving out the runs without a price
+func averageOdds(prices []string) float64 {
+	var total float64
+	var count int
+	for _, price := range prices {
+		o, err := odds.Parse(price)
+		if err != nil {
+			continue
+		}
+		total += o.ToOne()
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+func (s *SQLFormStore) Result(ctx context.Context, selectionID int, date string) (models.WinLose, error) {
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT selection_id,
+			selection_name,
+			race_date,
+			%s as postion
+		FROM Forms
+		WHERE %s = ? and selection_id = ?`, s.DB.Dialect.Before("position", "/"), s.DB.Dialect.Date("race_date")),
+		date, selectionID)
+	if err != nil {
+		return models.WinLose{}, err
+	}
+	defer rows.Close()
+
+	var data models.WinLose
+	for rows.Next() {
+		err := rows.Scan(
+			&data.SelectionID,
+			&data.SelectionName,
+			&data.EventDate,
+			&data.Position,
+		)
+		if err != nil {
+			return models.WinLose{}, err
+		}
+	}
+
+	return data, rows.Err()
+}
+
+func (s *SQLFormStore) Position(ctx context.Context, selectionID int, date string) (string, error) {
+	var position string
+	err := s.DB.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT position
+		FROM Forms
+		WHERE %s = ? and selection_id = ?`, s.DB.Dialect.Date("race_date")),
+		date, selectionID).Scan(&position)
+	return position, err
+}
+
+func (s *SQLFormStore) Outcome(ctx context.Context, selectionID int, date string) (string, string, error) {
+	var position, price string
+	err := s.DB.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT position, price FROM (
+			SELECT 0 AS source, position, COALESCE(sp_odds, '') AS price
+			FROM Forms
+			WHERE %s = ? AND selection_id = ?
+			UNION ALL
+			SELECT 1 AS source, current_event_position AS position, current_event_price AS price
+			FROM Analysis
+			WHERE event_date = ? AND selection_id = ? AND COALESCE(current_event_price, '') <> ''
+		) outcomes
+		ORDER BY source LIMIT 1`, s.DB.Dialect.Date("race_date")),
+		date, selectionID, date, selectionID).Scan(&position, &price)
+	return position, price, err
+}
+
+func (s *SQLFormStore) LastRuns(ctx context.Context, selectionID int, limit int) ([]models.DaySince, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT race_date,
+			selection_id
+		FROM Forms WHERE selection_id = ?
+		ORDER BY race_date DESC LIMIT ?`, selectionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var daysSince []models.DaySince
+	for rows.Next() {
+		var race models.DaySince
+		if err := rows.Scan(&race.RaceDate, &race.SelectionID); err != nil {
+			return nil, err
+		}
+		daysSince = append(daysSince, race)
+	}
+
+	return daysSince, rows.Err()
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// TestFormSummary aggregates form lines saved out of order: the lists come
+// in race date order and the lines of the analysed date and later are left
+// out
+func TestFormSummary(t *testing.T) {
+	eachDialect(t, testFormSummary)
+}
+
+func testFormSummary(t *testing.T, db *database.DB) {
+	ctx := context.Background()
+	st := New(db)
+
+	line := models.SelectionForm{Age: "4", Trainer: "J Smith", Sex: "Gelding", Sire: "Frankel", Dam: "Arrow", Owner: "A Owner", Class: "Class 3"}
+	lines := []struct {
+		date                      time.Time
+		position, distance, price string
+	}{
+		{time.Date(2024, 9, 14, 0, 0, 0, 0, time.UTC), "2/9", "1m 2f", "5/1"},
+		{time.Date(2024, 8, 3, 0, 0, 0, 0, time.UTC), "1/7", "1m", "3/1"},
+		{time.Date(2024, 10, 5, 0, 0, 0, 0, time.UTC), "4/12", "1m 4f", "8/1"},
+	}
+	for _, l := range lines {
+		line.RaceDate, line.Position, line.Distance, line.SpOdds = l.date, l.position, l.distance, l.price
+		line.Racecourse = "Ascot"
+		if err := st.Forms.Upsert(ctx, "Golden Arrow", 1001, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := st.Forms.Summary(ctx, 1001, "2024-10-05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.NumRuns != 2 {
+		t.Errorf("got %d runs, want the 2 before the date", data.NumRuns)
+	}
+	if data.AllPositions != "1/7, 2/9" {
+		t.Errorf("got positions %q, want them by race date", data.AllPositions)
+	}
+	if data.AllDistances != "1m, 1m 2f" {
+		t.Errorf("got distances %q, want them by race date", data.AllDistances)
+	}
+	if data.AllRaceDates != "2024-08-03, 2024-09-14" {
+		t.Errorf("got race dates %q", data.AllRaceDates)
+	}
+	if data.AvgPosition != 1.5 {
+		t.Errorf("got an average position of %g, want 1.5", data.AvgPosition)
+	}
+	if data.Trainer != "J Smith" || data.RaceDate[:10] != "2024-08-03" {
+		t.Errorf("got trainer %q and first run %q, want those of the earliest line", data.Trainer, data.RaceDate)
+	}
+
+	if _, err := st.Forms.Summary(ctx, 1001, "2024-08-03"); !errors.Is(err, ErrNoForm) {
+		t.Errorf("got %v before the first run, want ErrNoForm", err)
+	}
+
+	// A line without its descriptive columns, or a position that is a number,
+	// is still form
+	_, err = db.Exec(`INSERT INTO Forms (selection_id, race_date, position) VALUES (?, ?, ?)`,
+		1002, time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC), "PU/10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = st.Forms.Summary(ctx, 1002, "2024-10-05")
+	if err != nil {
+		t.Fatalf("got %v for a bare form line", err)
+	}
+	if data.NumRuns != 1 || data.AllPositions != "PU/10" || data.AvgPosition != 0 || data.Trainer != "" {
+		t.Errorf("got %+v, want the pulled up run alone", data)
+	}
+
+	// Failures of the database are not mistaken for a lack of form
+	db.Close()
+	if _, err := st.Forms.Summary(ctx, 1001, ""); err == nil || errors.Is(err, ErrNoForm) {
+		t.Errorf("got %v from a closed database, want its error", err)
+	}
+}
+
+// TestMeetingEvents lists the races of each meeting of the date in time order
+func TestMeetingEvents(t *testing.T) {
+	eachDialect(t, testMeetingEvents)
+}
+
+func testMeetingEvents(t *testing.T, db *database.DB) {
+	ctx := context.Background()
+	st := New(db)
+
+	runners := []models.MeetingSelections{
+		{SelectionID: 1, SelectionName: "A", EventName: "Ascot", EventTime: "15:40", Price: "2/1"},
+		{SelectionID: 2, SelectionName: "B", EventName: "Ascot", EventTime: "14:30", Price: "3/1"},
+		{SelectionID: 3, SelectionName: "C", EventName: "Ayr", EventTime: "13:15", Price: "4/1"},
+	}
+	for _, runner := range runners {
+		if err := st.Meetings.Upsert(ctx, "2024-10-05", runner); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := st.Meetings.Events(ctx, "2024-10-05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d meetings, want Ascot and Ayr", len(events))
+	}
+	if events[0].EventName != "Ascot" || events[0].EventTime != "14:30,15:40" {
+		t.Errorf("got %s at %s, want Ascot at 14:30,15:40", events[0].EventName, events[0].EventTime)
+	}
+}
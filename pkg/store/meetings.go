@@ -0,0 +1,302 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// MeetingStore reads and writes the declared runners of a race day
+type MeetingStore interface {
+	// Upsert saves a runner declared for date, updating it if already stored
+	Upsert(ctx context.Context, date string, runner models.MeetingSelections) error
+	// Runners returns the runners of date with their links
+	Runners(ctx context.Context, date string) ([]models.MeetingSelections, error)
+	// Selections returns the runners of date with their race conditions
+	Selections(ctx context.Context, date string) ([]models.Selection, error)
+	// RaceSelections returns the runners of a single race
+	RaceSelections(ctx context.Context, eventName, eventTime, date string) ([]models.Selection, error)
+	// Events returns the meetings of date with their race times
+	Events(ctx context.Context, date string) ([]models.Event, error)
+	// Price returns the declared price of a runner
+	Price(ctx context.Context, date string, selectionID int) (string, error)
+	// Countries returns the country of each course, keyed by event name
+	Countries(ctx context.Context) (map[string]string, error)
+}
+
+// SQLMeetingStore is the MeetingStore backed by the Meetings table
+type SQLMeetingStore struct {
+	DB *database.DB
+}
+
+func (s *SQLMeetingStore) Upsert(ctx context.Context, date string, runner models.MeetingSelections) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO Meetings (
+			selection_link,
+			selection_id,
+			event_link,
+			selection_name,
+			event_time,
+			event_name,
+			price,
+			event_date,
+			race_distance,
+			race_category,
+			track_condition,
+			number_of_runners,
+			race_track,
+			race_class,
+			created_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (selection_id, event_date, event_time) DO UPDATE SET
+			selection_link = excluded.selection_link,
+			event_link = excluded.event_link,
+			selection_name = excluded.selection_name,
+			event_name = excluded.event_name,
+			price = excluded.price,
+			race_distance = excluded.race_distance,
+			race_category = excluded.race_category,
+			track_condition = excluded.track_condition,
+			number_of_runners = excluded.number_of_runners,
+			race_track = excluded.race_track,
+			race_class = excluded.race_class`,
+		runner.SelectionLink,
+		runner.SelectionID,
+		runner.EventLink,
+		runner.SelectionName,
+		runner.EventTime,
+		runner.EventName,
+		runner.Price,
+		date,
+		runner.RaceConditon.RaceDistance,
+		runner.RaceConditon.RaceCategory,
+		runner.RaceConditon.TrackCondition,
+		runner.RaceConditon.NumberOfRunners,
+		runner.RaceConditon.RaceTrack,
+		runner.RaceConditon.RaceClass,
+		time.Now())
+	return err
+}
+
+func (s *SQLMeetingStore) Runners(ctx context.Context, date string) ([]models.MeetingSelections, error) {
+	var runners []models.MeetingSelections
+
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT selection_link,
+			selection_id,
+			event_link,
+			selection_name,
+			event_time,
+			event_name,
+			price,
+			event_date
+		FROM Meetings WHERE %s = ?`, s.DB.Dialect.Date("event_date")), date)
+	if err != nil {
+		return runners, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var runner models.MeetingSelections
+		err := rows.Scan(&runner.SelectionLink,
+			&runner.SelectionID, &runner.EventLink, &runner.SelectionName,
+			&runner.EventTime, &runner.EventName, &runner.Price,
+			&runner.EventDate)
+		if err != nil {
+			return runners, err
+		}
+		runners = append(runners, runner)
+	}
+
+	return runners, rows.Err()
+}
+
+func (s *SQLMeetingStore) Selections(ctx context.Context, date string) ([]models.Selection, error) {
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT selection_id,
+			selection_name,
+			event_name,
+			event_date,
+			event_time,
+			price,
+			race_distance,
+			race_category,
+			track_condition,
+			number_of_runners,
+			race_track,
+			race_class,
+			selection_link,
+			event_link
+		FROM Meetings
+		WHERE %s = ?`, s.DB.Dialect.Date("event_date")), date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var selections []models.Selection
+	for rows.Next() {
+		var selection models.Selection
+
+		// Use sql.NullString for nullable fields
+		var selectionName, eventName, eventDate,
+			eventTime, raceDistance, raceCategory,
+			trackCondition,
+			numberOfRunners,
+			raceTrack, raceClass,
+			odds, selectionLink, eventLink sql.NullString
+
+		if err := rows.Scan(
+			&selection.ID,
+			&selectionName,
+			&eventName,
+			&eventDate,
+			&eventTime,
+			&odds,
+			&raceDistance,
+			&raceCategory,
+			&trackCondition,
+			&numberOfRunners,
+			&raceTrack,
+			&raceClass,
+			&selectionLink,
+			&eventLink,
+		); err != nil {
+			return nil, err
+		}
+
+		selection.Name = nullableToString(selectionName)
+		selection.EventName = nullableToString(eventName)
+		selection.EventDate = nullableToString(eventDate)
+		selection.EventTime = nullableToString(eventTime)
+		selection.RaceDistance = nullableToString(raceDistance)
+		selection.RaceCategory = nullableToString(raceCategory)
+		selection.TrackCondition = nullableToString(trackCondition)
+		selection.NumberOfRunners = nullableToString(numberOfRunners)
+		selection.RaceTrack = nullableToString(raceTrack)
+		selection.RaceClass = nullableToString(raceClass)
+		selection.Link = nullableToString(selectionLink)
+		selection.EventLink = nullableToString(eventLink)
+		selection.Odds = nullableToString(odds)
+		selections = append(selections, selection)
+	}
+
+	return selections, rows.Err()
+}
+
+func (s *SQLMeetingStore) RaceSelections(ctx context.Context, eventName, eventTime, date string) ([]models.Selection, error) {
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT selection_id,
+			selection_name,
+			event_name,
+			event_date,
+			event_time,
+			race_distance,
+			race_category,
+			track_condition,
+			number_of_runners,
+			race_track,
+			race_class
+		FROM Meetings WHERE
+			event_name = ? and event_time = ? and %s = ?`, s.DB.Dialect.Date("event_date")),
+		eventName, eventTime, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var selections []models.Selection
+	for rows.Next() {
+		var selection models.Selection
+		// Use sql.NullString for nullable fields
+		var selectionName, meetingName, eventDate, eventTime, raceDistance, raceCategory, trackCondition, numberOfRunners, raceTrack, raceClass sql.NullString
+
+		err := rows.Scan(
+			&selection.ID,
+			&selectionName,
+			&meetingName,
+			&eventDate,
+			&eventTime,
+			&raceDistance,
+			&raceCategory,
+			&trackCondition,
+			&numberOfRunners,
+			&raceTrack,
+			&raceClass,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		selection.Name = nullableToString(selectionName)
+		selection.EventName = nullableToString(meetingName)
+		selection.EventDate = nullableToString(eventDate)
+		selection.EventTime = nullableToString(eventTime)
+		selection.RaceDistance = nullableToString(raceDistance)
+		selection.RaceCategory = nullableToString(raceCategory)
+		selection.TrackCondition = nullableToString(trackCondition)
+		selection.NumberOfRunners = nullableToString(numberOfRunners)
+		selection.RaceTrack = nullableToString(raceTrack)
+		selection.RaceClass = nullableToString(raceClass)
+		selections = append(selections, selection)
+	}
+
+	return selections, rows.Err()
+}
+
+func (s *SQLMeetingStore) Events(ctx context.Context, date string) ([]models.Event, error) {
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT event_name,
+			%s AS event_times
+		FROM Meetings
+		WHERE %s = ?
+		GROUP BY event_name ORDER BY event_name`,
+		s.DB.Dialect.GroupConcat("event_time", ",", "event_time"), s.DB.Dialect.Date("event_date")), date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		var event models.Event
+		if err := rows.Scan(&event.EventName, &event.EventTime); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (s *SQLMeetingStore) Price(ctx context.Context, date string, selectionID int) (string, error) {
+	var price string
+	err := s.DB.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT price FROM Meetings WHERE %s = ? and selection_id = ?`, s.DB.Dialect.Date("event_date")),
+		date, selectionID).Scan(&price)
+	return price, err
+}
+
+func (s *SQLMeetingStore) Countries(ctx context.Context) (map[string]string, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT event_name, COALESCE(country, '') FROM Events`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	countries := make(map[string]string)
+	for rows.Next() {
+		var eventName, country string
+		if err := rows.Scan(&eventName, &country); err != nil {
+			return nil, err
+		}
+		countries[eventName] = country
+	}
+
+	return countries, rows.Err()
+}
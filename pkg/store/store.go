@@ -0,0 +1,49 @@
+// Package store keeps the SQL of the racing tables behind typed repositories.
+// Handlers and the scoring code depend on the interfaces, so they can run
+// against in-memory fakes as well as the database.
+package store
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+)
+
+// ErrNoForm is returned when a selection has no usable form lines
+var ErrNoForm = errors.New("selection has no form")
+
+// ErrUnknownProfile is returned for a scoring profile with no score_constants
+var ErrUnknownProfile = errors.New("unknown scoring profile")
+
+// Store groups the repositories the application works with
+type Store struct {
+	Meetings  MeetingStore
+	Forms     FormStore
+	Analysis  AnalysisStore
+	Users     UserStore
+	Config    ConfigStore
+	Backtests BacktestStore
+	Bets      BetStore
+}
+
+// New returns repositories backed by db
+func New(db *database.DB) *Store {
+	return &Store{
+		Meetings:  &SQLMeetingStore{DB: db},
+		Forms:     &SQLFormStore{DB: db},
+		Analysis:  &SQLAnalysisStore{DB: db},
+		Users:     &SQLUserStore{DB: db},
+		Config:    &SQLConfigStore{DB: db},
+		Backtests: &SQLBacktestStore{DB: db},
+		Bets:      &SQLBetStore{DB: db},
+	}
+}
+
+// nullableToString converts sql.NullString to a regular string
+func nullableToString(ns sql.NullString) string {
+	if ns.Valid {
+		return ns.String
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+
+	"github.com/mmanjoura/clean-bet-backend/pkg/database"
+	"github.com/mmanjoura/clean-bet-backend/pkg/models"
+)
+
+// UserStore reads and writes the registered users
+type UserStore interface {
+	// ByEmail returns the user registered with email, sql.ErrNoRows if none
+	ByEmail(ctx context.Context, email string) (models.User, error)
+	// Create registers a new user
+	Create(ctx context.Context, user models.User) error
+}
+
+// SQLUserStore is the UserStore backed by the Users table
+type SQLUserStore struct {
+	DB *database.DB
+}
+
+func (s *SQLUserStore) ByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id,
+			full_name,
+			email,
+			password,
+			phone_number,
+			user_type,
+			profile,
+			avatar_url,
+			created_at,
+			updated_at
+		FROM Users WHERE email = ?`, email).
+		Scan(&user.ID, &user.FullName, &user.Email, &user.Password, &user.PhoneNumber,
+			&user.UserType, &user.Profile, &user.AvatarUrl, &user.CreatedAt, &user.UpdatedAt)
+	return user, err
+}
+
+func (s *SQLUserStore) Create(ctx context.Context, user models.User) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO Users (full_name, email, password, phone_number, user_type, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		user.FullName, user.Email, user.Password, user.PhoneNumber, user.UserType, user.CreatedAt, user.UpdatedAt)
+	return err
+}